@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+)
+
+// runAudit implements the "audit" subcommand, which filters and summarises
+// audit logs. It returns the process exit code.
+func runAudit(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	return runAuditAt(time.Now(), args, stdin, stdout, stderr)
+}
+
+// runAuditAt runs the audit subcommand with relative times calculated from now.
+func runAuditAt(now time.Time, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: chinmina-bridge audit [flags] [file ...]")
+		fmt.Fprintln(stderr, "\nFilters and summarises audit logs. Reads stdin if no files are given.")
+		flags.PrintDefaults()
+	}
+
+	var filter audit.Filter
+	flags.StringVar(&filter.Pipeline, "pipeline", "", "only include requests from the pipeline with this slug")
+	flags.StringVar(&filter.Repository, "repository", "", "only include tokens for this repository (URL or owner/repo)")
+	flags.IntVar(&filter.Status, "status", 0, "only include requests with this HTTP response status")
+	since := flags.String("since", "", "only include requests at or after this time (RFC 3339, or a duration before now such as 24h)")
+	until := flags.String("until", "", "only include requests before this time (RFC 3339, or a duration before now)")
+	format := flags.String("format", "table", "output format: table or json")
+	listRecords := flags.Bool("records", false, "list the matching requests as well as the summary")
+
+	volume := audit.VolumeOptions{}
+	flags.Float64Var(&volume.Factor, "volume-factor", 3, "report hours where a pipeline's requests exceed its usual hourly volume by this factor")
+	flags.IntVar(&volume.MinRequests, "volume-min", 20, "the minimum hourly requests reported as unusual volume")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	if filter.Since, err = parseTimeFlag(now, *since); err != nil {
+		fmt.Fprintf(stderr, "error: invalid -since: %v\n", err)
+		return 2
+	}
+	if filter.Until, err = parseTimeFlag(now, *until); err != nil {
+		fmt.Fprintf(stderr, "error: invalid -until: %v\n", err)
+		return 2
+	}
+
+	if *format != "table" && *format != "json" {
+		fmt.Fprintf(stderr, "error: unknown format %q, expected table or json\n", *format)
+		return 2
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	summarizer := audit.NewSummarizer(volume)
+	var records []audit.Record
+
+	for _, name := range files {
+		err := readAuditFile(name, stdin, func(r audit.Record) error {
+			if !filter.Match(r) {
+				return nil
+			}
+
+			summarizer.Add(r)
+			if *listRecords {
+				records = append(records, r)
+			}
+
+			return nil
+		})
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s: %v\n", name, err)
+			return 2
+		}
+	}
+
+	summary := summarizer.Summary()
+
+	if *format == "json" {
+		out := struct {
+			audit.Summary
+			Requests []audit.Record `json:"requests,omitempty"`
+		}{summary, records}
+
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return 2
+		}
+
+		return 0
+	}
+
+	printAuditTables(stdout, summary, records, *listRecords)
+
+	return 0
+}
+
+func readAuditFile(name string, stdin io.Reader, fn func(audit.Record) error) error {
+	if name == "-" {
+		return audit.ReadRecords(stdin, fn)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return audit.ReadRecords(f, fn)
+}
+
+// parseTimeFlag parses an RFC 3339 time, or a duration that is subtracted from
+// now.
+func parseTimeFlag(now time.Time, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func printAuditTables(w io.Writer, summary audit.Summary, records []audit.Record, listRecords bool) {
+	fmt.Fprintf(w, "%d requests, %d tokens vended, %d denied, %d errors", summary.Records, summary.Tokens, summary.Denials, summary.Errors)
+	if summary.From != nil {
+		fmt.Fprintf(w, " (%s to %s)", summary.From.UTC().Format(time.RFC3339), summary.To.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "\nPIPELINE\tREQUESTS\tTOKENS\tCACHE HITS\tDENIED\tERRORS\tLAST REQUEST")
+	for _, p := range summary.Pipelines {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%s\n", p.Pipeline, p.Requests, p.Tokens, p.CacheHits, p.Denials, p.Errors, p.LastRequest)
+	}
+
+	if len(summary.Reasons) > 0 {
+		fmt.Fprintln(tw, "\nDENIALS\tREASON")
+		for _, r := range summary.Reasons {
+			fmt.Fprintf(tw, "%d\t%s\n", r.Count, r.Reason)
+		}
+	}
+
+	if len(summary.Anomalies) > 0 {
+		fmt.Fprintln(tw, "\nUNUSUAL VOLUME\tHOUR\tREQUESTS\tUSUAL")
+		for _, a := range summary.Anomalies {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%.1f\n", a.Pipeline, a.Hour.Format(time.RFC3339), a.Requests, a.Baseline)
+		}
+	}
+
+	if listRecords {
+		fmt.Fprintln(tw, "\nTIME\tPIPELINE\tBUILD\tSTATUS\tREPOSITORY\tERROR")
+		for _, r := range records {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n",
+				r.Time.UTC().Format(time.RFC3339), r.PipelineSlug, r.BuildNumber, r.Status,
+				strings.Join(r.Repositories, ","), r.Error)
+		}
+	}
+
+	tw.Flush()
+}
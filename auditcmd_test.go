@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var auditLogLines = strings.Join([]string{
+	`{"level":"info","time":"2026-01-01T10:00:00Z","message":"starting server"}`,
+	`{"level":"audit","type":"audit","time":"2026-01-01T10:00:00Z","message":"audit_event","path":"/token","status":200,"authorized":true,"pipelineSlug":"deploy","buildNumber":4,"repositories":["https://github.com/org/app.git"],"cacheStatus":"miss"}`,
+	`{"level":"audit","type":"audit","time":"2026-01-01T11:00:00Z","message":"audit_event","path":"/git-credentials","status":200,"authorized":true,"pipelineSlug":"deploy","buildNumber":5,"repositories":["https://github.com/org/app.git"],"cacheStatus":"hit"}`,
+	`{"level":"audit","type":"audit","time":"2026-01-01T11:30:00Z","message":"audit_event","path":"/token","status":401,"authorized":false,"error":"JWT is invalid"}`,
+	`{"level":"audit","type":"audit","time":"2026-01-01T12:00:00Z","message":"audit_event","path":"/token","status":200,"authorized":true,"pipelineSlug":"docs","buildNumber":1,"repositories":["https://github.com/org/docs.git"],"cacheStatus":"miss"}`,
+}, "\n")
+
+func TestRunAudit_Table(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runAudit([]string{"-records"}, strings.NewReader(auditLogLines), &stdout, &stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+
+	out := stdout.String()
+	assert.Contains(t, out, "4 requests, 3 tokens vended, 1 denied, 0 errors (2026-01-01T10:00:00Z to 2026-01-01T12:00:00Z)")
+	assert.Regexp(t, `deploy\s+2\s+2\s+1\s+0\s+0\s+2026-01-01T11:00:00Z`, out)
+	assert.Regexp(t, `1\s+JWT is invalid`, out)
+	assert.Regexp(t, `2026-01-01T12:00:00Z\s+docs\s+1\s+200\s+https://github.com/org/docs.git`, out)
+}
+
+func TestRunAudit_FilteredJSON(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	var stdout, stderr bytes.Buffer
+	code := runAuditAt(now, []string{"-format", "json", "-since", "2h", "-repository", "org/app"}, strings.NewReader(auditLogLines), &stdout, &stderr)
+
+	require.Equal(t, 0, code, stderr.String())
+
+	var out struct {
+		Records   int `json:"records"`
+		Tokens    int `json:"tokens"`
+		Pipelines []struct {
+			Pipeline string `json:"pipeline"`
+		} `json:"pipelines"`
+	}
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &out))
+
+	// only the 11:00 deploy request is after 10:30 and for org/app
+	assert.Equal(t, 1, out.Records)
+	assert.Equal(t, 1, out.Tokens)
+	require.Len(t, out.Pipelines, 1)
+	assert.Equal(t, "deploy", out.Pipelines[0].Pipeline)
+}
+
+func TestRunAudit_InvalidArguments(t *testing.T) {
+	cases := [][]string{
+		{"-format", "xml"},
+		{"-since", "yesterday"},
+		{"missing-file.log"},
+	}
+
+	for _, args := range cases {
+		var stdout, stderr bytes.Buffer
+		code := runAudit(args, strings.NewReader(""), &stdout, &stderr)
+
+		assert.Equal(t, 2, code, "args %v", args)
+		assert.Contains(t, stderr.String(), "error:")
+	}
+}
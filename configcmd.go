@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/jwt"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
+	"github.com/jamestelfer/chinmina-bridge/internal/observe"
+	"github.com/jamestelfer/chinmina-bridge/internal/secret"
+	"github.com/jamestelfer/chinmina-bridge/internal/tlsconfig"
+	"github.com/jamestelfer/chinmina-bridge/internal/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// runConfig checks or shows the configuration, loaded in the same way as the
+// server loads it. The server is not started, and no external service is
+// contacted.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	usage := func() {
+		fmt.Fprintln(stderr, "usage: chinmina-bridge config check|show [flags]")
+		fmt.Fprintln(stderr, "\n  check  validates the configuration, reporting all problems found")
+		fmt.Fprintln(stderr, "  show   prints the effective configuration, with secrets redacted")
+	}
+
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "check":
+		return runConfigCheck(args[1:], stdout, stderr)
+	case "show":
+		return runConfigShow(args[1:], stdout, stderr)
+	default:
+		usage()
+		return 2
+	}
+}
+
+func runConfigCheck(args []string, stdout, stderr io.Writer) int {
+	cfg, code := loadConfigFlags("check", args, stderr)
+	if code != 0 {
+		return code
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		for _, e := range flattenErrors(err) {
+			fmt.Fprintf(stderr, "error: %v\n", e)
+		}
+		return 1
+	}
+
+	fmt.Fprintln(stdout, "configuration is valid")
+	return 0
+}
+
+func runConfigShow(args []string, stdout, stderr io.Writer) int {
+	cfg, code := loadConfigFlags("show", args, stderr)
+	if code != 0 {
+		return code
+	}
+
+	if cfg.File.Path != "" {
+		fmt.Fprintf(stdout, "# configuration file: %s\n", cfg.File.Path)
+	}
+
+	enc := yaml.NewEncoder(stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(config.Settings(cfg)); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// loadConfigFlags parses the flags common to the config subcommands, then
+// loads the configuration. A non-zero exit code is returned on failure.
+func loadConfigFlags(name string, args []string, stderr io.Writer) (config.Config, int) {
+	flags := flag.NewFlagSet("config "+name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: chinmina-bridge config %s [flags]\n", name)
+		fmt.Fprintln(stderr, "\nLoads the configuration from the environment and the configuration file.")
+		flags.PrintDefaults()
+	}
+
+	file := flags.String("file", os.Getenv("CONFIG_FILE"), "the configuration file (defaults to $CONFIG_FILE)")
+
+	if err := flags.Parse(args); err != nil {
+		return config.Config{}, 2
+	}
+
+	cfg, err := config.LoadFile(context.Background(), *file)
+	if err != nil {
+		fmt.Fprintf(stderr, "error: configuration load failed: %v\n", err)
+		return config.Config{}, 1
+	}
+
+	return cfg, 0
+}
+
+// validateConfig checks the configuration as far as possible without starting
+// the server or contacting any external service. All problems found are
+// returned.
+func validateConfig(cfg config.Config) error {
+	return errors.Join(
+		validateServerConfig(cfg.Server),
+		jwt.ValidateConfig(cfg.Authorization),
+		validateSecretReference("BUILDKITE_API_TOKEN", cfg.Buildkite.Token),
+		validateGithubConfig(cfg.Github),
+		validateVaultConfig(cfg),
+		logging.Validate(cfg.Log),
+		observe.Validate(cfg.Observe),
+		audit.Validate(cfg.Audit),
+	)
+}
+
+// validateGithubConfig checks the signing key. A private key that refers to a
+// secret is only checked to be a valid reference, as resolving it could
+// require access to a secret manager.
+func validateGithubConfig(cfg config.GithubConfig) error {
+	pinErr := validateSecretReference("GITHUB_APP_PKCS11_PIN", cfg.PKCS11PIN)
+
+	var secondaryErr error
+	if github.UsesSecondaryPrivateKey(cfg) && secret.IsReference(cfg.SecondaryPrivateKey) {
+		secondaryErr = validateSecretReference("GITHUB_APP_SECONDARY_PRIVATE_KEY", cfg.SecondaryPrivateKey)
+		cfg.SecondaryPrivateKey = ""
+	}
+
+	if github.UsesPrivateKey(cfg) && secret.IsReference(cfg.PrivateKey) {
+		return errors.Join(validateSecretReference("GITHUB_APP_PRIVATE_KEY", cfg.PrivateKey), github.ValidateSecondaryKey(cfg), secondaryErr, pinErr)
+	}
+
+	return errors.Join(github.ValidateConfig(cfg), secondaryErr, pinErr)
+}
+
+// validateVaultConfig checks the Vault configuration when a Vault Transit key
+// or a Vault secret reference is configured.
+func validateVaultConfig(cfg config.Config) error {
+	usesVault := github.UsesVaultTransit(cfg.Github) ||
+		strings.HasPrefix(cfg.Buildkite.Token, "vault://") ||
+		(github.UsesPrivateKey(cfg.Github) && strings.HasPrefix(cfg.Github.PrivateKey, "vault://")) ||
+		(github.UsesSecondaryPrivateKey(cfg.Github) && strings.HasPrefix(cfg.Github.SecondaryPrivateKey, "vault://"))
+	if !usesVault {
+		return nil
+	}
+
+	if err := vault.ValidateConfig(cfg.Vault); err != nil {
+		return fmt.Errorf("invalid Vault configuration: %w", err)
+	}
+
+	return nil
+}
+
+func validateSecretReference(name, value string) error {
+	if !secret.IsReference(value) {
+		return nil
+	}
+
+	if err := secret.ValidateReference(value); err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func validateServerConfig(cfg config.ServerConfig) error {
+	var errs []error
+
+	if cfg.TCPEnabled && (cfg.Port < 1 || cfg.Port > 65535) {
+		errs = append(errs, fmt.Errorf("invalid SERVER_PORT %d", cfg.Port))
+	}
+
+	if cfg.UnixSocket != "" {
+		if _, err := parseSocketMode(cfg.UnixSocketMode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// sockets passed by systemd are only known when the server is started by
+	// systemd
+	if !cfg.TCPEnabled && cfg.UnixSocket == "" && os.Getenv("LISTEN_FDS") == "" {
+		errs = append(errs, errors.New("no listeners configured: enable the TCP port, a Unix socket or systemd socket activation"))
+	}
+
+	if err := tlsconfig.Validate(cfg); err != nil {
+		errs = append(errs, fmt.Errorf("TLS: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// flattenErrors returns the individual errors that have been joined together,
+// so each can be reported on its own line.
+func flattenErrors(err error) []error {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, flattenErrors(e)...)
+	}
+
+	return errs
+}
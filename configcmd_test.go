@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfigCheck_Valid(t *testing.T) {
+	path := writeConfigFile(t, `
+authorization: {buildkite_organization_slug: org}
+buildkite: {token: "awssm://chinmina#buildkite"}
+github: {application_id: 1, installation_id: 2, private_key_arn: "arn:aws:kms:us-east-1:123456789012:alias/github-app"}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "configuration is valid\n", stdout.String())
+}
+
+func TestRunConfigCheck_ReportsAllProblems(t *testing.T) {
+	path := writeConfigFile(t, `
+authorization: {buildkite_organization_slug: org, issuer_url: agent.buildkite.com}
+buildkite: {token: "file://run/secrets/token"}
+github: {application_id: 1, installation_id: 2, private_key: not-a-key}
+server: {tcp_enabled: false}
+log: {level: loud}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout.String())
+	assert.Contains(t, stderr.String(), "error: no listeners configured")
+	assert.Contains(t, stderr.String(), `error: invalid JWT_ISSUER_URL: "agent.buildkite.com" is not an absolute http or https URL`)
+	assert.Contains(t, stderr.String(), `error: invalid BUILDKITE_API_TOKEN: secret reference "file://run/secrets/token" must be an absolute path`)
+	assert.Contains(t, stderr.String(), "error: invalid GITHUB_APP_PRIVATE_KEY: could not parse private key")
+	assert.Contains(t, stderr.String(), `error: unknown log level "loud"`)
+}
+
+func TestRunConfigCheck_VaultTransitKey(t *testing.T) {
+	path := writeConfigFile(t, `
+authorization: {buildkite_organization_slug: org}
+buildkite: {token: bkua_secret}
+github: {application_id: 1, installation_id: 2, private_key_vault_transit_key: github-app}
+vault: {address: "https://vault:8200", auth_method: approle, approle_role_id: role}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "error: invalid Vault configuration: VAULT_APPROLE_ROLE_ID and VAULT_APPROLE_SECRET_ID must be configured for AppRole authentication\n", stderr.String())
+}
+
+func TestRunConfigCheck_SecondaryKey(t *testing.T) {
+	path := writeConfigFile(t, `
+authorization: {buildkite_organization_slug: org}
+buildkite: {token: bkua_secret}
+github: {application_id: 1, installation_id: 2, private_key: "file:///run/secrets/primary.pem", secondary_private_key: "file://run/secrets/secondary.pem"}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), `error: invalid GITHUB_APP_SECONDARY_PRIVATE_KEY: secret reference "file://run/secrets/secondary.pem" must be an absolute path`)
+	assert.NotContains(t, stderr.String(), "GITHUB_APP_PRIVATE_KEY:")
+}
+
+func TestRunConfigCheck_LoadFailure(t *testing.T) {
+	path := writeConfigFile(t, `profiles: {}`)
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"check", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), `error: configuration load failed: invalid configuration file`)
+	assert.Contains(t, stderr.String(), `unknown setting "profiles"`)
+}
+
+func TestRunConfigShow_RedactsSecrets(t *testing.T) {
+	path := writeConfigFile(t, `
+authorization: {buildkite_organization_slug: org}
+buildkite: {token: bkua_secret}
+github: {application_id: 1, installation_id: 2}
+`)
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"show", "-file", path}, &stdout, &stderr)
+
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "# configuration file: "+path)
+	assert.Contains(t, stdout.String(), "token: '[REDACTED]'")
+	assert.Contains(t, stdout.String(), "buildkite_organization_slug: org")
+	assert.NotContains(t, stdout.String(), "bkua_secret")
+}
+
+func TestRunConfig_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 2, runConfig(nil, &stdout, &stderr))
+	assert.Equal(t, 2, runConfig([]string{"lint"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "usage: chinmina-bridge config check|show")
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	for _, name := range []string{"JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_INSTALLATION_ID", "GITHUB_APP_PRIVATE_KEY", "GITHUB_APP_PRIVATE_KEY_ARN"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
@@ -7,9 +7,10 @@ import (
 	"strings"
 
 	"github.com/jamestelfer/chinmina-bridge/internal/credentialhandler"
+	"github.com/jamestelfer/chinmina-bridge/internal/health"
 	"github.com/jamestelfer/chinmina-bridge/internal/jwt"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
 	"github.com/jamestelfer/chinmina-bridge/internal/vendor"
-	"github.com/rs/zerolog/log"
 )
 
 func handlePostToken(tokenVendor vendor.PipelineTokenVendor) http.Handler {
@@ -21,7 +22,7 @@ func handlePostToken(tokenVendor vendor.PipelineTokenVendor) http.Handler {
 
 		tokenResponse, err := tokenVendor(r.Context(), claims, "")
 		if err != nil {
-			log.Info().Msgf("token creation failed %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("token creation failed %v\n", err)
 			requestError(w, http.StatusInternalServerError)
 			return
 		}
@@ -39,7 +40,7 @@ func handlePostToken(tokenVendor vendor.PipelineTokenVendor) http.Handler {
 		if err != nil {
 			// record failure to log: trying to respond to the client at this
 			// point will likely fail
-			log.Info().Msgf("failed to write response: %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("failed to write response: %v\n", err)
 			return
 		}
 	})
@@ -54,21 +55,21 @@ func handlePostGitCredentials(tokenVendor vendor.PipelineTokenVendor) http.Handl
 
 		requestedRepo, err := credentialhandler.ReadProperties(r.Body)
 		if err != nil {
-			log.Info().Msgf("read repository properties from client failed %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("read repository properties from client failed %v\n", err)
 			requestError(w, http.StatusInternalServerError)
 			return
 		}
 
 		requestedRepoURL, err := credentialhandler.ConstructRepositoryURL(requestedRepo)
 		if err != nil {
-			log.Info().Msgf("invalid request parameters %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("invalid request parameters %v\n", err)
 			requestError(w, http.StatusBadRequest)
 			return
 		}
 
 		tokenResponse, err := tokenVendor(r.Context(), claims, requestedRepoURL)
 		if err != nil {
-			log.Info().Msgf("token creation failed %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("token creation failed %v\n", err)
 			requestError(w, http.StatusInternalServerError)
 			return
 		}
@@ -89,7 +90,7 @@ func handlePostGitCredentials(tokenVendor vendor.PipelineTokenVendor) http.Handl
 		// write the reponse to the client in git credentials property format
 		tokenURL, err := tokenResponse.URL()
 		if err != nil {
-			log.Info().Msgf("invalid repo URL: %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("invalid repo URL: %v\n", err)
 			requestError(w, http.StatusInternalServerError)
 			return
 		}
@@ -104,7 +105,7 @@ func handlePostGitCredentials(tokenVendor vendor.PipelineTokenVendor) http.Handl
 
 		err = credentialhandler.WriteProperties(props, w)
 		if err != nil {
-			log.Info().Msgf("failed to write response: %v\n", err)
+			logging.Ctx(r.Context(), "http").Info().Msgf("failed to write response: %v\n", err)
 			requestError(w, http.StatusInternalServerError)
 			return
 		}
@@ -121,6 +122,35 @@ func handleHealthCheck() http.Handler {
 	})
 }
 
+// handleReadyCheck reports whether the service is able to process requests,
+// including the status of each of its dependencies. The response is JSON, and
+// the status is 503 if any dependency is unavailable. The endpoint is not
+// authenticated, so the errors of failed checks are logged rather than
+// returned.
+func handleReadyCheck(checker *health.Checker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer drainRequestBody(r)
+
+		report := checker.Report(r.Context())
+
+		marshalledResponse, err := json.Marshal(report.Public())
+		if err != nil {
+			requestError(w, http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if !report.Ready() {
+			logging.Ctx(r.Context(), "http").Info().Interface("checks", report.Checks).Msg("readiness check failed")
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(marshalledResponse)
+	})
+}
+
 func maxRequestSize(limit int64) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.MaxBytesHandler(next, limit)
@@ -13,6 +13,7 @@ import (
 
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/jamestelfer/chinmina-bridge/internal/credentialhandler"
+	"github.com/jamestelfer/chinmina-bridge/internal/health"
 	"github.com/jamestelfer/chinmina-bridge/internal/jwt"
 	"github.com/jamestelfer/chinmina-bridge/internal/vendor"
 	"github.com/stretchr/testify/assert"
@@ -270,6 +271,59 @@ func TestHandleHealthCheck_Success(t *testing.T) {
 	assert.Equal(t, "OK", respBody)
 }
 
+func TestHandleReadyCheck_Ready(t *testing.T) {
+	checker := health.NewChecker(time.Minute)
+	checker.Add("dependency", func(context.Context) error { return nil })
+
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// act
+	handler := handleReadyCheck(checker)
+	handler.ServeHTTP(rr, req)
+
+	// assert
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	report := health.Report{}
+	err = json.Unmarshal(rr.Body.Bytes(), &report)
+	require.NoError(t, err)
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["dependency"].Status)
+}
+
+func TestHandleReadyCheck_NotReady(t *testing.T) {
+	checker := health.NewChecker(time.Minute)
+	checker.Add("ready", func(context.Context) error { return nil })
+	checker.Add("notReady", func(context.Context) error { return errors.New("keys not loaded") })
+
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	require.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	// act
+	handler := handleReadyCheck(checker)
+	handler.ServeHTTP(rr, req)
+
+	// assert
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	report := health.Report{}
+	err = json.Unmarshal(rr.Body.Bytes(), &report)
+	require.NoError(t, err)
+	assert.Equal(t, health.StatusError, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["ready"].Status)
+	assert.Equal(t, health.StatusError, report.Checks["notReady"].Status)
+
+	// the error may describe upstream services, so it is only logged
+	assert.NotContains(t, rr.Body.String(), "keys not loaded")
+	assert.NotEmpty(t, report.Checks["notReady"].Error)
+}
+
 func tv(token string) vendor.PipelineTokenVendor {
 	return vendor.PipelineTokenVendor(func(_ context.Context, claims jwt.BuildkiteClaims, repoUrl string) (*vendor.PipelineRepositoryToken, error) {
 		return &vendor.PipelineRepositoryToken{
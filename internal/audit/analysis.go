@@ -0,0 +1,358 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is an audit entry read back from the audit log. Its field names match
+// those written by Entry.MarshalZerologObject, so that tools reading the log do
+// not need to track changes to the log format.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Method           string    `json:"method"`
+	Path             string    `json:"path"`
+	Status           int       `json:"status"`
+	Authorized       bool      `json:"authorized"`
+	Error            string    `json:"error,omitempty"`
+	OrganizationSlug string    `json:"organizationSlug,omitempty"`
+	PipelineSlug     string    `json:"pipelineSlug,omitempty"`
+	BuildNumber      int       `json:"buildNumber,omitempty"`
+	JobID            string    `json:"jobID,omitempty"`
+	Repositories     []string  `json:"repositories,omitempty"`
+	CacheStatus      string    `json:"cacheStatus,omitempty"`
+	RequestID        string    `json:"requestID,omitempty"`
+}
+
+// Vended returns true if the request resulted in a token.
+func (r Record) Vended() bool {
+	return r.Status < 300 && len(r.Repositories) > 0
+}
+
+// Denied returns true if the request was refused because the caller could not
+// be authenticated or was not authorized.
+func (r Record) Denied() bool {
+	return r.Status == http.StatusUnauthorized || r.Status == http.StatusForbidden
+}
+
+// Failed returns true if the request could not be completed because of an
+// error in the service or one of its dependencies, such as Buildkite or GitHub.
+func (r Record) Failed() bool {
+	return r.Status >= 500
+}
+
+// ReadRecords reads the audit entries from a log of JSON lines. Lines that are
+// not audit entries (including checkpoints) are ignored.
+func ReadRecords(r io.Reader, fn func(Record) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	for scanner.Scan() {
+		record, ok := parseRecord(scanner.Bytes())
+		if !ok {
+			continue
+		}
+
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func parseRecord(line []byte) (Record, bool) {
+	var raw struct {
+		Record
+		Type       string          `json:"type"`
+		Message    string          `json:"message"`
+		RecordedAt time.Time       `json:"recordedAt"`
+		Checkpoint json.RawMessage `json:"checkpoint"`
+	}
+
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return Record{}, false
+	}
+
+	if raw.Type != "audit" || raw.Checkpoint != nil {
+		return Record{}, false
+	}
+
+	record := raw.Record
+
+	// the chain time is the time the entry was written, and is preferred as it
+	// is protected by the entry hash
+	if !raw.RecordedAt.IsZero() {
+		record.Time = raw.RecordedAt
+	}
+
+	return record, true
+}
+
+// Filter selects audit records. Zero values match all records.
+type Filter struct {
+	Pipeline   string
+	Repository string
+	Status     int
+	Since      time.Time
+	Until      time.Time
+}
+
+// Match returns true if the record satisfies every condition of the filter.
+// Repositories match either the full URL or the "owner/repo" suffix.
+func (f Filter) Match(r Record) bool {
+	if f.Pipeline != "" && r.PipelineSlug != f.Pipeline {
+		return false
+	}
+
+	if f.Status != 0 && r.Status != f.Status {
+		return false
+	}
+
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+
+	if f.Repository != "" && !matchesRepository(r.Repositories, f.Repository) {
+		return false
+	}
+
+	return true
+}
+
+func matchesRepository(repositories []string, want string) bool {
+	for _, repo := range repositories {
+		trimmed := strings.TrimSuffix(repo, ".git")
+		if repo == want || strings.HasSuffix(trimmed, "/"+strings.TrimSuffix(want, ".git")) {
+			return true
+		}
+	}
+	return false
+}
+
+// VolumeOptions control the detection of unusual request volume.
+type VolumeOptions struct {
+	// Factor is the multiple of a pipeline's usual hourly volume that is
+	// considered unusual.
+	Factor float64
+
+	// MinRequests is the minimum hourly volume that can be considered unusual,
+	// avoiding noise from pipelines with very few requests.
+	MinRequests int
+}
+
+// PipelineTokens summarises the tokens vended to a pipeline.
+type PipelineTokens struct {
+	Pipeline    string `json:"pipeline"`
+	Requests    int    `json:"requests"`
+	Tokens      int    `json:"tokens"`
+	CacheHits   int    `json:"cacheHits"`
+	Denials     int    `json:"denials"`
+	Errors      int    `json:"errors"`
+	LastRequest string `json:"lastRequest"`
+}
+
+// DenialReason counts the denied requests with the same reason.
+type DenialReason struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+// VolumeAnomaly is an hour in which a pipeline made unusually many requests.
+type VolumeAnomaly struct {
+	Pipeline string    `json:"pipeline"`
+	Hour     time.Time `json:"hour"`
+	Requests int       `json:"requests"`
+	Baseline float64   `json:"baseline"`
+}
+
+// Summary describes a set of audit records.
+type Summary struct {
+	Records   int              `json:"records"`
+	Tokens    int              `json:"tokens"`
+	Denials   int              `json:"denials"`
+	Errors    int              `json:"errors"`
+	From      *time.Time       `json:"from,omitempty"`
+	To        *time.Time       `json:"to,omitempty"`
+	Pipelines []PipelineTokens `json:"pipelines"`
+	Reasons   []DenialReason   `json:"denialReasons"`
+	Anomalies []VolumeAnomaly  `json:"volumeAnomalies"`
+}
+
+// Summarizer accumulates audit records into a Summary.
+type Summarizer struct {
+	volume VolumeOptions
+
+	summary   Summary
+	pipelines map[string]*PipelineTokens
+	last      map[string]time.Time
+	reasons   map[string]int
+	hourly    map[string]map[time.Time]int
+}
+
+func NewSummarizer(volume VolumeOptions) *Summarizer {
+	return &Summarizer{
+		volume:    volume,
+		pipelines: map[string]*PipelineTokens{},
+		last:      map[string]time.Time{},
+		reasons:   map[string]int{},
+		hourly:    map[string]map[time.Time]int{},
+	}
+}
+
+// Add includes the record in the summary.
+func (s *Summarizer) Add(r Record) {
+	s.summary.Records++
+
+	if !r.Time.IsZero() {
+		if s.summary.From == nil || r.Time.Before(*s.summary.From) {
+			t := r.Time
+			s.summary.From = &t
+		}
+		if s.summary.To == nil || r.Time.After(*s.summary.To) {
+			t := r.Time
+			s.summary.To = &t
+		}
+	}
+
+	pipeline := r.PipelineSlug
+	if pipeline == "" {
+		pipeline = "(unknown)"
+	}
+
+	p, ok := s.pipelines[pipeline]
+	if !ok {
+		p = &PipelineTokens{Pipeline: pipeline}
+		s.pipelines[pipeline] = p
+	}
+	p.Requests++
+
+	if r.Time.After(s.last[pipeline]) {
+		s.last[pipeline] = r.Time
+	}
+
+	if r.Vended() {
+		s.summary.Tokens++
+		p.Tokens++
+		if r.CacheStatus == "hit" {
+			p.CacheHits++
+		}
+	}
+
+	if r.Denied() {
+		s.summary.Denials++
+		p.Denials++
+		s.reasons[denialReason(r)]++
+	}
+
+	if r.Failed() {
+		s.summary.Errors++
+		p.Errors++
+	}
+
+	if !r.Time.IsZero() {
+		hours, ok := s.hourly[pipeline]
+		if !ok {
+			hours = map[time.Time]int{}
+			s.hourly[pipeline] = hours
+		}
+		hours[r.Time.UTC().Truncate(time.Hour)]++
+	}
+}
+
+// Summary returns the summary of the records added so far.
+func (s *Summarizer) Summary() Summary {
+	summary := s.summary
+
+	summary.Pipelines = make([]PipelineTokens, 0, len(s.pipelines))
+	for name, p := range s.pipelines {
+		if last := s.last[name]; !last.IsZero() {
+			p.LastRequest = last.UTC().Format(time.RFC3339)
+		}
+		summary.Pipelines = append(summary.Pipelines, *p)
+	}
+	sort.Slice(summary.Pipelines, func(i, j int) bool {
+		a, b := summary.Pipelines[i], summary.Pipelines[j]
+		if a.Tokens != b.Tokens {
+			return a.Tokens > b.Tokens
+		}
+		return a.Pipeline < b.Pipeline
+	})
+
+	summary.Reasons = make([]DenialReason, 0, len(s.reasons))
+	for reason, count := range s.reasons {
+		summary.Reasons = append(summary.Reasons, DenialReason{Reason: reason, Count: count})
+	}
+	sort.Slice(summary.Reasons, func(i, j int) bool {
+		a, b := summary.Reasons[i], summary.Reasons[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Reason < b.Reason
+	})
+
+	summary.Anomalies = s.anomalies()
+
+	return summary
+}
+
+// anomalies finds the hours in which a pipeline's request volume exceeded its
+// usual volume (the mean of its other active hours) by the configured factor.
+func (s *Summarizer) anomalies() []VolumeAnomaly {
+	anomalies := []VolumeAnomaly{}
+
+	for pipeline, hours := range s.hourly {
+		if len(hours) < 2 {
+			// no baseline to compare against
+			continue
+		}
+
+		total := 0
+		for _, count := range hours {
+			total += count
+		}
+
+		for hour, count := range hours {
+			baseline := float64(total-count) / float64(len(hours)-1)
+
+			if count >= s.volume.MinRequests && float64(count) > baseline*s.volume.Factor {
+				anomalies = append(anomalies, VolumeAnomaly{
+					Pipeline: pipeline,
+					Hour:     hour,
+					Requests: count,
+					Baseline: baseline,
+				})
+			}
+		}
+	}
+
+	sort.Slice(anomalies, func(i, j int) bool {
+		a, b := anomalies[i], anomalies[j]
+		if !a.Hour.Equal(b.Hour) {
+			return a.Hour.Before(b.Hour)
+		}
+		return a.Pipeline < b.Pipeline
+	})
+
+	return anomalies
+}
+
+// denialReason describes why a request was denied: the recorded error, or the
+// response status if there is none.
+func denialReason(r Record) string {
+	if r.Error != "" {
+		return r.Error
+	}
+
+	return "status " + strconv.Itoa(r.Status)
+}
@@ -0,0 +1,147 @@
+package audit_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRecords_RoundTrip(t *testing.T) {
+	line, err := audit.JSONFormat(&audit.Entry{
+		Method:       "POST",
+		Path:         "/token",
+		Status:       200,
+		Authorized:   true,
+		PipelineSlug: "pipeline",
+		PipelineID:   "pipeline-id",
+		BuildNumber:  7,
+		JobID:        "job-id",
+		Repositories: []string{"https://github.com/org/repo.git"},
+		CacheStatus:  "hit",
+		RequestID:    "request-id",
+	})
+	require.NoError(t, err)
+
+	input := strings.Join([]string{
+		`{"level":"info","message":"token issued"}`,
+		string(line),
+		`{"type":"audit","message":"audit_checkpoint","checkpoint":{"seq":1}}`,
+		"garbage",
+	}, "\n")
+
+	var records []audit.Record
+	err = audit.ReadRecords(strings.NewReader(input), func(r audit.Record) error {
+		records = append(records, r)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Len(t, records, 1)
+	r := records[0]
+	assert.Equal(t, "/token", r.Path)
+	assert.Equal(t, 200, r.Status)
+	assert.True(t, r.Authorized)
+	assert.Equal(t, "pipeline", r.PipelineSlug)
+	assert.Equal(t, 7, r.BuildNumber)
+	assert.Equal(t, "job-id", r.JobID)
+	assert.Equal(t, []string{"https://github.com/org/repo.git"}, r.Repositories)
+	assert.Equal(t, "hit", r.CacheStatus)
+	assert.Equal(t, "request-id", r.RequestID)
+	assert.False(t, r.Time.IsZero())
+	assert.True(t, r.Vended())
+}
+
+func TestFilter(t *testing.T) {
+	at := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	record := audit.Record{
+		Time:         at,
+		Status:       200,
+		PipelineSlug: "pipeline",
+		Repositories: []string{"https://github.com/org/repo.git"},
+	}
+
+	cases := []struct {
+		name   string
+		filter audit.Filter
+		match  bool
+	}{
+		{"empty", audit.Filter{}, true},
+		{"pipeline", audit.Filter{Pipeline: "pipeline"}, true},
+		{"other pipeline", audit.Filter{Pipeline: "other"}, false},
+		{"repository URL", audit.Filter{Repository: "https://github.com/org/repo.git"}, true},
+		{"repository name", audit.Filter{Repository: "org/repo"}, true},
+		{"other repository", audit.Filter{Repository: "org/other"}, false},
+		{"status", audit.Filter{Status: 200}, true},
+		{"other status", audit.Filter{Status: 403}, false},
+		{"since", audit.Filter{Since: at}, true},
+		{"after", audit.Filter{Since: at.Add(time.Second)}, false},
+		{"until", audit.Filter{Until: at.Add(time.Second)}, true},
+		{"until exclusive", audit.Filter{Until: at}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.match, c.filter.Match(record))
+		})
+	}
+}
+
+func TestSummarizer(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := audit.NewSummarizer(audit.VolumeOptions{Factor: 3, MinRequests: 10})
+
+	// a steady pipeline: 2 requests an hour for 3 hours, then a burst of 30
+	for hour := range 3 {
+		for range 2 {
+			s.Add(vend("busy", start.Add(time.Duration(hour)*time.Hour), "miss"))
+		}
+	}
+	for range 30 {
+		s.Add(vend("busy", start.Add(3*time.Hour), "hit"))
+	}
+
+	s.Add(vend("quiet", start, "miss"))
+	s.Add(audit.Record{Time: start, Status: 403, PipelineSlug: "quiet", Error: "repository mismatch, no token vended"})
+	s.Add(audit.Record{Time: start, Status: 401, Error: "JWT is invalid"})
+	s.Add(audit.Record{Time: start, Status: 401, Error: "JWT is invalid"})
+	s.Add(audit.Record{Time: start, Status: 502, PipelineSlug: "quiet", Error: "GitHub API request failed"})
+
+	summary := s.Summary()
+
+	assert.Equal(t, 41, summary.Records)
+	assert.Equal(t, 37, summary.Tokens)
+	assert.Equal(t, 3, summary.Denials)
+	assert.Equal(t, 1, summary.Errors)
+	assert.Equal(t, start, *summary.From)
+	assert.Equal(t, start.Add(3*time.Hour), *summary.To)
+
+	require.Len(t, summary.Pipelines, 3)
+	assert.Equal(t, audit.PipelineTokens{Pipeline: "busy", Requests: 36, Tokens: 36, CacheHits: 30, LastRequest: "2026-01-01T03:00:00Z"}, summary.Pipelines[0])
+	assert.Equal(t, audit.PipelineTokens{Pipeline: "quiet", Requests: 3, Tokens: 1, Denials: 1, Errors: 1, LastRequest: "2026-01-01T00:00:00Z"}, summary.Pipelines[1])
+	assert.Equal(t, "(unknown)", summary.Pipelines[2].Pipeline)
+
+	assert.Equal(t, []audit.DenialReason{
+		{Reason: "JWT is invalid", Count: 2},
+		{Reason: "repository mismatch, no token vended", Count: 1},
+	}, summary.Reasons)
+
+	assert.Equal(t, []audit.VolumeAnomaly{
+		{Pipeline: "busy", Hour: start.Add(3 * time.Hour), Requests: 30, Baseline: 2},
+	}, summary.Anomalies)
+}
+
+func vend(pipeline string, at time.Time, cache string) audit.Record {
+	return audit.Record{
+		Time:         at,
+		Status:       200,
+		Authorized:   true,
+		PipelineSlug: pipeline,
+		Repositories: []string{"https://github.com/org/" + pipeline},
+		CacheStatus:  cache,
+	}
+}
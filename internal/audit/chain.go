@@ -0,0 +1,204 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Chain links each audit entry to the one before it, making the audit log
+// tamper-evident. Each entry is given the chain identifier, a sequence number
+// and the hash of the previous entry, and the hash of the entry (including
+// these fields) is then recorded in the entry.
+//
+// Removing, reordering or changing an entry breaks the chain. Periodic signed
+// checkpoints of the chain head prevent the chain being rewritten wholesale.
+//
+// A new chain is started each time the process starts.
+type Chain struct {
+	id  string
+	now func() time.Time
+
+	mu   sync.Mutex
+	seq  uint64
+	head string
+}
+
+// NewChain starts a new chain with a random identifier.
+func NewChain() (*Chain, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("could not create audit chain identifier: %w", err)
+	}
+
+	return &Chain{
+		id:  hex.EncodeToString(id),
+		now: time.Now,
+	}, nil
+}
+
+// ID returns the identifier of the chain.
+func (c *Chain) ID() string {
+	return c.id
+}
+
+// Link assigns the chain fields to the entry and makes it the head of the
+// chain. Entries must be written in the order they are linked.
+func (c *Chain) Link(e *Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e.Chain = c.id
+	e.Sequence = c.seq + 1
+	e.RecordedAt = c.now()
+	e.PrevHash = c.head
+	e.Hash = ""
+
+	hash, err := entryHash(e)
+	if err != nil {
+		return err
+	}
+
+	e.Hash = hash
+	c.seq = e.Sequence
+	c.head = hash
+
+	return nil
+}
+
+// Head returns the sequence number and hash of the most recently linked entry.
+func (c *Chain) Head() (uint64, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.seq, c.head
+}
+
+// envelopeFields are added to audit records by the logger rather than the
+// entry, and are not covered by the entry hash.
+var envelopeFields = []string{
+	zerolog.LevelFieldName,
+	zerolog.TimestampFieldName,
+	zerolog.MessageFieldName,
+	"type",
+	"hash",
+}
+
+// entryHash calculates the hash of the entry fields, excluding the hash itself.
+func entryHash(e *Entry) (string, error) {
+	var buf bytes.Buffer
+
+	logger := zerolog.New(&buf)
+	logger.Log().EmbedObject(e).Send()
+
+	fields, err := decodeRecord(buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	return recordHash(fields)
+}
+
+// recordHash calculates the hash of an audit record from its decoded fields.
+// Envelope fields are ignored. The fields are encoded canonically (with sorted
+// keys and numbers in their original form) so the hash of a record can be
+// recalculated from its written form.
+func recordHash(fields map[string]any) (string, error) {
+	covered := make(map[string]any, len(fields))
+	for k, v := range fields {
+		covered[k] = v
+	}
+	for _, k := range envelopeFields {
+		delete(covered, k)
+	}
+
+	canonical, err := json.Marshal(covered)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(canonical)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// decodeRecord decodes a JSON audit record, retaining numbers as written.
+func decodeRecord(record []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(record))
+	dec.UseNumber()
+
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// checkpointer periodically writes a checkpoint entry recording the head of the
+// chain, signed if a signer is configured.
+type checkpointer struct {
+	chain  *Chain
+	signer CheckpointSigner
+
+	// lastSeq is the sequence number of the last checkpoint written, and is
+	// only accessed by the checkpoint process.
+	lastSeq uint64
+}
+
+// checkpoint writes a checkpoint for the current chain head, unless nothing has
+// been written since the last checkpoint.
+func (c *checkpointer) checkpoint(ctx context.Context) error {
+	seq, hash := c.chain.Head()
+	if seq == 0 || seq == c.lastSeq {
+		return nil
+	}
+
+	cp := &Checkpoint{
+		Sequence: seq,
+		Hash:     hash,
+	}
+
+	if c.signer != nil {
+		sig, err := c.signer.Sign(ctx, checkpointDigest(c.chain.ID(), seq, hash))
+		if err != nil {
+			return fmt.Errorf("audit checkpoint signing failed: %w", err)
+		}
+
+		cp.KeyID = c.signer.KeyID()
+		cp.Algorithm = checkpointAlgorithm
+		cp.Signature = sig
+	}
+
+	e := &Entry{Checkpoint: cp}
+	write(ctx, e)
+
+	c.lastSeq = e.Sequence
+
+	return nil
+}
+
+func (c *checkpointer) run(ctx context.Context, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.checkpoint(ctx); err != nil {
+				log.Error().Err(err).Msg("audit: checkpoint failed")
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package audit
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog"
+)
+
+// checkpointAlgorithm is the signature algorithm used for checkpoints:
+// RSASSA-PKCS1-v1_5 with SHA-256.
+const checkpointAlgorithm = "RS256"
+
+// Checkpoint records the head of an audit chain at a point in time. When
+// signed, it proves that the chain up to that point was written by the holder
+// of the signing key.
+type Checkpoint struct {
+	Sequence  uint64
+	Hash      string
+	KeyID     string
+	Algorithm string
+	Signature []byte
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (c *Checkpoint) MarshalZerologObject(event *zerolog.Event) {
+	event.Uint64("seq", c.Sequence).
+		Str("hash", c.Hash)
+
+	if len(c.Signature) > 0 {
+		event.Str("keyId", c.KeyID).
+			Str("alg", c.Algorithm).
+			Str("signature", base64.StdEncoding.EncodeToString(c.Signature))
+	}
+}
+
+// checkpointDigest is the SHA-256 digest that is signed for a checkpoint.
+func checkpointDigest(chain string, seq uint64, hash string) []byte {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%d:%s", chain, seq, hash)))
+	return sum[:]
+}
+
+// VerifyCheckpointSignature checks the signature of the checkpoint of the given
+// chain with the public key.
+func VerifyCheckpointSignature(key *rsa.PublicKey, chain string, c *Checkpoint) error {
+	if c.Algorithm != checkpointAlgorithm {
+		return fmt.Errorf("unsupported checkpoint signature algorithm %q", c.Algorithm)
+	}
+
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, checkpointDigest(chain, c.Sequence, c.Hash), c.Signature)
+}
+
+// CheckpointSigner signs the SHA-256 digest of a checkpoint.
+type CheckpointSigner interface {
+	// KeyID identifies the key, so that the verifier can choose the matching
+	// public key.
+	KeyID() string
+	Sign(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// NewCheckpointSigner creates the signer configured for checkpoints, if any: a
+// local RSA private key file, or an AWS KMS key.
+func NewCheckpointSigner(ctx context.Context, cfg config.AuditConfig) (CheckpointSigner, error) {
+	if cfg.CheckpointKeyARN != "" {
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return KMSCheckpointSigner{
+			client: kms.NewFromConfig(awsCfg),
+			arn:    cfg.CheckpointKeyARN,
+		}, nil
+	}
+
+	if cfg.CheckpointKeyFile != "" {
+		content, err := os.ReadFile(cfg.CheckpointKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read checkpoint key: %w", err)
+		}
+
+		return NewRSACheckpointSigner(content)
+	}
+
+	return nil, nil
+}
+
+// RSACheckpointSigner signs checkpoints with a local RSA private key.
+type RSACheckpointSigner struct {
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+// NewRSACheckpointSigner creates a signer from a PEM encoded RSA private key, in
+// either PKCS #1 or PKCS #8 form.
+func NewRSACheckpointSigner(keyPEM []byte) (RSACheckpointSigner, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return RSACheckpointSigner{}, errors.New("checkpoint key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return RSACheckpointSigner{}, errors.New("checkpoint key must be an RSA key")
+		}
+		key = rsaKey
+	} else {
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return RSACheckpointSigner{}, fmt.Errorf("could not parse checkpoint key: %w", err)
+		}
+	}
+
+	keyID, err := PublicKeyID(&key.PublicKey)
+	if err != nil {
+		return RSACheckpointSigner{}, err
+	}
+
+	return RSACheckpointSigner{key: key, keyID: keyID}, nil
+}
+
+func (s RSACheckpointSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s RSACheckpointSigner) Sign(_ context.Context, digest []byte) ([]byte, error) {
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest)
+}
+
+// PublicKeyID identifies a public key by the SHA-256 hash of its DER encoding.
+func PublicKeyID(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// KMSClient defines the AWS API surface required by the KMSCheckpointSigner.
+type KMSClient interface {
+	Sign(ctx context.Context, in *kms.SignInput, optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// KMSCheckpointSigner signs checkpoints with an asymmetric RSA key held in AWS
+// KMS, so the signing key is never exposed to the application.
+type KMSCheckpointSigner struct {
+	client KMSClient
+	arn    string
+}
+
+func NewKMSCheckpointSigner(client KMSClient, arn string) KMSCheckpointSigner {
+	return KMSCheckpointSigner{client: client, arn: arn}
+}
+
+func (s KMSCheckpointSigner) KeyID() string {
+	return s.arn
+}
+
+func (s KMSCheckpointSigner) Sign(ctx context.Context, digest []byte) ([]byte, error) {
+	result, err := s.client.Sign(ctx, &kms.SignInput{
+		KeyId:            aws.String(s.arn),
+		SigningAlgorithm: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+		MessageType:      types.MessageTypeDigest,
+		Message:          digest,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("KMS signing failed: %w", err)
+	}
+
+	return result.Signature, nil
+}
@@ -0,0 +1,191 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+)
+
+// FileSink writes audit entries as JSON lines to a local file. The file is
+// rotated when it exceeds the configured size or age, and a limited number of
+// rotated files are retained.
+type FileSink struct {
+	path           string
+	maxSize        int64
+	rotateInterval time.Duration
+	maxBackups     int
+	format         Format
+
+	// now is replaceable for testing
+	now func() time.Time
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// NewFileSink opens (or creates) the configured audit file for appending.
+func NewFileSink(cfg config.AuditFileConfig, format Format) (*FileSink, error) {
+	if err := validateFileConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	s := &FileSink{
+		path:           cfg.Path,
+		maxSize:        int64(cfg.MaxSizeMB) * 1024 * 1024,
+		rotateInterval: time.Duration(cfg.RotateIntervalHours) * time.Hour,
+		maxBackups:     cfg.MaxBackups,
+		format:         format,
+		now:            time.Now,
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func validateFileConfig(cfg config.AuditFileConfig) error {
+	if cfg.Path == "" {
+		return errors.New("file path is required")
+	}
+
+	return nil
+}
+
+func (s *FileSink) Name() string {
+	return "file"
+}
+
+func (s *FileSink) Record(_ context.Context, e *Entry) error {
+	record, err := s.format(e)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+	record = append(record, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return errors.New("audit file is closed")
+	}
+
+	if s.shouldRotate(int64(len(record))) {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(record)
+	s.size += int64(n)
+
+	return err
+}
+
+func (s *FileSink) Close(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+// shouldRotate returns true if writing a record of the given size would exceed
+// the size limit, or the file has been open longer than the rotation interval.
+// An empty file is never rotated.
+func (s *FileSink) shouldRotate(recordSize int64) bool {
+	if s.size == 0 {
+		return false
+	}
+
+	if s.maxSize > 0 && s.size+recordSize > s.maxSize {
+		return true
+	}
+
+	return s.rotateInterval > 0 && s.now().Sub(s.openedAt) >= s.rotateInterval
+}
+
+// open opens the audit file for appending, recording its current size.
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open audit file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not read audit file size: %w", err)
+	}
+
+	s.file = f
+	s.size = info.Size()
+	s.openedAt = s.now()
+
+	return nil
+}
+
+// rotate renames the current file with a timestamp suffix, opens a new file and
+// removes rotated files beyond the retention limit.
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("could not close audit file for rotation: %w", err)
+	}
+	s.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", s.path, s.now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(s.path, rotated); err != nil {
+		return fmt.Errorf("could not rotate audit file: %w", err)
+	}
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	return s.prune()
+}
+
+// prune removes the oldest rotated files so that no more than the configured
+// number are retained.
+func (s *FileSink) prune() error {
+	if s.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(s.path + ".*")
+	if err != nil {
+		return err
+	}
+
+	// the timestamp suffix sorts chronologically
+	sort.Strings(backups)
+
+	var errs error
+	for len(backups) > s.maxBackups {
+		errs = errors.Join(errs, os.Remove(backups[0]))
+		backups = backups[1:]
+	}
+
+	return errs
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink_WritesJSONLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	s, err := NewFileSink(config.AuditFileConfig{Path: path, MaxSizeMB: 1}, JSONFormat)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Record(context.Background(), &Entry{Path: "/token", Status: 200}))
+	require.NoError(t, s.Record(context.Background(), &Entry{Path: "/git-credentials", Status: 403}))
+	require.NoError(t, s.Close(context.Background()))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"path":"/token"`)
+	assert.Contains(t, lines[0], `"type":"audit"`)
+	assert.Contains(t, lines[1], `"status":403`)
+}
+
+func TestFileSink_RotatesOnSize(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+
+	s := newTestFileSink(t, path, 2)
+	// a tiny limit forces rotation before each write after the first
+	s.maxSize = 10
+
+	for range 5 {
+		require.NoError(t, s.Record(context.Background(), &Entry{Path: "/token"}))
+	}
+	require.NoError(t, s.Close(context.Background()))
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	assert.Len(t, backups, 2, "only the configured number of backups is retained")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "\n"))
+}
+
+func TestFileSink_RotatesOnAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	s := newTestFileSink(t, path, 5)
+	s.rotateInterval = time.Hour
+
+	require.NoError(t, s.Record(context.Background(), &Entry{Path: "/token"}))
+
+	// not yet due
+	s.now = func() time.Time { return s.openedAt.Add(30 * time.Minute) }
+	require.NoError(t, s.Record(context.Background(), &Entry{Path: "/token"}))
+
+	s.now = func() time.Time { return s.openedAt.Add(time.Hour) }
+	require.NoError(t, s.Record(context.Background(), &Entry{Path: "/token"}))
+	require.NoError(t, s.Close(context.Background()))
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+
+	rotated, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(rotated), "\n"))
+}
+
+func TestFileSink_RequiresPath(t *testing.T) {
+	_, err := NewFileSink(config.AuditFileConfig{}, JSONFormat)
+	assert.ErrorContains(t, err, "file path is required")
+}
+
+func newTestFileSink(t *testing.T, path string, maxBackups int) *FileSink {
+	t.Helper()
+
+	s, err := NewFileSink(config.AuditFileConfig{Path: path, MaxBackups: maxBackups}, JSONFormat)
+	require.NoError(t, err)
+
+	return s
+}
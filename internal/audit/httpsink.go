@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// httpSinkTimeout bounds each request to the endpoint.
+const httpSinkTimeout = 10 * time.Second
+
+// HTTPSink ships audit entries in batches to an HTTP endpoint as newline
+// delimited JSON. Entries are buffered on disk until they have been accepted by
+// the endpoint, so entries are not lost if the endpoint is unavailable or the
+// process restarts. Delivery is at least once: a batch is sent again if its
+// acknowledgement is lost.
+type HTTPSink struct {
+	url           string
+	authorization string
+	format        Format
+	client        *http.Client
+	spool         *spool
+}
+
+var _ Sink = (*HTTPSink)(nil)
+
+func validateHTTPConfig(cfg config.AuditHTTPConfig) error {
+	if cfg.URL == "" {
+		return errors.New("HTTP URL is required")
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("invalid HTTP URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid HTTP URL %q: expected an absolute http or https URL", cfg.URL)
+	}
+
+	if cfg.BufferDir == "" {
+		return errors.New("HTTP buffer directory is required")
+	}
+
+	return nil
+}
+
+// NewHTTPSink creates the buffer directory if necessary, recovers any entries
+// buffered by a previous process and starts shipping in the background.
+func NewHTTPSink(cfg config.AuditHTTPConfig, format Format) (*HTTPSink, error) {
+	if err := validateHTTPConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	batches, err := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/audit").Int64Counter(
+		"audit.sink.http.batches",
+		metric.WithDescription("The number of attempts to ship a batch of audit entries, by outcome"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &HTTPSink{
+		url:           cfg.URL,
+		authorization: cfg.AuthorizationHeader,
+		format:        format,
+		client:        &http.Client{Timeout: httpSinkTimeout},
+	}
+
+	s.spool, err = newSpool(spoolConfig{
+		name:          "http",
+		dir:           cfg.BufferDir,
+		batchSize:     cfg.BatchSize,
+		flushInterval: time.Duration(cfg.FlushIntervalSeconds) * time.Second,
+		maxRetries:    cfg.MaxRetries,
+		deliver:       s.post,
+		batches:       batches,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+// Record appends the entry to the on-disk buffer. The entry is shipped
+// asynchronously.
+func (s *HTTPSink) Record(_ context.Context, e *Entry) error {
+	record, err := s.format(e)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+	record = append(record, '\n')
+
+	return s.spool.append(record)
+}
+
+// Close stops background shipping, then makes a final attempt to ship the
+// buffered entries within the deadline of the context. Entries that cannot be
+// shipped remain buffered for the next process.
+func (s *HTTPSink) Close(ctx context.Context) error {
+	return s.spool.close(ctx)
+}
+
+func (s *HTTPSink) post(ctx context.Context, content []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if s.authorization != "" {
+		req.Header.Set("Authorization", s.authorization)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("audit batch delivery failed: %w", err)
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("audit batch delivery failed: endpoint returned %s", res.Status)
+	}
+
+	return nil
+}
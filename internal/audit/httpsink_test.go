@@ -0,0 +1,157 @@
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSink_ShipsBatches(t *testing.T) {
+	receiver := &batchReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cfg := httpSinkConfig(t, server.URL)
+	cfg.BatchSize = 2
+
+	s, err := audit.NewHTTPSink(cfg, audit.JSONFormat)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/token"}))
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/git-credentials"}))
+
+	// reaching the batch size triggers shipping without waiting for the interval
+	assert.Eventually(t, func() bool { return len(receiver.entries()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	require.NoError(t, s.Close(context.Background()))
+
+	entries := receiver.entries()
+	assert.Contains(t, entries[0], `"path":"/token"`)
+	assert.Contains(t, entries[1], `"path":"/git-credentials"`)
+	assert.Equal(t, "Bearer secret", receiver.authorization)
+	assert.Equal(t, "application/x-ndjson", receiver.contentType)
+
+	batches, err := filepath.Glob(filepath.Join(cfg.BufferDir, "batch-*"))
+	require.NoError(t, err)
+	assert.Empty(t, batches, "shipped batches are removed")
+}
+
+func TestHTTPSink_FlushesOnClose(t *testing.T) {
+	receiver := &batchReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	s, err := audit.NewHTTPSink(httpSinkConfig(t, server.URL), audit.JSONFormat)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/token"}))
+	require.NoError(t, s.Close(context.Background()))
+
+	assert.Len(t, receiver.entries(), 1)
+}
+
+func TestHTTPSink_BuffersWhenUnavailable(t *testing.T) {
+	receiver := &batchReceiver{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cfg := httpSinkConfig(t, server.URL)
+
+	s, err := audit.NewHTTPSink(cfg, audit.JSONFormat)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/token"}))
+
+	err = s.Close(context.Background())
+	assert.ErrorContains(t, err, "503 Service Unavailable")
+	// background shipping may also have been attempted
+	assert.GreaterOrEqual(t, receiver.attemptCount(), 1+cfg.MaxRetries)
+
+	// the entry is retained on disk and shipped by the next sink using the
+	// buffer
+	receiver.setStatus(http.StatusOK)
+
+	s, err = audit.NewHTTPSink(cfg, audit.JSONFormat)
+	require.NoError(t, err)
+	require.NoError(t, s.Close(context.Background()))
+
+	entries := receiver.entries()
+	require.Len(t, entries, 1)
+	assert.Contains(t, entries[0], `"path":"/token"`)
+}
+
+func TestHTTPSink_InvalidConfiguration(t *testing.T) {
+	_, err := audit.NewHTTPSink(config.AuditHTTPConfig{BufferDir: t.TempDir()}, audit.JSONFormat)
+	assert.ErrorContains(t, err, "HTTP URL is required")
+
+	_, err = audit.NewHTTPSink(config.AuditHTTPConfig{URL: "http://localhost"}, audit.JSONFormat)
+	assert.ErrorContains(t, err, "HTTP buffer directory is required")
+}
+
+func httpSinkConfig(t *testing.T, url string) config.AuditHTTPConfig {
+	return config.AuditHTTPConfig{
+		URL:                  url,
+		AuthorizationHeader:  "Bearer secret",
+		BufferDir:            filepath.Join(t.TempDir(), "buffer"),
+		BatchSize:            100,
+		FlushIntervalSeconds: 60,
+		MaxRetries:           1,
+	}
+}
+
+// batchReceiver records the entries in successfully received batches.
+type batchReceiver struct {
+	mu            sync.Mutex
+	status        int
+	attempts      int
+	received      []string
+	authorization string
+	contentType   string
+}
+
+func (b *batchReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.attempts++
+	b.authorization = r.Header.Get("Authorization")
+	b.contentType = r.Header.Get("Content-Type")
+
+	if b.status != 0 && b.status != http.StatusOK {
+		w.WriteHeader(b.status)
+		return
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		b.received = append(b.received, scanner.Text())
+	}
+}
+
+func (b *batchReceiver) setStatus(status int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status = status
+}
+
+func (b *batchReceiver) attemptCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.attempts
+}
+
+func (b *batchReceiver) entries() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.received...)
+}
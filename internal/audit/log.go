@@ -2,11 +2,18 @@ package audit
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"time"
 
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/redact"
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // marker for interface implementation
@@ -27,27 +34,82 @@ var (
 
 // Entry is an audit log entry for the current request.
 type Entry struct {
-	Method           string
-	Path             string
-	Status           int
-	SourceIP         string
-	UserAgent        string
-	RequestedProfile string
-	Authorized       bool
-	AuthSubject      string
-	AuthIssuer       string
-	AuthAudience     []string
-	AuthExpirySecs   int64
-	Error            string
-	Repositories     []string
-	Permissions      []string
-	ExpirySecs       int64
+	Method            string
+	Path              string
+	Status            int
+	SourceIP          string
+	UserAgent         string
+	ClientCertSubject string
+	RequestedProfile  string
+	Authorized        bool
+	AuthSubject       string
+	AuthIssuer        string
+	AuthAudience      []string
+	AuthExpirySecs    int64
+	Error             string
+	Repositories      []string
+	Permissions       []string
+	ExpirySecs        int64
+	HashedToken       string
+
+	// Buildkite context, from the claims of the agent JWT
+	OrganizationSlug string
+	PipelineSlug     string
+	PipelineID       string
+	BuildNumber      int
+	BuildBranch      string
+	BuildTag         string
+	BuildCommit      string
+	StepKey          string
+	JobID            string
+	AgentID          string
+
+	// Correlation and performance details
+	RequestID        string
+	TraceID          string
+	SpanID           string
+	CacheStatus      string
+	BuildkiteLatency time.Duration
+	GithubLatency    time.Duration
+
+	// ConfigGeneration identifies the configuration in effect for the request.
+	// See config.Generation.
+	ConfigGeneration uint64
+
+	// Chain fields are assigned when the entry is written, linking it to the
+	// previous entry. See Chain.
+	Chain      string
+	Sequence   uint64
+	RecordedAt time.Time
+	PrevHash   string
+	Hash       string
+	Checkpoint *Checkpoint
 }
 
 // MarshalZerologObject implements zerolog.LogObjectMarshaler. This avoids the
 // need for reflection when logging, at the cost of requiring maintenance when
 // the Entry struct changes.
 func (e *Entry) MarshalZerologObject(event *zerolog.Event) {
+	if e.Chain != "" {
+		event.Str("chain", e.Chain).
+			Uint64("seq", e.Sequence).
+			Str("recordedAt", e.RecordedAt.UTC().Format(time.RFC3339Nano))
+
+		if e.PrevHash != "" {
+			event.Str("prevHash", e.PrevHash)
+		}
+
+		if e.Hash != "" {
+			event.Str("hash", e.Hash)
+		}
+	}
+
+	// checkpoints are not request entries
+	if e.Checkpoint != nil {
+		event.Object("checkpoint", e.Checkpoint)
+		return
+	}
+
 	event.Str("method", e.Method).
 		Str("path", e.Path).
 		Int("status", e.Status).
@@ -59,7 +121,13 @@ func (e *Entry) MarshalZerologObject(event *zerolog.Event) {
 		Str("authIssuer", e.AuthIssuer).
 		Str("error", e.Error)
 
+	// the remaining durations must be consistent each time a recorded entry is
+	// rendered, or its hash cannot be verified
 	now := time.Now()
+	if !e.RecordedAt.IsZero() {
+		now = e.RecordedAt
+	}
+
 	if e.AuthExpirySecs > 0 {
 		exp := time.Unix(e.AuthExpirySecs, 0)
 		remaining := exp.Sub(now).Round(time.Millisecond)
@@ -74,6 +142,10 @@ func (e *Entry) MarshalZerologObject(event *zerolog.Event) {
 		event.Dur("expiryRemaining", remaining)
 	}
 
+	if e.ClientCertSubject != "" {
+		event.Str("clientCertSubject", e.ClientCertSubject)
+	}
+
 	if len(e.AuthAudience) > 0 {
 		event.Strs("authAudience", e.AuthAudience)
 	}
@@ -85,6 +157,86 @@ func (e *Entry) MarshalZerologObject(event *zerolog.Event) {
 	if len(e.Permissions) > 0 {
 		event.Strs("permissions", e.Permissions)
 	}
+
+	if e.HashedToken != "" {
+		event.Str("hashedToken", e.HashedToken)
+	}
+
+	if e.PipelineID != "" {
+		event.Str("organizationSlug", e.OrganizationSlug).
+			Str("pipelineSlug", e.PipelineSlug).
+			Str("pipelineID", e.PipelineID).
+			Int("buildNumber", e.BuildNumber).
+			Str("buildBranch", e.BuildBranch).
+			Str("buildTag", e.BuildTag).
+			Str("buildCommit", e.BuildCommit).
+			Str("stepKey", e.StepKey).
+			Str("jobID", e.JobID).
+			Str("agentID", e.AgentID)
+	}
+
+	if e.RequestID != "" {
+		event.Str("requestID", e.RequestID)
+	}
+
+	if e.TraceID != "" {
+		event.Str("traceID", e.TraceID).
+			Str("spanID", e.SpanID)
+	}
+
+	if e.CacheStatus != "" {
+		event.Str("cacheStatus", e.CacheStatus)
+	}
+
+	if e.BuildkiteLatency > 0 {
+		event.Dur("buildkiteLatency", e.BuildkiteLatency)
+	}
+
+	if e.GithubLatency > 0 {
+		event.Dur("githubLatency", e.GithubLatency)
+	}
+
+	if e.ConfigGeneration > 0 {
+		event.Uint64("configGeneration", e.ConfigGeneration)
+	}
+}
+
+// redact masks any secrets in the free text fields of the entry. This must be
+// done before the entry is chained: the record is written unchanged after it
+// has been hashed, so that it can be verified.
+func (e *Entry) redact() {
+	for _, field := range []*string{
+		&e.Method, &e.Path, &e.SourceIP, &e.UserAgent, &e.ClientCertSubject,
+		&e.RequestedProfile, &e.AuthSubject, &e.AuthIssuer, &e.Error,
+		&e.OrganizationSlug, &e.PipelineSlug, &e.PipelineID, &e.BuildBranch,
+		&e.BuildTag, &e.BuildCommit, &e.StepKey, &e.JobID, &e.AgentID,
+		&e.RequestID, &e.CacheStatus,
+	} {
+		*field = redact.String(*field)
+	}
+
+	for _, values := range [][]string{e.AuthAudience, e.Repositories, e.Permissions} {
+		for i, v := range values {
+			values[i] = redact.String(v)
+		}
+	}
+}
+
+// HashToken returns the fingerprint of a GitHub token, in the same form as the
+// hashed_token field of GitHub's audit log: the base64 encoded SHA-256 digest
+// of the token. This allows GitHub activity to be matched to the vended token
+// without recording the token itself.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// message is the log message of the entry when it is written.
+func (e *Entry) message() string {
+	if e.Checkpoint != nil {
+		return "audit_checkpoint"
+	}
+	return "audit_event"
 }
 
 // Begin sets up the audit log entry for the current request with details from the request.
@@ -93,9 +245,21 @@ func (e *Entry) Begin(r *http.Request) {
 	e.Method = r.Method
 	e.UserAgent = r.UserAgent()
 	e.SourceIP = r.RemoteAddr
+	e.ConfigGeneration = config.Generation()
+
+	// verified client certificates are present when mutual TLS is configured
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		e.ClientCertSubject = r.TLS.PeerCertificates[0].Subject.String()
+	}
+
+	// allows the entry to be correlated with traces of the request
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		e.TraceID = sc.TraceID().String()
+		e.SpanID = sc.SpanID().String()
+	}
 }
 
-// End writes the audit log entry. If the returned func is deferred, any panic
+// End writes the audit log entry to the log and any configured sinks. If the returned func is deferred, any panic
 // will be recovered so the log entry can be written before the panic is
 // re-raised.
 func (e *Entry) End(ctx context.Context) func() {
@@ -118,7 +282,7 @@ func (e *Entry) End(ctx context.Context) func() {
 			e.Status = http.StatusOK
 		}
 
-		zerolog.Ctx(ctx).WithLevel(Level).EmbedObject(e).Str("type", "audit").Msg("audit_event")
+		write(ctx, e)
 
 		if r != nil {
 			// repanic the panic
@@ -141,6 +305,11 @@ func Middleware() func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			ctx, entry := Context(r.Context())
 
+			// the request ID is returned to the client so that it can be
+			// correlated with the audit entry
+			entry.RequestID = newRequestID()
+			w.Header().Set(RequestIDHeader, entry.RequestID)
+
 			// wrap the response writer to capture the status code
 			response := wrapResponseWriter(w, Log(ctx))
 
@@ -152,6 +321,19 @@ func Middleware() func(next http.Handler) http.Handler {
 	}
 }
 
+// RequestIDHeader is the response header that carries the request ID recorded
+// in the audit entry.
+const RequestIDHeader = "X-Request-Id"
+
+// newRequestID creates a random identifier for a request.
+func newRequestID() string {
+	id := make([]byte, 16)
+	// crypto/rand does not fail on supported platforms
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
 // Get the log entry for the current request. This is safe to use even if the
 // context does not create an entry.
 func Log(ctx context.Context) *Entry {
@@ -0,0 +1,274 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ocsfVersion is the version of the Open Cybersecurity Schema Framework that
+// events conform to.
+const ocsfVersion = "1.3.0"
+
+// OCSF classes, activities and enumerations used by the audit events. See
+// https://schema.ocsf.io.
+const (
+	ocsfCategoryIAM         = 3
+	ocsfCategoryApplication = 6
+
+	ocsfClassAuthentication = 3002
+	ocsfClassAPIActivity    = 6003
+
+	ocsfActivityLogon  = 1
+	ocsfActivityCreate = 1
+
+	ocsfStatusSuccess = 1
+	ocsfStatusFailure = 2
+
+	ocsfSeverityInformational = 1
+	ocsfSeverityLow           = 2
+	ocsfSeverityMedium        = 3
+
+	ocsfAuthProtocolOpenID = 4
+)
+
+var ocsfSeverityNames = map[int]string{
+	ocsfSeverityInformational: "Informational",
+	ocsfSeverityLow:           "Low",
+	ocsfSeverityMedium:        "Medium",
+}
+
+// FormatNamed returns the format with the given name: "json" (the default) or
+// "ocsf".
+func FormatNamed(name string) (Format, error) {
+	switch name {
+	case "", "json":
+		return JSONFormat, nil
+	case "ocsf":
+		return OCSFFormat, nil
+	default:
+		return nil, fmt.Errorf("unknown audit format %q, expected json or ocsf", name)
+	}
+}
+
+// OCSFFormat renders the entry as an Open Cybersecurity Schema Framework event.
+// Requests that fail JWT authorization are Authentication events, and
+// authorized requests for tokens are API Activity events. Checkpoints have no
+// OCSF equivalent, and are not rendered.
+func OCSFFormat(e *Entry) ([]byte, error) {
+	if e.Checkpoint != nil {
+		return nil, nil
+	}
+
+	var event map[string]any
+	if e.Authorized {
+		event = ocsfAPIActivity(e)
+	} else {
+		event = ocsfAuthentication(e)
+	}
+
+	ocsfCommon(e, event)
+
+	return json.Marshal(event)
+}
+
+// ocsfAuthentication describes a failed attempt to authenticate with the agent
+// JWT.
+func ocsfAuthentication(e *Entry) map[string]any {
+	event := map[string]any{
+		"category_uid":     ocsfCategoryIAM,
+		"category_name":    "Identity & Access Management",
+		"class_uid":        ocsfClassAuthentication,
+		"class_name":       "Authentication",
+		"activity_id":      ocsfActivityLogon,
+		"activity_name":    "Logon",
+		"type_uid":         ocsfClassAuthentication*100 + ocsfActivityLogon,
+		"type_name":        "Authentication: Logon",
+		"auth_protocol_id": ocsfAuthProtocolOpenID,
+		"auth_protocol":    "OpenID",
+		"message":          "Buildkite agent JWT authentication failed",
+		"service":          map[string]any{"name": "chinmina-bridge"},
+		"user":             ocsfUser(e),
+	}
+
+	ocsfOutcome(event, false, ocsfSeverityMedium)
+
+	return event
+}
+
+// ocsfAPIActivity describes an authorized request to create a GitHub token.
+func ocsfAPIActivity(e *Entry) map[string]any {
+	event := map[string]any{
+		"category_uid":  ocsfCategoryApplication,
+		"category_name": "Application Activity",
+		"class_uid":     ocsfClassAPIActivity,
+		"class_name":    "API Activity",
+		"activity_id":   ocsfActivityCreate,
+		"activity_name": "Create",
+		"type_uid":      ocsfClassAPIActivity*100 + ocsfActivityCreate,
+		"type_name":     "API Activity: Create",
+		"actor": map[string]any{
+			"user":     ocsfUser(e),
+			"app_uid":  e.PipelineID,
+			"app_name": e.PipelineSlug,
+		},
+		"api": map[string]any{
+			"operation": e.Method + " " + e.Path,
+			"service":   map[string]any{"name": "GitHub"},
+			"request":   map[string]any{"uid": e.RequestID},
+		},
+	}
+
+	success := e.Status < 400 && e.Error == "" && len(e.Repositories) > 0
+	if success {
+		event["message"] = "GitHub token vended to Buildkite job"
+		ocsfOutcome(event, true, ocsfSeverityInformational)
+	} else {
+		event["message"] = "GitHub token not vended to Buildkite job"
+		ocsfOutcome(event, false, ocsfSeverityLow)
+	}
+
+	var resources []map[string]any
+	for _, repo := range e.Repositories {
+		resource := map[string]any{
+			"type": "GitHub Repository",
+			"uid":  repo,
+		}
+		if len(e.Permissions) > 0 {
+			resource["data"] = map[string]any{"permissions": e.Permissions}
+		}
+		resources = append(resources, resource)
+	}
+	if len(resources) > 0 {
+		event["resources"] = resources
+	}
+
+	return event
+}
+
+// ocsfCommon adds the fields shared by all events.
+func ocsfCommon(e *Entry, event map[string]any) {
+	at := e.RecordedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	event["time"] = at.UnixMilli()
+
+	metadata := map[string]any{
+		"version":  ocsfVersion,
+		"log_name": "audit",
+		"product": map[string]any{
+			"name":        "chinmina-bridge",
+			"vendor_name": "Chinmina",
+		},
+	}
+	if e.RequestID != "" {
+		metadata["uid"] = e.RequestID
+	}
+	if e.TraceID != "" {
+		metadata["correlation_uid"] = e.TraceID
+	}
+	if e.Sequence > 0 {
+		metadata["sequence"] = e.Sequence
+	}
+	event["metadata"] = metadata
+
+	event["http_request"] = map[string]any{
+		"http_method": e.Method,
+		"url":         map[string]any{"path": e.Path},
+		"user_agent":  e.UserAgent,
+	}
+	event["http_response"] = map[string]any{"code": e.Status}
+
+	src := map[string]any{}
+	if host, port, err := net.SplitHostPort(e.SourceIP); err == nil {
+		src["ip"] = host
+		if p, err := strconv.Atoi(port); err == nil {
+			src["port"] = p
+		}
+	} else if e.SourceIP != "" {
+		src["ip"] = e.SourceIP
+	}
+	if len(src) > 0 {
+		event["src_endpoint"] = src
+	}
+
+	// details without an OCSF equivalent are retained so no audit information
+	// is lost
+	unmapped := map[string]any{}
+	if e.PipelineID != "" {
+		unmapped["buildkite"] = map[string]any{
+			"organization_slug": e.OrganizationSlug,
+			"pipeline_slug":     e.PipelineSlug,
+			"pipeline_id":       e.PipelineID,
+			"build_number":      e.BuildNumber,
+			"build_branch":      e.BuildBranch,
+			"build_tag":         e.BuildTag,
+			"build_commit":      e.BuildCommit,
+			"step_key":          e.StepKey,
+			"job_id":            e.JobID,
+			"agent_id":          e.AgentID,
+		}
+	}
+	if e.HashedToken != "" {
+		unmapped["hashed_token"] = e.HashedToken
+	}
+	if e.CacheStatus != "" {
+		unmapped["cache_status"] = e.CacheStatus
+	}
+	if e.ExpirySecs > 0 {
+		unmapped["token_expiry"] = time.Unix(e.ExpirySecs, 0).UnixMilli()
+	}
+	if e.ClientCertSubject != "" {
+		unmapped["client_cert_subject"] = e.ClientCertSubject
+	}
+	if e.ConfigGeneration > 0 {
+		unmapped["config_generation"] = e.ConfigGeneration
+	}
+	if e.Chain != "" {
+		unmapped["chain"] = e.Chain
+		unmapped["hash"] = e.Hash
+	}
+	if len(unmapped) > 0 {
+		event["unmapped"] = unmapped
+	}
+
+	if e.Error != "" {
+		event["status_detail"] = e.Error
+	}
+	event["status_code"] = strconv.Itoa(e.Status)
+}
+
+func ocsfOutcome(event map[string]any, success bool, severity int) {
+	if success {
+		event["status_id"] = ocsfStatusSuccess
+		event["status"] = "Success"
+	} else {
+		event["status_id"] = ocsfStatusFailure
+		event["status"] = "Failure"
+	}
+
+	event["severity_id"] = severity
+	event["severity"] = ocsfSeverityNames[severity]
+}
+
+// ocsfUser identifies the Buildkite job by the subject of its JWT.
+func ocsfUser(e *Entry) map[string]any {
+	user := map[string]any{
+		"type_id": 99,
+		"type":    "Other",
+	}
+
+	if e.AuthSubject != "" {
+		user["uid"] = e.AuthSubject
+		user["name"] = e.AuthSubject
+	}
+
+	if e.OrganizationSlug != "" {
+		user["org"] = map[string]any{"name": e.OrganizationSlug}
+	}
+
+	return user
+}
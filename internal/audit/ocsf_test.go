@@ -0,0 +1,170 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOCSFFormat_AuthenticationFailure(t *testing.T) {
+	event := ocsfEvent(t, &audit.Entry{
+		Method:     "POST",
+		Path:       "/token",
+		Status:     401,
+		SourceIP:   "10.0.0.1:4321",
+		UserAgent:  "curl",
+		Authorized: false,
+		Error:      "invalid JWT: token is expired",
+		RequestID:  "req-1",
+		RecordedAt: time.UnixMilli(1700000000000),
+	})
+
+	assert.EqualValues(t, 3002, event["class_uid"])
+	assert.EqualValues(t, 300201, event["type_uid"])
+	assert.EqualValues(t, 3, event["severity_id"])
+	assert.Equal(t, "Medium", event["severity"])
+	assert.Equal(t, "Failure", event["status"])
+	assert.Equal(t, "invalid JWT: token is expired", event["status_detail"])
+	assert.EqualValues(t, 1700000000000, event["time"])
+	assert.Equal(t, map[string]any{"ip": "10.0.0.1", "port": float64(4321)}, event["src_endpoint"])
+
+	metadata := event["metadata"].(map[string]any)
+	assert.Equal(t, "1.3.0", metadata["version"])
+	assert.Equal(t, "req-1", metadata["uid"])
+}
+
+func TestOCSFFormat_VendSuccess(t *testing.T) {
+	event := ocsfEvent(t, &audit.Entry{
+		Method:           "POST",
+		Path:             "/token",
+		Status:           200,
+		Authorized:       true,
+		AuthSubject:      "organization:org:pipeline:pipe:ref:refs/heads/main:commit:abc:step:build",
+		OrganizationSlug: "org",
+		PipelineSlug:     "pipe",
+		PipelineID:       "pipeline-id",
+		BuildNumber:      42,
+		Repositories:     []string{"https://github.com/org/repo.git"},
+		Permissions:      []string{"contents:read"},
+		HashedToken:      "hashed",
+		TraceID:          "trace-1",
+		Sequence:         7,
+	})
+
+	assert.EqualValues(t, 6003, event["class_uid"])
+	assert.EqualValues(t, 600301, event["type_uid"])
+	assert.EqualValues(t, 1, event["severity_id"])
+	assert.Equal(t, "Success", event["status"])
+
+	actor := event["actor"].(map[string]any)
+	assert.Equal(t, "pipeline-id", actor["app_uid"])
+	assert.Equal(t, "pipe", actor["app_name"])
+	user := actor["user"].(map[string]any)
+	assert.Equal(t, "organization:org:pipeline:pipe:ref:refs/heads/main:commit:abc:step:build", user["uid"])
+	assert.Equal(t, map[string]any{"name": "org"}, user["org"])
+
+	resources := event["resources"].([]any)
+	require.Len(t, resources, 1)
+	assert.Equal(t, map[string]any{
+		"type": "GitHub Repository",
+		"uid":  "https://github.com/org/repo.git",
+		"data": map[string]any{"permissions": []any{"contents:read"}},
+	}, resources[0])
+
+	metadata := event["metadata"].(map[string]any)
+	assert.Equal(t, "trace-1", metadata["correlation_uid"])
+	assert.EqualValues(t, 7, metadata["sequence"])
+
+	unmapped := event["unmapped"].(map[string]any)
+	assert.Equal(t, "hashed", unmapped["hashed_token"])
+	assert.Equal(t, "pipe", unmapped["buildkite"].(map[string]any)["pipeline_slug"])
+}
+
+func TestOCSFFormat_VendFailure(t *testing.T) {
+	event := ocsfEvent(t, &audit.Entry{
+		Status:     403,
+		Authorized: true,
+		Error:      "repository not permitted",
+	})
+
+	assert.EqualValues(t, 6003, event["class_uid"])
+	assert.EqualValues(t, 2, event["severity_id"])
+	assert.Equal(t, "Failure", event["status"])
+	assert.NotContains(t, event, "resources")
+}
+
+func TestOCSFFormat_SkipsCheckpoints(t *testing.T) {
+	record, err := audit.OCSFFormat(&audit.Entry{Checkpoint: &audit.Checkpoint{Sequence: 1}})
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestFormatNamed(t *testing.T) {
+	for _, name := range []string{"", "json", "ocsf"} {
+		f, err := audit.FormatNamed(name)
+		assert.NoError(t, err, name)
+		assert.NotNil(t, f, name)
+	}
+
+	_, err := audit.FormatNamed("cef")
+	assert.ErrorContains(t, err, `unknown audit format "cef"`)
+}
+
+func TestConfigure_SinkFormat(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	shutdown, err := audit.Configure(context.Background(), config.AuditConfig{
+		Sinks: []string{"file"},
+		File:  config.AuditFileConfig{Path: path, MaxSizeMB: 1, Format: "ocsf"},
+	})
+	require.NoError(t, err)
+
+	_, e := audit.Context(context.Background())
+	e.Path = "/token"
+	e.End(context.Background())()
+
+	// the final checkpoint has no OCSF representation and is not written
+	require.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.Len(t, lines, 1)
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.EqualValues(t, 3002, event["class_uid"])
+}
+
+func TestConfigure_RejectsUnknownFormat(t *testing.T) {
+	_, err := audit.Configure(context.Background(), config.AuditConfig{
+		Sinks: []string{"file"},
+		File:  config.AuditFileConfig{Path: filepath.Join(t.TempDir(), "audit.log"), Format: "xml"},
+	})
+	assert.ErrorContains(t, err, `unknown audit format "xml"`)
+}
+
+func ocsfEvent(t *testing.T, e *audit.Entry) map[string]any {
+	t.Helper()
+
+	record, err := audit.OCSFFormat(e)
+	require.NoError(t, err)
+
+	var event map[string]any
+	require.NoError(t, json.Unmarshal(record, &event))
+
+	return event
+}
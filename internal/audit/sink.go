@@ -0,0 +1,382 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/awsarn"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Sink is a destination for completed audit entries, in addition to the
+// application log.
+type Sink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+
+	// Record delivers (or durably queues) the entry. An error indicates that the
+	// entry could not be delivered.
+	Record(ctx context.Context, e *Entry) error
+
+	// Close flushes any pending entries and releases resources.
+	Close(ctx context.Context) error
+}
+
+// Format renders an audit entry as a single record for a sink. Records do not
+// include a trailing newline. A nil record indicates that the entry has no
+// representation in the format, and it is not written.
+type Format func(e *Entry) ([]byte, error)
+
+// JSONFormat renders the entry as a JSON object with the same fields as the
+// audit log entry written to the application log.
+func JSONFormat(e *Entry) ([]byte, error) {
+	var buf bytes.Buffer
+
+	// the level is set explicitly as the application's level formatting may
+	// not be configured
+	logger := zerolog.New(&buf).With().Timestamp().Logger()
+	logger.Log().
+		Str(zerolog.LevelFieldName, "audit").
+		EmbedObject(e).
+		Str("type", "audit").
+		Msg(e.message())
+
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// state is the package level configuration of audit output.
+var state = struct {
+	mu            sync.Mutex
+	stdout        bool
+	chain         *Chain
+	sinks         []*sinkQueue
+	deliveryFails metric.Int64Counter
+}{
+	stdout: true,
+}
+
+// Configure sets up the audit chain, checkpoints and sinks according to the
+// configuration. If it does not return an error, the returned shutdown function
+// must be called to write a final checkpoint, then flush and close the sinks.
+func Configure(ctx context.Context, cfg config.AuditConfig) (shutdown func(context.Context) error, err error) {
+	chain, err := NewChain()
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := NewCheckpointSigner(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("audit checkpoint signer configuration failed: %w", err)
+	}
+
+	sinks, err := configuredSinks(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	meter := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/audit")
+
+	deliveries, err := meter.Int64Counter(
+		"audit.sink.delivered",
+		metric.WithDescription("The number of audit entries delivered to an audit sink"),
+	)
+	if err != nil {
+		return nil, errors.Join(err, closeSinks(ctx, sinks))
+	}
+
+	deliveryFails, err := meter.Int64Counter(
+		"audit.sink.failed",
+		metric.WithDescription("The number of audit entries that could not be delivered to an audit sink"),
+	)
+	if err != nil {
+		return nil, errors.Join(err, closeSinks(ctx, sinks))
+	}
+
+	queues := make([]*sinkQueue, 0, len(sinks))
+	for _, s := range sinks {
+		queues = append(queues, newSinkQueue(s, deliveries, deliveryFails))
+	}
+
+	state.mu.Lock()
+	state.stdout = cfg.StdoutEnabled
+	state.chain = chain
+	state.sinks = queues
+	state.deliveryFails = deliveryFails
+	state.mu.Unlock()
+
+	for _, s := range sinks {
+		log.Info().Str("sink", s.Name()).Msg("audit: sink configured")
+	}
+
+	log.Info().
+		Str("chain", chain.ID()).
+		Bool("signedCheckpoints", signer != nil).
+		Msg("audit: hash chain started")
+
+	checkpoints := &checkpointer{chain: chain, signer: signer}
+	stopCheckpoints := make(chan struct{})
+	checkpointsDone := make(chan struct{})
+	if cfg.CheckpointIntervalSeconds > 0 {
+		go func() {
+			defer close(checkpointsDone)
+			checkpoints.run(ctx, time.Duration(cfg.CheckpointIntervalSeconds)*time.Second, stopCheckpoints)
+		}()
+	} else {
+		close(checkpointsDone)
+	}
+
+	shutdown = func(ctx context.Context) error {
+		close(stopCheckpoints)
+		<-checkpointsDone
+
+		// the final checkpoint covers all entries written by the process
+		var err error
+		if cfg.CheckpointIntervalSeconds > 0 {
+			err = checkpoints.checkpoint(ctx)
+		}
+
+		state.mu.Lock()
+		queues := state.sinks
+		state.sinks = nil
+		state.chain = nil
+		state.stdout = true
+		state.mu.Unlock()
+
+		// queued entries are delivered before the sinks are closed
+		for _, q := range queues {
+			err = errors.Join(err, q.close(ctx))
+		}
+
+		return err
+	}
+
+	return shutdown, nil
+}
+
+func configuredSinks(cfg config.AuditConfig) ([]Sink, error) {
+	var sinks []Sink
+
+	for _, name := range cfg.Sinks {
+		var (
+			s   Sink
+			err error
+		)
+
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "file":
+			s, err = withFormat(cfg.File.Format, func(f Format) (Sink, error) { return NewFileSink(cfg.File, f) })
+		case "syslog":
+			s, err = withFormat(cfg.Syslog.Format, func(f Format) (Sink, error) { return NewSyslogSink(cfg.Syslog, f) })
+		case "http":
+			s, err = withFormat(cfg.HTTP.Format, func(f Format) (Sink, error) { return NewHTTPSink(cfg.HTTP, f) })
+		default:
+			err = fmt.Errorf("unknown audit sink type %q", name)
+		}
+
+		if err != nil {
+			return nil, errors.Join(
+				fmt.Errorf("audit sink %s configuration failed: %w", name, err),
+				closeSinks(context.Background(), sinks),
+			)
+		}
+
+		sinks = append(sinks, s)
+	}
+
+	return sinks, nil
+}
+
+// Validate checks the sink and checkpoint configuration without opening any
+// sinks or contacting KMS. All problems found are returned.
+func Validate(cfg config.AuditConfig) error {
+	var errs []error
+
+	for _, name := range cfg.Sinks {
+		var sinkErrs []error
+
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "file":
+			sinkErrs = []error{validateFormat(cfg.File.Format), validateFileConfig(cfg.File)}
+		case "syslog":
+			sinkErrs = []error{validateFormat(cfg.Syslog.Format), validateSyslogConfig(cfg.Syslog)}
+		case "http":
+			sinkErrs = []error{validateFormat(cfg.HTTP.Format), validateHTTPConfig(cfg.HTTP)}
+		default:
+			sinkErrs = []error{fmt.Errorf("unknown audit sink type %q", name)}
+		}
+
+		for _, err := range sinkErrs {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("audit sink %s: %w", name, err))
+			}
+		}
+	}
+
+	if cfg.CheckpointKeyARN != "" {
+		if err := awsarn.ValidateKMSKey(cfg.CheckpointKeyARN); err != nil {
+			errs = append(errs, fmt.Errorf("invalid AUDIT_CHECKPOINT_KEY_ARN: %w", err))
+		}
+	} else if cfg.CheckpointKeyFile != "" {
+		content, err := os.ReadFile(cfg.CheckpointKeyFile)
+		if err == nil {
+			_, err = NewRSACheckpointSigner(content)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid AUDIT_CHECKPOINT_KEY_FILE: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateFormat(name string) error {
+	_, err := FormatNamed(name)
+	return err
+}
+
+// withFormat creates a sink using the named format.
+func withFormat(name string, create func(Format) (Sink, error)) (Sink, error) {
+	format, err := FormatNamed(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return create(format)
+}
+
+func closeSinks(ctx context.Context, sinks []Sink) error {
+	var err error
+	for _, s := range sinks {
+		err = errors.Join(err, s.Close(ctx))
+	}
+	return err
+}
+
+// write links the completed entry to the audit chain, then sends it to the
+// application log (unless disabled) and queues it for each configured sink.
+// Delivery failures are logged and counted, but do not affect the request.
+//
+// Entries are linked and queued one at a time, so that each destination
+// receives them in chain order. Sinks record entries from their own goroutine,
+// so a slow sink does not delay the request.
+func write(ctx context.Context, e *Entry) {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	// Free text fields may echo request details. Secrets are masked before the
+	// entry is hashed, so that every output (including the redacted log) has the
+	// same content as the chain.
+	e.redact()
+
+	if state.chain != nil {
+		if err := state.chain.Link(e); err != nil {
+			log.Error().Err(err).Msg("audit: could not link entry to chain")
+		}
+	}
+
+	if state.stdout {
+		zerolog.Ctx(ctx).WithLevel(Level).EmbedObject(e).Str("type", "audit").Msg(e.message())
+	}
+
+	for _, q := range state.sinks {
+		if !q.enqueue(e) {
+			state.deliveryFails.Add(ctx, 1, metric.WithAttributes(attribute.String("sink", q.sink.Name())))
+			log.Error().Str("sink", q.sink.Name()).Msg("audit: sink queue full, entry not delivered")
+		}
+	}
+}
+
+const (
+	// sinkTimeout bounds the time a sink may take to record an entry.
+	sinkTimeout = 2 * time.Second
+	// sinkQueueSize is the number of entries that may be waiting for a sink.
+	sinkQueueSize = 4096
+)
+
+// sinkQueue delivers entries to a sink in order, from its own goroutine. The
+// queue is bounded: if the sink falls too far behind, further entries are not
+// queued and are counted as failed deliveries.
+type sinkQueue struct {
+	sink          Sink
+	entries       chan *Entry
+	done          chan struct{}
+	deliveries    metric.Int64Counter
+	deliveryFails metric.Int64Counter
+}
+
+func newSinkQueue(s Sink, deliveries, deliveryFails metric.Int64Counter) *sinkQueue {
+	q := &sinkQueue{
+		sink:          s,
+		entries:       make(chan *Entry, sinkQueueSize),
+		done:          make(chan struct{}),
+		deliveries:    deliveries,
+		deliveryFails: deliveryFails,
+	}
+
+	go q.run()
+
+	return q
+}
+
+// enqueue queues the entry without waiting, returning false if the queue is
+// full. Entries must not be modified once queued.
+func (q *sinkQueue) enqueue(e *Entry) bool {
+	select {
+	case q.entries <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (q *sinkQueue) run() {
+	defer close(q.done)
+
+	for e := range q.entries {
+		q.record(e)
+	}
+}
+
+func (q *sinkQueue) record(e *Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), sinkTimeout)
+	defer cancel()
+
+	attrs := metric.WithAttributes(attribute.String("sink", q.sink.Name()))
+
+	if err := q.sink.Record(ctx, e); err != nil {
+		q.deliveryFails.Add(ctx, 1, attrs)
+		log.Error().Err(err).Str("sink", q.sink.Name()).Msg("audit: delivery to sink failed")
+		return
+	}
+
+	q.deliveries.Add(ctx, 1, attrs)
+}
+
+// close waits for queued entries to be recorded, within the deadline of the
+// context, then closes the sink.
+func (q *sinkQueue) close(ctx context.Context) error {
+	close(q.entries)
+
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		log.Error().Str("sink", q.sink.Name()).Int("pending", len(q.entries)).Msg("audit: sink queue not drained before shutdown")
+	}
+
+	return q.sink.Close(ctx)
+}
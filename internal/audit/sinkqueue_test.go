@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// slowSink records entry paths once it is released.
+type slowSink struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	paths   []string
+	closed  bool
+	started chan struct{}
+}
+
+func (s *slowSink) Name() string { return "slow" }
+
+func (s *slowSink) Record(_ context.Context, e *Entry) error {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, e.Path)
+
+	return nil
+}
+
+func (s *slowSink) Close(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+
+	return nil
+}
+
+func TestWrite_DoesNotWaitForSinks(t *testing.T) {
+	sink := &slowSink{release: make(chan struct{}), started: make(chan struct{}, 1)}
+	counter, _ := noop.NewMeterProvider().Meter("test").Int64Counter("test")
+	q := newSinkQueue(sink, counter, counter)
+
+	state.mu.Lock()
+	state.stdout = false
+	state.sinks = []*sinkQueue{q}
+	state.deliveryFails = counter
+	state.mu.Unlock()
+	t.Cleanup(func() {
+		state.mu.Lock()
+		state.stdout = true
+		state.sinks = nil
+		state.mu.Unlock()
+	})
+
+	start := time.Now()
+	for _, path := range []string{"/first", "/second", "/third"} {
+		write(context.Background(), &Entry{Path: path})
+	}
+	assert.Less(t, time.Since(start), time.Second, "write should only queue entries")
+
+	<-sink.started
+	close(sink.release)
+
+	require.NoError(t, q.close(context.Background()))
+
+	assert.Equal(t, []string{"/first", "/second", "/third"}, sink.paths)
+	assert.True(t, sink.closed)
+}
+
+func TestSinkQueue_FullQueueRejectsEntries(t *testing.T) {
+	sink := &slowSink{release: make(chan struct{}), started: make(chan struct{}, 1)}
+	counter, _ := noop.NewMeterProvider().Meter("test").Int64Counter("test")
+	q := newSinkQueue(sink, counter, counter)
+
+	// the first entry is taken by the sink, then the queue fills
+	require.True(t, q.enqueue(&Entry{}))
+	<-sink.started
+	for range sinkQueueSize {
+		require.True(t, q.enqueue(&Entry{}))
+	}
+
+	assert.False(t, q.enqueue(&Entry{}))
+
+	close(sink.release)
+	require.NoError(t, q.close(context.Background()))
+}
@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	spoolPendingFile  = "pending.jsonl"
+	spoolBatchPattern = "batch-*.jsonl"
+	spoolRetryBackoff = 500 * time.Millisecond
+)
+
+// spool buffers the records of a sink on disk until they have been delivered,
+// so records are not lost if the destination is unavailable or the process
+// restarts. Delivery is at least once: a batch is delivered again if its
+// delivery is not confirmed.
+//
+// Records are appended to a pending file. When the batch size is reached or the
+// flush interval elapses, the pending file is sealed as a batch and the batches
+// are delivered in order. A batch that cannot be delivered after the configured
+// retries is kept and retried at the next flush.
+type spool struct {
+	spoolConfig
+
+	mu      sync.Mutex
+	pending *os.File
+	count   int
+	seq     int
+
+	flush chan struct{}
+	stop  chan struct{}
+	abort chan struct{}
+	done  chan struct{}
+}
+
+// spoolConfig configures a spool. Records are newline delimited, and each
+// batch is passed to deliver in order.
+type spoolConfig struct {
+	name          string
+	dir           string
+	batchSize     int
+	flushInterval time.Duration
+	maxRetries    int
+	deliver       func(ctx context.Context, batch []byte) error
+	batches       metric.Int64Counter
+}
+
+// newSpool creates the buffer directory if necessary, recovers any records
+// buffered by a previous process and starts delivery in the background.
+func newSpool(cfg spoolConfig) (*spool, error) {
+	if err := os.MkdirAll(cfg.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("could not create buffer directory: %w", err)
+	}
+
+	cfg.batchSize = max(cfg.batchSize, 1)
+	cfg.flushInterval = max(cfg.flushInterval, time.Second)
+	cfg.maxRetries = max(cfg.maxRetries, 0)
+
+	s := &spool{
+		spoolConfig: cfg,
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		abort:       make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+
+	// records left pending by a previous process form the first batch
+	if err := s.seal(); err != nil {
+		return nil, err
+	}
+
+	if err := s.openPending(); err != nil {
+		return nil, err
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// append adds a record, which must end with a newline, to the buffer. The
+// record is delivered asynchronously.
+func (s *spool) append(record []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		return fmt.Errorf("audit %s sink is closed", s.name)
+	}
+
+	if _, err := s.pending.Write(record); err != nil {
+		return fmt.Errorf("could not buffer audit entry: %w", err)
+	}
+
+	s.count++
+	if s.count >= s.batchSize {
+		select {
+		case s.flush <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// close stops background delivery, then makes a final attempt to deliver the
+// buffered records within the deadline of the context. Records that cannot be
+// delivered remain buffered for the next process.
+func (s *spool) close(ctx context.Context) error {
+	close(s.stop)
+
+	// allow an in-flight delivery to complete unless the deadline is reached
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		close(s.abort)
+		<-s.done
+	}
+
+	s.mu.Lock()
+	err := s.sealPending()
+	if s.pending != nil {
+		err = errors.Join(err, s.pending.Close())
+		s.pending = nil
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	return s.ship(ctx)
+}
+
+func (s *spool) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	// deliver anything recovered from a previous process
+	s.flushAndShip()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+		case <-s.flush:
+		}
+
+		s.flushAndShip()
+	}
+}
+
+func (s *spool) flushAndShip() {
+	s.mu.Lock()
+	err := s.sealPending()
+	s.mu.Unlock()
+
+	if err != nil {
+		log.Error().Err(err).Str("sink", s.name).Msg("audit: could not seal sink batch")
+	}
+
+	// delivery is abandoned if the sink cannot be closed in time
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.abort:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if err := s.ship(ctx); err != nil {
+		log.Warn().Err(err).Str("sink", s.name).Msg("audit: sink delivery failed, entries remain buffered")
+	}
+}
+
+// sealPending converts the pending file to a batch if it contains records, and
+// opens a new pending file. The caller must hold the lock.
+func (s *spool) sealPending() error {
+	if s.count == 0 || s.pending == nil {
+		return nil
+	}
+
+	if err := s.pending.Close(); err != nil {
+		return err
+	}
+	s.pending = nil
+
+	if err := s.seal(); err != nil {
+		return err
+	}
+
+	return s.openPending()
+}
+
+// seal renames a non-empty pending file to a new batch file.
+func (s *spool) seal() error {
+	path := filepath.Join(s.dir, spoolPendingFile)
+
+	info, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && info.Size() == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// the timestamp and sequence ensure batches sort in the order they were
+	// sealed
+	s.seq++
+	batch := filepath.Join(s.dir, fmt.Sprintf("batch-%020d-%06d.jsonl", time.Now().UnixNano(), s.seq))
+
+	if err := os.Rename(path, batch); err != nil {
+		return fmt.Errorf("could not seal audit batch: %w", err)
+	}
+
+	s.count = 0
+
+	return nil
+}
+
+func (s *spool) openPending() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, spoolPendingFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not open audit buffer: %w", err)
+	}
+
+	s.pending = f
+
+	return nil
+}
+
+// ship delivers each sealed batch in order, removing it once it has been
+// accepted. Delivery stops at the first batch that cannot be delivered, so that
+// ordering is preserved.
+func (s *spool) ship(ctx context.Context) error {
+	batches, err := filepath.Glob(filepath.Join(s.dir, spoolBatchPattern))
+	if err != nil {
+		return err
+	}
+	sort.Strings(batches)
+
+	for _, batch := range batches {
+		content, err := os.ReadFile(batch)
+		if err != nil {
+			return err
+		}
+
+		if err := s.send(ctx, content); err != nil {
+			s.batches.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "failed")))
+			return err
+		}
+
+		s.batches.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "shipped")))
+
+		if err := os.Remove(batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send delivers the batch, retrying with exponential backoff.
+func (s *spool) send(ctx context.Context, content []byte) error {
+	var err error
+
+	for attempt := 0; attempt <= s.maxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return errors.Join(err, ctx.Err())
+			case <-time.After(spoolRetryBackoff << (attempt - 1)):
+			}
+		}
+
+		err = s.deliver(ctx, content)
+		if err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
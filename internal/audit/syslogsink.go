@@ -0,0 +1,270 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// syslogFacilities maps facility names to their RFC 5424 codes.
+var syslogFacilities = map[string]int{
+	"kern":     0,
+	"user":     1,
+	"daemon":   3,
+	"auth":     4,
+	"authpriv": 10,
+	"local0":   16,
+	"local1":   17,
+	"local2":   18,
+	"local3":   19,
+	"local4":   20,
+	"local5":   21,
+	"local6":   22,
+	"local7":   23,
+}
+
+const (
+	// syslogSeverityNotice is used for all audit entries: they are normal but
+	// significant events.
+	syslogSeverityNotice = 5
+
+	syslogMsgID = "audit"
+)
+
+// syslogSinkTimeout bounds each attempt to connect and write to the receiver.
+const syslogSinkTimeout = 5 * time.Second
+
+// SyslogSink sends audit entries to a syslog receiver as RFC 5424 messages,
+// over UDP or TCP. TCP messages are framed using octet counting (RFC 6587), and
+// the connection is re-established on failure.
+//
+// As with the HTTP sink, messages are buffered on disk and sent in the
+// background, retrying with backoff, so that a slow or unavailable receiver
+// neither delays requests nor loses entries. Delivery is at least once.
+type SyslogSink struct {
+	network  string
+	address  string
+	priority int
+	appName  string
+	hostname string
+	procID   string
+	format   Format
+	spool    *spool
+
+	// the connection is only used by the spool's delivery goroutine, and when
+	// closing
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+var _ Sink = (*SyslogSink)(nil)
+
+func validateSyslogConfig(cfg config.AuditSyslogConfig) error {
+	if cfg.Address == "" {
+		return errors.New("syslog address is required")
+	}
+
+	if cfg.Network != "udp" && cfg.Network != "tcp" {
+		return fmt.Errorf("unsupported syslog network %q, expected udp or tcp", cfg.Network)
+	}
+
+	if _, ok := syslogFacilities[cfg.Facility]; !ok {
+		return fmt.Errorf("unknown syslog facility %q", cfg.Facility)
+	}
+
+	if cfg.BufferDir == "" {
+		return errors.New("syslog buffer directory is required")
+	}
+
+	return nil
+}
+
+// NewSyslogSink validates the syslog configuration, creates the buffer
+// directory if necessary, recovers any messages buffered by a previous process
+// and starts sending in the background. The connection to the receiver is made
+// when the first message is sent.
+func NewSyslogSink(cfg config.AuditSyslogConfig, format Format) (*SyslogSink, error) {
+	if err := validateSyslogConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	batches, err := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/audit").Int64Counter(
+		"audit.sink.syslog.batches",
+		metric.WithDescription("The number of attempts to send a batch of audit entries to the syslog receiver, by outcome"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	s := &SyslogSink{
+		network:  cfg.Network,
+		address:  cfg.Address,
+		priority: syslogFacilities[cfg.Facility]*8 + syslogSeverityNotice,
+		appName:  headerValue(cfg.AppName, 48),
+		hostname: headerValue(hostname, 255),
+		procID:   strconv.Itoa(os.Getpid()),
+		format:   format,
+	}
+
+	// each message is sent as soon as possible; the flush interval sets how
+	// often messages are retried while the receiver is unavailable
+	s.spool, err = newSpool(spoolConfig{
+		name:          "syslog",
+		dir:           cfg.BufferDir,
+		batchSize:     1,
+		flushInterval: syslogFlushInterval,
+		maxRetries:    cfg.MaxRetries,
+		deliver:       s.deliver,
+		batches:       batches,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// syslogFlushInterval is how often buffered messages are sent when the
+// receiver has been unavailable.
+const syslogFlushInterval = 5 * time.Second
+
+func (s *SyslogSink) Name() string {
+	return "syslog"
+}
+
+// Record formats the entry as a syslog message and appends it to the on-disk
+// buffer. The message is sent asynchronously.
+func (s *SyslogSink) Record(_ context.Context, e *Entry) error {
+	record, err := s.format(e)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+
+	// the timestamp is the time the entry was recorded, not of its delivery, so
+	// that retried and recovered messages keep their time
+	recorded := e.RecordedAt
+	if recorded.IsZero() {
+		recorded = time.Now()
+	}
+	msg := s.message(recorded, record)
+
+	return s.spool.append(append(msg, '\n'))
+}
+
+// Close stops background sending, then makes a final attempt to send the
+// buffered messages within the deadline of the context. Messages that cannot
+// be sent remain buffered for the next process.
+func (s *SyslogSink) Close(ctx context.Context) error {
+	err := s.spool.close(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		err = errors.Join(err, s.conn.Close())
+		s.conn = nil
+	}
+
+	return err
+}
+
+// message formats an RFC 5424 message with the record as the message body.
+func (s *SyslogSink) message(t time.Time, record []byte) []byte {
+	header := fmt.Sprintf("<%d>1 %s %s %s %s %s - ",
+		s.priority,
+		t.UTC().Format(time.RFC3339Nano),
+		s.hostname,
+		s.appName,
+		s.procID,
+		syslogMsgID,
+	)
+
+	return append([]byte(header), record...)
+}
+
+// deliver sends each message of a batch in order. Records do not contain
+// newlines, so each line of the batch is a message.
+func (s *SyslogSink) deliver(ctx context.Context, batch []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, msg := range bytes.Split(bytes.TrimRight(batch, "\n"), []byte("\n")) {
+		if s.network == "tcp" {
+			msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+		}
+
+		// a failure on an existing connection may be due to the receiver
+		// restarting, so a single reconnection is attempted
+		err := s.send(ctx, msg)
+		if err != nil && s.network == "tcp" {
+			err = s.send(ctx, msg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// send writes the message on the current connection, connecting if necessary.
+// The connection is discarded on failure. The caller must hold the lock.
+func (s *SyslogSink) send(ctx context.Context, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, syslogSinkTimeout)
+	defer cancel()
+
+	if s.conn == nil {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("could not connect to syslog receiver: %w", err)
+		}
+		s.conn = conn
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = s.conn.SetWriteDeadline(deadline)
+
+	if _, err := s.conn.Write(msg); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("could not write to syslog receiver: %w", err)
+	}
+
+	return nil
+}
+
+// headerValue makes the value safe for use as an RFC 5424 header field: it must
+// be printable US-ASCII without spaces, and no longer than the given length.
+func headerValue(v string, maxLen int) string {
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v) && len(b) < maxLen; i++ {
+		if v[i] > 32 && v[i] < 127 {
+			b = append(b, v[i])
+		}
+	}
+
+	if len(b) == 0 {
+		return "-"
+	}
+
+	return string(b)
+}
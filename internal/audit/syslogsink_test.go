@@ -0,0 +1,183 @@
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc5424Header matches the header of the messages written by the sink:
+// priority 85 is authpriv (10) with severity notice (5).
+var rfc5424Header = regexp.MustCompile(`^<85>1 \S+Z \S+ chinmina-bridge \d+ audit - \{`)
+
+func TestSyslogSink_UDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	s, err := audit.NewSyslogSink(syslogConfig(t, "udp", conn.LocalAddr().String()), audit.JSONFormat)
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	recorded := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/token", Status: 200, RecordedAt: recorded}))
+
+	buf := make([]byte, 4096)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	msg := string(buf[:n])
+	assert.Regexp(t, rfc5424Header, msg)
+	assert.Contains(t, msg, `"path":"/token"`)
+
+	// the timestamp is the time the entry was recorded
+	assert.Contains(t, msg, " 2026-01-01T10:00:00Z ")
+}
+
+func TestSyslogSink_TCPOctetCounting(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		var msgs []string
+		for range 2 {
+			msgs = append(msgs, readOctetCounted(t, r))
+		}
+		received <- msgs
+	}()
+
+	s, err := audit.NewSyslogSink(syslogConfig(t, "tcp", l.Addr().String()), audit.JSONFormat)
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/token"}))
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/git-credentials"}))
+
+	select {
+	case msgs := <-received:
+		require.Len(t, msgs, 2)
+		assert.Regexp(t, rfc5424Header, msgs[0])
+		assert.Contains(t, msgs[0], `"path":"/token"`)
+		assert.Contains(t, msgs[1], `"path":"/git-credentials"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("messages not received")
+	}
+}
+
+func TestSyslogSink_TCPBuffersWhenUnavailable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	cfg := syslogConfig(t, "tcp", addr)
+	cfg.BufferDir = filepath.Join(t.TempDir(), "buffer")
+
+	s, err := audit.NewSyslogSink(cfg, audit.JSONFormat)
+	require.NoError(t, err)
+
+	// recording only buffers the message, so the unavailable receiver is
+	// reported when the sink can't send it
+	require.NoError(t, s.Record(context.Background(), &audit.Entry{Path: "/token"}))
+
+	err = s.Close(context.Background())
+	assert.ErrorContains(t, err, "could not connect to syslog receiver")
+
+	// the message is retained on disk and sent by the next sink using the
+	// buffer
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		received <- readOctetCounted(t, bufio.NewReader(conn))
+	}()
+
+	s, err = audit.NewSyslogSink(cfg, audit.JSONFormat)
+	require.NoError(t, err)
+	defer s.Close(context.Background())
+
+	select {
+	case msg := <-received:
+		assert.Regexp(t, rfc5424Header, msg)
+		assert.Contains(t, msg, `"path":"/token"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("buffered message not received")
+	}
+}
+
+func TestSyslogSink_InvalidConfiguration(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      config.AuditSyslogConfig
+		expected string
+	}{
+		{"missing address", config.AuditSyslogConfig{Network: "udp", Facility: "auth"}, "syslog address is required"},
+		{"bad network", config.AuditSyslogConfig{Network: "unix", Address: "x", Facility: "auth"}, "unsupported syslog network"},
+		{"bad facility", config.AuditSyslogConfig{Network: "udp", Address: "x", Facility: "mail"}, "unknown syslog facility"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := audit.NewSyslogSink(c.cfg, audit.JSONFormat)
+			assert.ErrorContains(t, err, c.expected)
+		})
+	}
+}
+
+func syslogConfig(t *testing.T, network, address string) config.AuditSyslogConfig {
+	return config.AuditSyslogConfig{
+		Network:   network,
+		Address:   address,
+		Facility:  "authpriv",
+		AppName:   "chinmina-bridge",
+		BufferDir: t.TempDir(),
+		// delivery is retried at the next flush, which keeps tests quick
+		MaxRetries: 0,
+	}
+}
+
+func readOctetCounted(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	prefix, err := r.ReadString(' ')
+	require.NoError(t, err)
+
+	length, err := strconv.Atoi(strings.TrimSpace(prefix))
+	require.NoError(t, err)
+
+	msg := make([]byte, length)
+	_, err = io.ReadFull(r, msg)
+	require.NoError(t, err)
+
+	return string(msg)
+}
@@ -0,0 +1,215 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// maxRecordSize is the longest audit record line accepted by the verifier.
+const maxRecordSize = 1024 * 1024
+
+// VerifyOptions controls the verification of an audit log.
+type VerifyOptions struct {
+	// PublicKey verifies checkpoint signatures. If nil, signatures are not
+	// checked.
+	PublicKey *rsa.PublicKey
+
+	// RequireSignatures reports unsigned checkpoints as problems.
+	RequireSignatures bool
+}
+
+// VerifyProblem describes a point at which the audit log is not intact.
+type VerifyProblem struct {
+	Line     int
+	Chain    string
+	Sequence uint64
+	Message  string
+}
+
+func (p VerifyProblem) String() string {
+	if p.Chain == "" {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return fmt.Sprintf("line %d: chain %s seq %d: %s", p.Line, p.Chain, p.Sequence, p.Message)
+}
+
+// VerifyReport summarises the verification of an audit log.
+type VerifyReport struct {
+	Records             int
+	Chains              int
+	Checkpoints         int
+	SignaturesVerified  int
+	SignaturesUnchecked int
+	Problems            []VerifyProblem
+}
+
+// OK returns true if no problems were found.
+func (r VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// chainProgress tracks the verification of a single chain.
+type chainProgress struct {
+	lastSeq  uint64
+	lastHash string
+	hashes   map[uint64]string
+}
+
+// Verify reads an audit log of JSON lines, checking that each chain is intact:
+// that no record has been altered, removed or reordered, and that checkpoints
+// match the records they refer to. Lines that are not audit records (such as
+// application log entries) are ignored, so a complete application log can be
+// verified.
+//
+// Records removed from the end of a chain after its last checkpoint cannot be
+// detected.
+func Verify(r io.Reader, opts VerifyOptions) (VerifyReport, error) {
+	report := VerifyReport{}
+	chains := map[string]*chainProgress{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		fields, err := decodeRecord(scanner.Bytes())
+		if err != nil || fields["type"] != "audit" {
+			continue
+		}
+
+		report.Records++
+
+		problem := func(chain string, seq uint64, format string, args ...any) {
+			report.Problems = append(report.Problems, VerifyProblem{
+				Line:     line,
+				Chain:    chain,
+				Sequence: seq,
+				Message:  fmt.Sprintf(format, args...),
+			})
+		}
+
+		chainID, _ := fields["chain"].(string)
+		hash, _ := fields["hash"].(string)
+		prevHash, _ := fields["prevHash"].(string)
+		seq, seqErr := numberField(fields, "seq")
+
+		if chainID == "" || hash == "" || seqErr != nil {
+			problem("", 0, "record is not part of a hash chain")
+			continue
+		}
+
+		expected, err := recordHash(fields)
+		if err != nil {
+			return report, err
+		}
+		if expected != hash {
+			problem(chainID, seq, "record has been modified: hash does not match content")
+		}
+
+		progress, ok := chains[chainID]
+		if !ok {
+			progress = &chainProgress{hashes: map[uint64]string{}}
+			chains[chainID] = progress
+			report.Chains++
+
+			if seq != 1 {
+				problem(chainID, seq, "chain starts part way through: %d earlier records missing", seq-1)
+			} else if prevHash != "" {
+				problem(chainID, seq, "first record of chain links to a previous record")
+			}
+		} else {
+			switch {
+			case seq <= progress.lastSeq:
+				problem(chainID, seq, "record out of order or duplicated: follows seq %d", progress.lastSeq)
+			case seq > progress.lastSeq+1:
+				problem(chainID, seq, "%d records missing after seq %d", seq-progress.lastSeq-1, progress.lastSeq)
+			case prevHash != progress.lastHash:
+				problem(chainID, seq, "record does not link to the previous record")
+			}
+		}
+
+		if seq > progress.lastSeq {
+			progress.lastSeq = seq
+			progress.lastHash = hash
+		}
+		progress.hashes[seq] = hash
+
+		if cp, ok := fields["checkpoint"].(map[string]any); ok {
+			report.Checkpoints++
+
+			verifyCheckpoint(chainID, cp, progress, opts, &report, func(format string, args ...any) {
+				problem(chainID, seq, format, args...)
+			})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// verifyCheckpoint checks that the checkpoint matches the record it refers to,
+// and that its signature is valid.
+func verifyCheckpoint(chainID string, fields map[string]any, progress *chainProgress, opts VerifyOptions, report *VerifyReport, problem func(string, ...any)) {
+	seq, err := numberField(fields, "seq")
+	hash, _ := fields["hash"].(string)
+	if err != nil || hash == "" {
+		problem("checkpoint is malformed")
+		return
+	}
+
+	recorded, ok := progress.hashes[seq]
+	switch {
+	case !ok:
+		problem("checkpoint refers to missing record seq %d", seq)
+	case recorded != hash:
+		problem("checkpoint does not match record seq %d", seq)
+	}
+
+	encoded, _ := fields["signature"].(string)
+	if encoded == "" {
+		if opts.RequireSignatures {
+			problem("checkpoint is not signed")
+		}
+		return
+	}
+
+	if opts.PublicKey == nil {
+		report.SignaturesUnchecked++
+		return
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		problem("checkpoint signature is malformed")
+		return
+	}
+
+	alg, _ := fields["alg"].(string)
+	cp := &Checkpoint{Sequence: seq, Hash: hash, Algorithm: alg, Signature: sig}
+
+	if err := VerifyCheckpointSignature(opts.PublicKey, chainID, cp); err != nil {
+		problem("checkpoint signature is invalid: %v", err)
+		return
+	}
+
+	report.SignaturesVerified++
+}
+
+func numberField(fields map[string]any, name string) (uint64, error) {
+	n, ok := fields[name].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s is not a number", name)
+	}
+
+	return strconv.ParseUint(n.String(), 10, 64)
+}
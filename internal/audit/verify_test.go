@@ -0,0 +1,191 @@
+package audit_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify_IntactLog(t *testing.T) {
+	key := generateKey(t)
+	lines := writeChainedLog(t, key, 3)
+
+	// 3 entries and the final checkpoint
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[3], `"message":"audit_checkpoint"`)
+
+	report := verifyLines(t, lines, audit.VerifyOptions{PublicKey: &key.PublicKey, RequireSignatures: true})
+
+	assert.True(t, report.OK(), "unexpected problems: %v", report.Problems)
+	assert.Equal(t, 4, report.Records)
+	assert.Equal(t, 1, report.Chains)
+	assert.Equal(t, 1, report.Checkpoints)
+	assert.Equal(t, 1, report.SignaturesVerified)
+}
+
+func TestVerify_IgnoresOtherLogLines(t *testing.T) {
+	key := generateKey(t)
+	lines := writeChainedLog(t, key, 2)
+
+	mixed := []string{`{"level":"info","message":"starting server"}`, "not json"}
+	mixed = append(mixed, lines...)
+
+	report := verifyLines(t, mixed, audit.VerifyOptions{PublicKey: &key.PublicKey})
+
+	assert.True(t, report.OK(), "unexpected problems: %v", report.Problems)
+	assert.Equal(t, 3, report.Records)
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	key := generateKey(t)
+	lines := writeChainedLog(t, key, 4)
+
+	cases := []struct {
+		name     string
+		tamper   func([]string) []string
+		expected string
+	}{
+		{
+			name: "edit",
+			tamper: func(l []string) []string {
+				l[1] = strings.Replace(l[1], `"path":"/token/2"`, `"path":"/token/9"`, 1)
+				return l
+			},
+			expected: "record has been modified",
+		},
+		{
+			name: "deletion",
+			tamper: func(l []string) []string {
+				return append(l[:1], l[2:]...)
+			},
+			expected: "1 records missing after seq 1",
+		},
+		{
+			name: "deletion at start",
+			tamper: func(l []string) []string {
+				return l[1:]
+			},
+			expected: "1 earlier records missing",
+		},
+		{
+			name: "reordering",
+			tamper: func(l []string) []string {
+				l[1], l[2] = l[2], l[1]
+				return l
+			},
+			expected: "record out of order or duplicated",
+		},
+		{
+			name: "tail removed before checkpoint",
+			tamper: func(l []string) []string {
+				return append(l[:3], l[4:]...)
+			},
+			expected: "checkpoint refers to missing record seq 4",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			tampered := c.tamper(append([]string(nil), lines...))
+
+			report := verifyLines(t, tampered, audit.VerifyOptions{PublicKey: &key.PublicKey})
+
+			require.False(t, report.OK())
+
+			var messages []string
+			for _, p := range report.Problems {
+				messages = append(messages, p.Message)
+			}
+			assert.Contains(t, strings.Join(messages, "\n"), c.expected)
+		})
+	}
+}
+
+func TestVerify_DetectsInvalidSignature(t *testing.T) {
+	key := generateKey(t)
+	lines := writeChainedLog(t, key, 1)
+
+	other := generateKey(t)
+	report := verifyLines(t, lines, audit.VerifyOptions{PublicKey: &other.PublicKey})
+
+	require.False(t, report.OK())
+	assert.Contains(t, report.Problems[0].Message, "checkpoint signature is invalid")
+}
+
+func TestVerify_UncheckedSignatures(t *testing.T) {
+	key := generateKey(t)
+	lines := writeChainedLog(t, key, 1)
+
+	report := verifyLines(t, lines, audit.VerifyOptions{})
+
+	assert.True(t, report.OK())
+	assert.Equal(t, 1, report.SignaturesUnchecked)
+}
+
+// writeChainedLog configures auditing with a file sink and a signed checkpoint,
+// writes the given number of entries, then returns the lines of the file.
+func writeChainedLog(t *testing.T, key *rsa.PrivateKey, count int) []string {
+	t.Helper()
+	testhelpers.SetupLogger(t)
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "checkpoint.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+
+	logFile := filepath.Join(dir, "audit.log")
+
+	shutdown, err := audit.Configure(context.Background(), config.AuditConfig{
+		StdoutEnabled:             false,
+		Sinks:                     []string{"file"},
+		File:                      config.AuditFileConfig{Path: logFile, MaxSizeMB: 10},
+		CheckpointIntervalSeconds: 3600,
+		CheckpointKeyFile:         keyFile,
+	})
+	require.NoError(t, err)
+
+	for i := range count {
+		_, e := audit.Context(context.Background())
+		e.Path = "/token/" + string(rune('1'+i))
+		e.AuthExpirySecs = 1700000000
+		e.End(context.Background())()
+	}
+
+	// shutdown writes the final checkpoint
+	require.NoError(t, shutdown(context.Background()))
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+
+	return strings.Split(strings.TrimSpace(string(content)), "\n")
+}
+
+func verifyLines(t *testing.T, lines []string, opts audit.VerifyOptions) audit.VerifyReport {
+	t.Helper()
+
+	report, err := audit.Verify(strings.NewReader(strings.Join(lines, "\n")), opts)
+	require.NoError(t, err)
+
+	return report
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	return key
+}
@@ -0,0 +1,29 @@
+// Package awsarn validates the AWS resource names used to configure the
+// service.
+package awsarn
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// ValidateKMSKey checks that the ARN identifies a KMS key or alias.
+func ValidateKMSKey(keyARN string) error {
+	parsed, err := arn.Parse(keyARN)
+	if err != nil {
+		return fmt.Errorf("invalid KMS key ARN %q: %w", keyARN, err)
+	}
+
+	if parsed.Service != "kms" {
+		return fmt.Errorf("invalid KMS key ARN %q: service is %q, expected kms", keyARN, parsed.Service)
+	}
+
+	kind, id, _ := strings.Cut(parsed.Resource, "/")
+	if (kind != "key" && kind != "alias") || id == "" {
+		return fmt.Errorf("invalid KMS key ARN %q: resource must be key/<id> or alias/<name>", keyARN)
+	}
+
+	return nil
+}
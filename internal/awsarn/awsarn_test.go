@@ -0,0 +1,30 @@
+package awsarn_test
+
+import (
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/awsarn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateKMSKey(t *testing.T) {
+	cases := map[string]string{
+		"arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab": "",
+		"arn:aws:kms:us-east-1:123456789012:alias/github-app":                         "",
+		"arn:aws:s3:::bucket":                           `service is "s3", expected kms`,
+		"arn:aws:kms:us-east-1:123456789012:grant/1234": "resource must be key/<id> or alias/<name>",
+		"arn:aws:kms:us-east-1:123456789012:alias/":     "resource must be key/<id> or alias/<name>",
+		"1234abcd-12ab-34cd-56ef-1234567890ab":          "arn: invalid prefix",
+	}
+
+	for keyARN, expected := range cases {
+		t.Run(keyARN, func(t *testing.T) {
+			err := awsarn.ValidateKMSKey(keyARN)
+			if expected == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, expected)
+			}
+		})
+	}
+}
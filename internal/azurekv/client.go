@@ -0,0 +1,290 @@
+// Package azurekv is a minimal client for signing with Azure Key Vault keys.
+package azurekv
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiVersion           = "7.4"
+	resource             = "https://vault.azure.net"
+	defaultAuthorityHost = "https://login.microsoftonline.com/"
+	defaultIMDSEndpoint  = "http://169.254.169.254/metadata/identity/oauth2/token"
+)
+
+// requestTimeout bounds each request to Key Vault, including token requests.
+const requestTimeout = 10 * time.Second
+
+// Client signs digests with Key Vault keys. Credentials are found in the same
+// environment variables used by the Azure SDKs: a client secret
+// (AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET), then workload
+// identity (AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_FEDERATED_TOKEN_FILE),
+// and finally the managed identity of the host.
+type Client struct {
+	source func(ctx context.Context) (accessToken, error)
+
+	imdsEndpoint string
+
+	mu    sync.Mutex
+	token accessToken
+
+	now func() time.Time
+
+	// requests use the default transport, which is configured with telemetry
+	// at startup
+	client *http.Client
+}
+
+type accessToken struct {
+	value  string
+	expiry time.Time
+}
+
+// New creates a client using the credentials configured in the environment.
+// No request is made until the client is used.
+func New() (*Client, error) {
+	c := &Client{
+		imdsEndpoint: defaultIMDSEndpoint,
+		now:          time.Now,
+		client:       &http.Client{Timeout: requestTimeout},
+	}
+
+	tenant := os.Getenv("AZURE_TENANT_ID")
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = defaultAuthorityHost
+	}
+	tokenURL := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+
+	switch {
+	case tenant != "" && clientID != "" && os.Getenv("AZURE_CLIENT_SECRET") != "":
+		secret := os.Getenv("AZURE_CLIENT_SECRET")
+		c.source = func(ctx context.Context) (accessToken, error) {
+			return c.exchange(ctx, tokenURL, url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {clientID},
+				"client_secret": {secret},
+				"scope":         {resource + "/.default"},
+			})
+		}
+	case tenant != "" && clientID != "" && os.Getenv("AZURE_FEDERATED_TOKEN_FILE") != "":
+		tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+		c.source = func(ctx context.Context) (accessToken, error) {
+			// the federated token is read for each request, as it is rotated
+			// by the kubelet
+			assertion, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return accessToken{}, fmt.Errorf("could not read federated token: %w", err)
+			}
+
+			return c.exchange(ctx, tokenURL, url.Values{
+				"grant_type":            {"client_credentials"},
+				"client_id":             {clientID},
+				"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+				"client_assertion":      {strings.TrimSpace(string(assertion))},
+				"scope":                 {resource + "/.default"},
+			})
+		}
+	case tenant != "" && clientID != "":
+		return nil, errors.New("azurekv: AZURE_TENANT_ID and AZURE_CLIENT_ID are set, but neither AZURE_CLIENT_SECRET nor AZURE_FEDERATED_TOKEN_FILE is")
+	default:
+		// a user-assigned managed identity is selected by its client ID
+		c.source = func(ctx context.Context) (accessToken, error) {
+			return c.managedIdentityToken(ctx, clientID)
+		}
+	}
+
+	return c, nil
+}
+
+// Sign signs a SHA-256 digest with the key identified by its URL, for example
+// "https://example.vault.azure.net/keys/github-app/<version>", using RS256.
+// The latest version of the key is used if the URL has no version. The raw
+// signature is returned.
+func (c *Client) Sign(ctx context.Context, keyURL string, digest []byte) ([]byte, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]string{
+		"alg":   "RS256",
+		"value": base64.RawURLEncoding.EncodeToString(digest),
+	}
+
+	var response struct {
+		Value string `json:"value"`
+	}
+
+	u := strings.TrimSuffix(keyURL, "/") + "/sign?api-version=" + apiVersion
+	if err := c.send(ctx, u, token, request, &response); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(response.Value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("azurekv: could not decode signature: %w", err)
+	}
+
+	return signature, nil
+}
+
+// accessToken returns a cached access token, obtaining a new one shortly
+// before the current token expires.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.value != "" && c.now().Add(time.Minute).Before(c.token.expiry) {
+		return c.token.value, nil
+	}
+
+	token, err := c.source(ctx)
+	if err != nil {
+		return "", fmt.Errorf("azurekv: could not obtain access token: %w", err)
+	}
+
+	c.token = token
+
+	return token.value, nil
+}
+
+// tokenResponse is the OAuth 2.0 token response. The managed identity endpoint
+// returns the lifetime as a string.
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+func (c *Client) newToken(response tokenResponse) (accessToken, error) {
+	if response.AccessToken == "" {
+		return accessToken{}, errors.New("response has no access token")
+	}
+
+	expiresIn, err := response.ExpiresIn.Int64()
+	if err != nil {
+		return accessToken{}, fmt.Errorf("invalid token lifetime %q", response.ExpiresIn)
+	}
+
+	return accessToken{
+		value:  response.AccessToken,
+		expiry: c.now().Add(time.Duration(expiresIn) * time.Second),
+	}, nil
+}
+
+func (c *Client) exchange(ctx context.Context, tokenURL string, form url.Values) (accessToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return accessToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response tokenResponse
+	if err := c.do(req, &response); err != nil {
+		return accessToken{}, err
+	}
+
+	return c.newToken(response)
+}
+
+// managedIdentityToken obtains an access token for the host's managed identity
+// from the instance metadata service.
+func (c *Client) managedIdentityToken(ctx context.Context, clientID string) (accessToken, error) {
+	query := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {resource},
+	}
+	if clientID != "" {
+		query.Set("client_id", clientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.imdsEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return accessToken{}, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	var response tokenResponse
+	if err := c.do(req, &response); err != nil {
+		return accessToken{}, err
+	}
+
+	return c.newToken(response)
+}
+
+func (c *Client) send(ctx context.Context, u, token string, in, out any) error {
+	content, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, out)
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("azurekv: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseError(res)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("azurekv: could not decode response: %w", err)
+	}
+
+	return nil
+}
+
+// responseError describes an unsuccessful response, including the error
+// message of a Key Vault or Microsoft Entra error response.
+func responseError(res *http.Response) error {
+	var body struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}
+	_ = json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+
+	var message string
+
+	// Key Vault describes the error in an object, Entra ID with a string code
+	// and a description
+	var apiError struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body.Error, &apiError) == nil && apiError.Message != "" {
+		message = apiError.Message
+	} else if body.ErrorDescription != "" {
+		message = body.ErrorDescription
+	}
+
+	if message != "" {
+		return fmt.Errorf("azurekv: %s %s: %s: %s", res.Request.Method, res.Request.URL.Path, res.Status, message)
+	}
+
+	return fmt.Errorf("azurekv: %s %s: %s", res.Request.Method, res.Request.URL.Path, res.Status)
+}
@@ -0,0 +1,152 @@
+package azurekv
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKeyVault is a fake of the Key Vault sign API, and of the token endpoints
+// used to authenticate to it.
+type fakeKeyVault struct {
+	t *testing.T
+
+	tokens atomic.Int32
+	form   map[string]string
+	sign   map[string]string
+}
+
+func (f *fakeKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/tenant/oauth2/v2.0/token":
+		f.tokens.Add(1)
+		require.NoError(f.t, r.ParseForm())
+		f.form = map[string]string{}
+		for k := range r.PostForm {
+			f.form[k] = r.PostForm.Get(k)
+		}
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","access_token":"eyJ.entra","expires_in":3599}`))
+
+	case "/metadata/identity/oauth2/token":
+		f.tokens.Add(1)
+		assert.Equal(f.t, "true", r.Header.Get("Metadata"))
+		assert.Equal(f.t, resource, r.URL.Query().Get("resource"))
+		_, _ = w.Write([]byte(`{"access_token":"eyJ.imds","expires_in":"86399","resource":"https://vault.azure.net"}`))
+
+	case "/keys/github-app/v1/sign", "/keys/github-app/sign":
+		if r.Header.Get("Authorization") != "Bearer eyJ.entra" && r.Header.Get("Authorization") != "Bearer eyJ.imds" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"Unauthorized","message":"AKV10000: Request is missing a Bearer or PoP token."}}`))
+			return
+		}
+		assert.Equal(f.t, apiVersion, r.URL.Query().Get("api-version"))
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&f.sign))
+
+		_, _ = w.Write([]byte(`{"kid":"https://example.vault.azure.net/keys/github-app/v1","value":"` + base64.RawURLEncoding.EncodeToString([]byte("test_signature")) + `"}`))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":"KeyNotFound","message":"A key with (name/id) missing was not found in this key vault."}}`))
+	}
+}
+
+func setup(t *testing.T, env map[string]string) (*Client, *fakeKeyVault, string) {
+	t.Helper()
+
+	fake := &fakeKeyVault{t: t}
+	svr := httptest.NewServer(fake)
+	t.Cleanup(svr.Close)
+
+	for _, name := range []string{"AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_FEDERATED_TOKEN_FILE"} {
+		t.Setenv(name, env[name])
+	}
+	t.Setenv("AZURE_AUTHORITY_HOST", svr.URL)
+
+	c, err := New()
+	require.NoError(t, err)
+	c.imdsEndpoint = svr.URL + "/metadata/identity/oauth2/token"
+
+	return c, fake, svr.URL
+}
+
+func TestSign_ClientSecret(t *testing.T) {
+	c, fake, vaultURL := setup(t, map[string]string{
+		"AZURE_TENANT_ID":     "tenant",
+		"AZURE_CLIENT_ID":     "client",
+		"AZURE_CLIENT_SECRET": "secret",
+	})
+
+	digest := sha256.Sum256([]byte("header.claims"))
+
+	for range 2 {
+		signature, err := c.Sign(context.Background(), vaultURL+"/keys/github-app/v1", digest[:])
+		require.NoError(t, err)
+		assert.Equal(t, []byte("test_signature"), signature)
+	}
+
+	assert.Equal(t, map[string]string{
+		"alg":   "RS256",
+		"value": base64.RawURLEncoding.EncodeToString(digest[:]),
+	}, fake.sign)
+	assert.Equal(t, map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     "client",
+		"client_secret": "secret",
+		"scope":         "https://vault.azure.net/.default",
+	}, fake.form)
+	// the access token is reused
+	assert.Equal(t, int32(1), fake.tokens.Load())
+}
+
+func TestSign_WorkloadIdentity(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("federated-jwt\n"), 0o600))
+
+	c, fake, vaultURL := setup(t, map[string]string{
+		"AZURE_TENANT_ID":            "tenant",
+		"AZURE_CLIENT_ID":            "client",
+		"AZURE_FEDERATED_TOKEN_FILE": tokenFile,
+	})
+
+	_, err := c.Sign(context.Background(), vaultURL+"/keys/github-app", []byte("digest"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "federated-jwt", fake.form["client_assertion"])
+	assert.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", fake.form["client_assertion_type"])
+}
+
+func TestSign_ManagedIdentity(t *testing.T) {
+	c, fake, vaultURL := setup(t, nil)
+
+	signature, err := c.Sign(context.Background(), vaultURL+"/keys/github-app", []byte("digest"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("test_signature"), signature)
+	assert.Equal(t, int32(1), fake.tokens.Load())
+}
+
+func TestSign_ReportsAPIErrors(t *testing.T) {
+	c, _, vaultURL := setup(t, nil)
+
+	_, err := c.Sign(context.Background(), vaultURL+"/keys/missing", []byte("digest"))
+	assert.ErrorContains(t, err, "azurekv: POST /keys/missing/sign: 404 Not Found: A key with (name/id) missing was not found")
+}
+
+func TestNew_IncompleteCredentials(t *testing.T) {
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "client")
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+
+	_, err := New()
+	assert.ErrorContains(t, err, "neither AZURE_CLIENT_SECRET nor AZURE_FEDERATED_TOKEN_FILE is")
+}
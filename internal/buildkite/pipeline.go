@@ -6,22 +6,26 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"slices"
+	"sync/atomic"
 
 	"github.com/buildkite/go-buildkite/v3/buildkite"
 	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
 )
 
 type PipelineLookup struct {
-	token  string
+	// token is shared by copies of the lookup, so that a replaced token is used
+	// by all of them
+	token  *atomic.Pointer[string]
 	apiURL *url.URL
 }
 
 func New(cfg config.BuildkiteConfig) (p PipelineLookup, err error) {
-	if cfg.Token == "" {
-		err = errors.New("token must be configured for Buildkite API access")
+	p.token = &atomic.Pointer[string]{}
+	if err = p.SetToken(cfg.Token); err != nil {
 		return
 	}
-	p.token = cfg.Token
 
 	if cfg.ApiURL != "" {
 		u, perr := url.Parse(cfg.ApiURL)
@@ -35,6 +39,17 @@ func New(cfg config.BuildkiteConfig) (p PipelineLookup, err error) {
 	return
 }
 
+// SetToken replaces the API token used for subsequent requests.
+func (p PipelineLookup) SetToken(token string) error {
+	if token == "" {
+		return errors.New("token must be configured for Buildkite API access")
+	}
+
+	p.token.Store(&token)
+
+	return nil
+}
+
 func (p PipelineLookup) RepositoryLookup(ctx context.Context, organizationSlug, pipelineSlug string) (string, error) {
 	client := p.createClient(ctx)
 	pipeline, _, err := client.Pipelines.Get(organizationSlug, pipelineSlug)
@@ -48,9 +63,31 @@ func (p PipelineLookup) RepositoryLookup(ctx context.Context, organizationSlug,
 		return "", fmt.Errorf("no configured repository for pipeline %s/%s", organizationSlug, pipelineSlug)
 	}
 
+	logging.Ctx(ctx, "buildkite").Debug().
+		Str("organization", organizationSlug).
+		Str("pipeline", pipelineSlug).
+		Str("repository", *repo).
+		Msg("buildkite: pipeline repository found")
+
 	return *repo, nil
 }
 
+// CheckToken verifies that the configured API token is valid and has the
+// scope required to look up pipeline details.
+func (p PipelineLookup) CheckToken(ctx context.Context) error {
+	client := p.createClient(ctx)
+	token, _, err := client.AccessTokens.Get()
+	if err != nil {
+		return fmt.Errorf("failed to verify Buildkite API token: %w", err)
+	}
+
+	if token.Scopes == nil || !slices.Contains(*token.Scopes, "read_pipelines") {
+		return errors.New("Buildkite API token does not have the read_pipelines scope")
+	}
+
+	return nil
+}
+
 // createClient creates a new Buildkite API client. A client is required for
 // every invocation, so the current context can be included in the request.
 // Without this, HTTP client traces are not attached to their parent request.
@@ -63,7 +100,7 @@ func (p PipelineLookup) createClient(ctx context.Context) *buildkite.Client {
 	})
 
 	transport := buildkite.TokenAuthTransport{
-		APIToken:  p.token,
+		APIToken:  *p.token.Load(),
 		Transport: rt,
 	}
 
@@ -111,6 +111,39 @@ func TestRepositoryLookup_SendsAuthToken(t *testing.T) {
 	assert.Equal(t, "Bearer expected-token", actualToken)
 }
 
+func TestSetToken_ReplacesToken(t *testing.T) {
+	var actualToken string
+
+	router := http.NewServeMux()
+	router.HandleFunc("/v2/organizations/{organization}/pipelines/{pipeline}", func(w http.ResponseWriter, r *http.Request) {
+		actualToken = r.Header.Get("Authorization")
+
+		w.Header().Set("Content-Type", "application/json")
+		res, _ := json.Marshal(&api.Pipeline{Repository: api.String("urn:expected-repository-url")})
+		_, _ = w.Write(res)
+	})
+
+	svr := httptest.NewServer(router)
+	defer svr.Close()
+
+	bk, err := buildkite.New(config.BuildkiteConfig{
+		Token:  "first-token",
+		ApiURL: svr.URL,
+	})
+	require.NoError(t, err)
+
+	// the lookup is usually used as a method value, which copies the receiver
+	lookup := bk.RepositoryLookup
+
+	require.NoError(t, bk.SetToken("second-token"))
+	_, err = lookup(context.Background(), "expected-organization", "expected-pipeline")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer second-token", actualToken)
+
+	err = bk.SetToken("")
+	assert.ErrorContains(t, err, "token must be configured")
+}
+
 func TestRepositoryLookup_FailsWhenRepoNotConfigured(t *testing.T) {
 	router := http.NewServeMux()
 	router.HandleFunc("/v2/organizations/{organization}/pipelines/{pipeline}", func(w http.ResponseWriter, r *http.Request) {
@@ -163,3 +196,58 @@ func TestRepositoryLookup_Fails(t *testing.T) {
 	require.Error(t, err)
 	assert.ErrorContains(t, err, ": 418")
 }
+
+func TestCheckToken(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		scopes  []string
+		wantErr string
+	}{
+		{
+			name:   "valid with scope",
+			status: http.StatusOK,
+			scopes: []string{"read_builds", "read_pipelines"},
+		},
+		{
+			name:    "missing scope",
+			status:  http.StatusOK,
+			scopes:  []string{"read_builds"},
+			wantErr: "does not have the read_pipelines scope",
+		},
+		{
+			name:    "revoked token",
+			status:  http.StatusUnauthorized,
+			wantErr: ": 401",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := http.NewServeMux()
+			router.HandleFunc("/v2/access-token", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				res, _ := json.Marshal(&api.AccessToken{UUID: api.String("uuid"), Scopes: &tc.scopes})
+				_, _ = w.Write(res)
+			})
+
+			svr := httptest.NewServer(router)
+			defer svr.Close()
+
+			bk, err := buildkite.New(config.BuildkiteConfig{
+				Token:  "expected-token",
+				ApiURL: svr.URL,
+			})
+			require.NoError(t, err)
+
+			err = bk.CheckToken(context.Background())
+
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -2,61 +2,172 @@ package config
 
 import (
 	"context"
-
-	"github.com/sethvargo/go-envconfig"
+	"os"
 )
 
 type Config struct {
+	Audit         AuditConfig
 	Authorization AuthorizationConfig
 	Buildkite     BuildkiteConfig
+	File          FileConfig
 	Github        GithubConfig
+	Log           LogConfig
 	Observe       ObserveConfig
+	Secret        SecretConfig
 	Server        ServerConfig
+	Vault         VaultConfig
 }
 
 type ServerConfig struct {
-	Port                   int `env:"SERVER_PORT, default=8080"`
-	ShutdownTimeoutSeconds int `env:"SERVER_SHUTDOWN_TIMEOUT_SECS, default=25"`
+	Port                   int    `env:"SERVER_PORT, default=8080"`
+	TCPEnabled             bool   `env:"SERVER_TCP_ENABLED, default=true"`
+	UnixSocket             string `env:"SERVER_UNIX_SOCKET"`
+	UnixSocketMode         string `env:"SERVER_UNIX_SOCKET_MODE, default=0660"`
+	ShutdownTimeoutSeconds int    `env:"SERVER_SHUTDOWN_TIMEOUT_SECS, default=25"`
+	ReadinessCacheSeconds  int    `env:"SERVER_READINESS_CACHE_SECS, default=10"`
+
+	TLSCertFile              string   `env:"SERVER_TLS_CERT_FILE"`
+	TLSKeyFile               string   `env:"SERVER_TLS_KEY_FILE"`
+	TLSClientCAFile          string   `env:"SERVER_TLS_CLIENT_CA_FILE"`
+	TLSClientAllowedNames    []string `env:"SERVER_TLS_CLIENT_ALLOWED_NAMES"`
+	TLSReloadIntervalSeconds int      `env:"SERVER_TLS_RELOAD_INTERVAL_SECS, default=30"`
 
 	OutgoingHttpMaxIdleConns    int `env:"SERVER_OUTGOING_MAX_IDLE_CONNS, default=100"`
 	OutgoingHttpMaxConnsPerHost int `env:"SERVER_OUTGOING_MAX_CONNS_PER_HOST, default=20"`
 }
 
+type AuditConfig struct {
+	StdoutEnabled bool     `env:"AUDIT_STDOUT_ENABLED, default=true"`
+	Sinks         []string `env:"AUDIT_SINKS"`
+
+	CheckpointIntervalSeconds int    `env:"AUDIT_CHECKPOINT_INTERVAL_SECS, default=300"`
+	CheckpointKeyFile         string `env:"AUDIT_CHECKPOINT_KEY_FILE"`
+	CheckpointKeyARN          string `env:"AUDIT_CHECKPOINT_KEY_ARN"`
+
+	File   AuditFileConfig
+	Syslog AuditSyslogConfig
+	HTTP   AuditHTTPConfig
+}
+
+type AuditFileConfig struct {
+	Path                string `env:"AUDIT_FILE_PATH"`
+	Format              string `env:"AUDIT_FILE_FORMAT, default=json"`
+	MaxSizeMB           int    `env:"AUDIT_FILE_MAX_SIZE_MB, default=100"`
+	RotateIntervalHours int    `env:"AUDIT_FILE_ROTATE_INTERVAL_HOURS, default=24"`
+	MaxBackups          int    `env:"AUDIT_FILE_MAX_BACKUPS, default=10"`
+}
+
+type AuditSyslogConfig struct {
+	Network  string `env:"AUDIT_SYSLOG_NETWORK, default=udp"`
+	Address  string `env:"AUDIT_SYSLOG_ADDRESS"`
+	Format   string `env:"AUDIT_SYSLOG_FORMAT, default=json"`
+	Facility string `env:"AUDIT_SYSLOG_FACILITY, default=authpriv"`
+	AppName  string `env:"AUDIT_SYSLOG_APP_NAME, default=chinmina-bridge"`
+
+	BufferDir  string `env:"AUDIT_SYSLOG_BUFFER_DIR"`
+	MaxRetries int    `env:"AUDIT_SYSLOG_MAX_RETRIES, default=3"`
+}
+
+type AuditHTTPConfig struct {
+	URL                  string `env:"AUDIT_HTTP_URL"`
+	Format               string `env:"AUDIT_HTTP_FORMAT, default=json"`
+	AuthorizationHeader  string `env:"AUDIT_HTTP_AUTHORIZATION" secret:"true"`
+	BufferDir            string `env:"AUDIT_HTTP_BUFFER_DIR"`
+	BatchSize            int    `env:"AUDIT_HTTP_BATCH_SIZE, default=100"`
+	FlushIntervalSeconds int    `env:"AUDIT_HTTP_FLUSH_INTERVAL_SECS, default=5"`
+	MaxRetries           int    `env:"AUDIT_HTTP_MAX_RETRIES, default=3"`
+}
+
 type AuthorizationConfig struct {
 	Audience                  string `env:"JWT_AUDIENCE, default=app-token-issuer"`
 	BuildkiteOrganizationSlug string `env:"JWT_BUILDKITE_ORGANIZATION_SLUG, required"`
 	IssuerURL                 string `env:"JWT_ISSUER_URL, default=https://agent.buildkite.com"`
 	ConfigurationStatic       string `env:"JWT_JWKS_STATIC"`
+
+	JWKSURL                       string `env:"JWT_JWKS_URL"`
+	JWKSRefreshIntervalSeconds    int    `env:"JWT_JWKS_REFRESH_INTERVAL_SECS, default=300"`
+	JWKSMinRefreshIntervalSeconds int    `env:"JWT_JWKS_MIN_REFRESH_INTERVAL_SECS, default=15"`
+	JWKSFile                      string `env:"JWT_JWKS_FILE"`
+	JWKSFilePollIntervalSeconds   int    `env:"JWT_JWKS_FILE_POLL_INTERVAL_SECS, default=10"`
 }
 
 type BuildkiteConfig struct {
 	ApiURL string // internal only
-	Token  string `env:"BUILDKITE_API_TOKEN, required"`
+	Token  string `env:"BUILDKITE_API_TOKEN, required" secret:"true"`
+}
+
+type FileConfig struct {
+	Path                string `env:"CONFIG_FILE"`
+	PollIntervalSeconds int    `env:"CONFIG_FILE_POLL_INTERVAL_SECS, default=10"`
 }
 
 type GithubConfig struct {
 	ApiURL string // internal only
 
-	PrivateKey    string `env:"GITHUB_APP_PRIVATE_KEY"`
-	PrivateKeyARN string `env:"GITHUB_APP_PRIVATE_KEY_ARN"`
+	PrivateKey                string `env:"GITHUB_APP_PRIVATE_KEY" secret:"true"`
+	PrivateKeyARN             string `env:"GITHUB_APP_PRIVATE_KEY_ARN"`
+	PrivateKeyVaultTransitKey string `env:"GITHUB_APP_PRIVATE_KEY_VAULT_TRANSIT_KEY"`
+	PrivateKeyURI             string `env:"GITHUB_APP_PRIVATE_KEY_URI"`
+	PKCS11PIN                 string `env:"GITHUB_APP_PKCS11_PIN" secret:"true"`
+
+	SecondaryPrivateKey    string `env:"GITHUB_APP_SECONDARY_PRIVATE_KEY" secret:"true"`
+	SecondaryPrivateKeyARN string `env:"GITHUB_APP_SECONDARY_PRIVATE_KEY_ARN"`
 
 	ApplicationID  int64 `env:"GITHUB_APP_ID, required"`
 	InstallationID int64 `env:"GITHUB_APP_INSTALLATION_ID, required"`
+
+	SelfTestEnabled         bool `env:"GITHUB_SELF_TEST_ENABLED, default=true"`
+	SelfTestFatal           bool `env:"GITHUB_SELF_TEST_FATAL, default=false"`
+	SelfTestIntervalSeconds int  `env:"GITHUB_SELF_TEST_INTERVAL_SECS, default=3600"`
+}
+
+type LogConfig struct {
+	Level                string            `env:"LOG_LEVEL"`
+	Format               string            `env:"LOG_FORMAT"`
+	ComponentLevels      map[string]string `env:"LOG_COMPONENT_LEVELS"`
+	SampleInfoBurst      int               `env:"LOG_SAMPLE_INFO_BURST, default=0"`
+	SampleInfoPeriodSecs int               `env:"LOG_SAMPLE_INFO_PERIOD_SECS, default=1"`
+}
+
+type SecretConfig struct {
+	RefreshIntervalSeconds int `env:"SECRET_REFRESH_INTERVAL_SECS, default=300"`
+}
+
+type VaultConfig struct {
+	Address   string `env:"VAULT_ADDR"`
+	Token     string `env:"VAULT_TOKEN" secret:"true"`
+	Namespace string `env:"VAULT_NAMESPACE"`
+
+	AuthMethod          string `env:"VAULT_AUTH_METHOD, default=token"`
+	AuthMount           string `env:"VAULT_AUTH_MOUNT"`
+	AppRoleRoleID       string `env:"VAULT_APPROLE_ROLE_ID"`
+	AppRoleSecretID     string `env:"VAULT_APPROLE_SECRET_ID" secret:"true"`
+	KubernetesRole      string `env:"VAULT_KUBERNETES_ROLE"`
+	KubernetesTokenFile string `env:"VAULT_KUBERNETES_TOKEN_FILE, default=/var/run/secrets/kubernetes.io/serviceaccount/token"`
+
+	TransitMount string `env:"VAULT_TRANSIT_MOUNT, default=transit"`
 }
 
 type ObserveConfig struct {
-	SDKLogLevel                string `env:"OBSERVE_OTEL_LOG_LEVEL, default=info"`
-	Enabled                    bool   `env:"OBSERVE_ENABLED, default=false"`
-	MetricsEnabled             bool   `env:"OBSERVE_METRICS_ENABLED, default=true"`
-	Type                       string `env:"OBSERVE_TYPE, default=grpc"`
-	ServiceName                string `env:"OBSERVE_SERVICE_NAME, default=chinmina-bridge"`
-	TraceBatchTimeoutSeconds   int    `env:"OBSERVE_TRACE_BATCH_TIMEOUT_SECS, default=20"`
-	MetricReadIntervalSeconds  int    `env:"OBSERVE_METRIC_READ_INTERVAL_SECS, default=60"`
-	HttpTransportEnabled       bool   `env:"OBSERVE_HTTP_TRANSPORT_ENABLED, default=true"`
-	HttpConnectionTraceEnabled bool   `env:"OBSERVE_CONNECTION_TRACE_ENABLED, default=true"`
+	SDKLogLevel                string  `env:"OBSERVE_OTEL_LOG_LEVEL, default=info"`
+	Enabled                    bool    `env:"OBSERVE_ENABLED, default=false"`
+	MetricsEnabled             bool    `env:"OBSERVE_METRICS_ENABLED, default=true"`
+	MetricsPushEnabled         bool    `env:"OBSERVE_METRICS_PUSH_ENABLED, default=true"`
+	PrometheusEnabled          bool    `env:"OBSERVE_PROMETHEUS_ENABLED, default=false"`
+	TracesEnabled              bool    `env:"OBSERVE_TRACES_ENABLED, default=true"`
+	LogsEnabled                bool    `env:"OBSERVE_LOGS_ENABLED, default=false"`
+	Type                       string  `env:"OBSERVE_TYPE, default=grpc"`
+	ServiceName                string  `env:"OBSERVE_SERVICE_NAME, default=chinmina-bridge"`
+	TraceBatchTimeoutSeconds   int     `env:"OBSERVE_TRACE_BATCH_TIMEOUT_SECS, default=20"`
+	TraceSampleRatio           float64 `env:"OBSERVE_TRACE_SAMPLE_RATIO, default=1"`
+	ResourceDetectionEnabled   bool    `env:"OBSERVE_RESOURCE_DETECTION_ENABLED, default=true"`
+	MetricReadIntervalSeconds  int     `env:"OBSERVE_METRIC_READ_INTERVAL_SECS, default=60"`
+	HttpTransportEnabled       bool    `env:"OBSERVE_HTTP_TRANSPORT_ENABLED, default=true"`
+	HttpConnectionTraceEnabled bool    `env:"OBSERVE_CONNECTION_TRACE_ENABLED, default=true"`
 }
 
+// Load reads the configuration from the environment, and from the file named
+// by CONFIG_FILE if it is set.
 func Load(ctx context.Context) (cfg Config, err error) {
-	err = envconfig.Process(ctx, &cfg)
-	return
+	return LoadFile(ctx, os.Getenv("CONFIG_FILE"))
 }
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/sethvargo/go-envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSection is the configuration section that locates the configuration
+// file. It can only be set from the environment.
+const fileSection = "File"
+
+// LoadFile loads the configuration from the environment, and from the YAML or
+// TOML file at path if it is not empty. Environment variables take precedence
+// over values in the file, and defaults apply to values set in neither.
+//
+// The file has a section for each part of the configuration, containing the
+// settings of that section. Section and setting names match the configuration
+// fields, ignoring case, underscores and dashes:
+//
+//	log:
+//	  level: debug
+//	  componentLevels:
+//	    vendor: debug
+func LoadFile(ctx context.Context, path string) (cfg Config, err error) {
+	lookuper := envconfig.OsLookuper()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("could not read configuration file: %w", err)
+		}
+
+		values, err := parseFile(path, content)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+
+		// the first lookuper to find a value is used, so the environment wins
+		lookuper = envconfig.MultiLookuper(lookuper, envconfig.MapLookuper(values))
+	}
+
+	err = envconfig.ProcessWith(ctx, &envconfig.Config{
+		Target:   &cfg,
+		Lookuper: lookuper,
+	})
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.File.Path = path
+
+	return cfg, nil
+}
+
+// parseFile decodes the file according to its extension, returning its values
+// keyed by the environment variable that they correspond to.
+func parseFile(path string, content []byte) (map[string]string, error) {
+	document := map[string]any{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(content, &document); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported file extension %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+
+	values := map[string]string{}
+	if err := collectValues(reflect.TypeOf(Config{}), document, "", values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// collectValues matches the document keys to the fields of the struct type,
+// recursing into sections.
+func collectValues(t reflect.Type, document map[string]any, path string, values map[string]string) error {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		fields[normalizeKey(f.Name)] = f
+	}
+
+	for key, value := range document {
+		name := key
+		if path != "" {
+			name = path + "." + key
+		}
+
+		f, ok := fields[normalizeKey(key)]
+		if !ok || (path == "" && f.Name == fileSection) {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+
+		envName, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+
+		if envName == "" {
+			// fields without a variable are either sections, or internal only
+			if f.Type.Kind() != reflect.Struct {
+				return fmt.Errorf("unknown setting %q", name)
+			}
+
+			section, ok := value.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: expected a section", name)
+			}
+
+			if err := collectValues(f.Type, section, name, values); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		s, err := fileValue(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		values[envName] = s
+	}
+
+	return nil
+}
+
+// fileValue formats the value as envconfig expects it in an environment
+// variable: lists are comma separated, and maps are comma separated key:value
+// pairs. Values that contain a separator are rejected, as envconfig would split
+// them.
+func fileValue(value any) (string, error) {
+	switch v := value.(type) {
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalarValue(item)
+			if err != nil {
+				return "", err
+			}
+			if strings.Contains(s, ",") {
+				return "", fmt.Errorf("list item %q cannot contain a comma", s)
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+
+	case map[string]any:
+		pairs := make([]string, 0, len(v))
+		for k, item := range v {
+			s, err := scalarValue(item)
+			if err != nil {
+				return "", err
+			}
+			if strings.ContainsAny(k, ",:") {
+				return "", fmt.Errorf("key %q cannot contain a comma or colon", k)
+			}
+			if strings.Contains(s, ",") {
+				return "", fmt.Errorf("value %q of key %q cannot contain a comma", s, k)
+			}
+			pairs = append(pairs, k+":"+s)
+		}
+		sort.Strings(pairs)
+		return strings.Join(pairs, ","), nil
+
+	default:
+		return scalarValue(v)
+	}
+}
+
+func scalarValue(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// normalizeKey allows keys to be written in camel, snake or kebab case.
+func normalizeKey(key string) string {
+	key = strings.ReplaceAll(key, "_", "")
+	key = strings.ReplaceAll(key, "-", "")
+	return strings.ToLower(key)
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFile_YAML(t *testing.T) {
+	setRequiredEnv(t, "JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN")
+
+	path := writeFile(t, "config.yaml", `
+authorization:
+  buildkite_organization_slug: from-file
+  audience: app-audience
+buildkite:
+  token: from-file
+github:
+  application-id: 1234
+  installationId: 5678
+audit:
+  sinks: [file, http]
+  file:
+    path: /var/log/audit.log
+log:
+  level: debug
+  componentLevels:
+    vendor: trace
+    github: warn
+`)
+
+	cfg, err := LoadFile(context.Background(), path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "from-env", cfg.Authorization.BuildkiteOrganizationSlug, "environment takes precedence")
+	assert.Equal(t, "from-env", cfg.Buildkite.Token)
+	assert.Equal(t, "app-audience", cfg.Authorization.Audience)
+	assert.Equal(t, int64(1234), cfg.Github.ApplicationID)
+	assert.Equal(t, int64(5678), cfg.Github.InstallationID)
+	assert.Equal(t, []string{"file", "http"}, cfg.Audit.Sinks)
+	assert.Equal(t, "/var/log/audit.log", cfg.Audit.File.Path)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, map[string]string{"vendor": "trace", "github": "warn"}, cfg.Log.ComponentLevels)
+	assert.Equal(t, 8080, cfg.Server.Port, "defaults apply to unset values")
+	assert.Equal(t, path, cfg.File.Path)
+}
+
+func TestLoadFile_TOML(t *testing.T) {
+	path := writeFile(t, "config.toml", `
+[authorization]
+buildkite_organization_slug = "org"
+
+[buildkite]
+token = "token"
+
+[github]
+application_id = 1234
+installation_id = 5678
+
+[server]
+tcp_enabled = false
+`)
+
+	cfg, err := LoadFile(context.Background(), path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "org", cfg.Authorization.BuildkiteOrganizationSlug, "required values can be set in the file")
+	assert.Equal(t, "token", cfg.Buildkite.Token)
+	assert.Equal(t, int64(1234), cfg.Github.ApplicationID)
+	assert.False(t, cfg.Server.TCPEnabled)
+}
+
+func TestLoadFile_Invalid(t *testing.T) {
+	setRequiredEnv(t, "JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_INSTALLATION_ID")
+
+	cases := map[string]struct {
+		name     string
+		content  string
+		expected string
+	}{
+		"unknown section":  {"config.yaml", "profiles: {}", `unknown setting "profiles"`},
+		"unknown setting":  {"config.yaml", "log: {colour: red}", `unknown setting "log.colour"`},
+		"internal setting": {"config.yaml", "github: {apiurl: x}", `unknown setting "github.apiurl"`},
+		"file section":     {"config.yaml", "file: {path: other.yaml}", `unknown setting "file"`},
+		"not a section":    {"config.yaml", "log: debug", "log: expected a section"},
+		"nested value":     {"config.yaml", "audit: {sinks: [[file]]}", "audit.sinks: unsupported value"},
+		"comma in list":    {"config.yaml", `audit: {sinks: ["file,http"]}`, `audit.sinks: list item "file,http" cannot contain a comma`},
+		"comma in map":     {"config.yaml", `log: {componentLevels: {vendor: "debug,info"}}`, `log.componentLevels: value "debug,info" of key "vendor" cannot contain a comma`},
+		"colon in key":     {"config.yaml", `log: {componentLevels: {"a:b": debug}}`, `log.componentLevels: key "a:b" cannot contain a comma or colon`},
+		"syntax":           {"config.toml", "[log", "invalid configuration file"},
+		"extension":        {"config.json", "{}", `unsupported file extension ".json"`},
+		"type":             {"config.yaml", "server: {port: eighty}", `Port("eighty")`},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			path := writeFile(t, tc.name, tc.content)
+
+			_, err := LoadFile(context.Background(), path)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+func TestLoadFile_Missing(t *testing.T) {
+	_, err := LoadFile(context.Background(), filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "could not read configuration file")
+}
+
+func setRequiredEnv(t *testing.T, names ...string) {
+	t.Helper()
+
+	values := map[string]string{
+		"JWT_BUILDKITE_ORGANIZATION_SLUG": "from-env",
+		"BUILDKITE_API_TOKEN":             "from-env",
+		"GITHUB_APP_ID":                   "1",
+		"GITHUB_APP_INSTALLATION_ID":      "2",
+	}
+
+	for _, name := range names {
+		t.Setenv(name, values[name])
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
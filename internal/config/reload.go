@@ -0,0 +1,220 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// generation counts the configurations that have been applied by the process.
+// It is zero until a Reloader is created.
+var generation atomic.Uint64
+
+// Generation returns the generation of the configuration currently in use. It
+// starts at 1 for the configuration loaded at startup, and increases each time
+// a changed configuration is applied.
+func Generation() uint64 {
+	return generation.Load()
+}
+
+// Reloader reloads the configuration when SIGHUP is received, and when the
+// configuration file changes. The file is polled for the same reasons as the
+// JWKS file: it is robust to the symlink swaps used when Kubernetes updates
+// mounted volumes.
+//
+// A reloaded configuration is loaded and validated completely, then passed to
+// the apply function. If either fails, the configuration is rejected and the
+// current configuration remains in use. Only the log levels and sampling can be
+// changed without a restart: changes to other settings are reported, and take
+// effect when the process restarts. The generation only increases when a
+// reloadable setting changes.
+type Reloader struct {
+	apply func(Config) error
+
+	// digest, rejected and loaded are only accessed by the reload process,
+	// which is not concurrent. loaded is the configuration most recently
+	// loaded, including the settings that require a restart, so that each
+	// change is only reported once.
+	digest   []byte
+	rejected []byte
+	loaded   Config
+
+	current atomic.Pointer[Config]
+}
+
+// NewReloader creates a reloader for the configuration loaded at startup. The
+// apply function is called with each changed configuration, and must validate
+// it before making any change.
+func NewReloader(cfg Config, apply func(Config) error) (*Reloader, error) {
+	r := &Reloader{apply: apply, loaded: cfg}
+	r.current.Store(&cfg)
+
+	generation.Store(1)
+
+	_, err := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/config").Int64ObservableGauge(
+		"config.generation",
+		metric.WithDescription("The generation of the configuration in use, incremented on each successful reload"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(Generation()))
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("config generation metric creation failed: %w", err)
+	}
+
+	return r, nil
+}
+
+// Current returns the configuration in effect: the configuration loaded at
+// startup, with the reloadable settings most recently applied.
+func (r *Reloader) Current() Config {
+	return *r.current.Load()
+}
+
+// Run reloads the configuration until the context is cancelled.
+func (r *Reloader) Run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// without a file, only the signal can trigger a reload
+	var poll <-chan time.Time
+	if cfg := r.Current(); cfg.File.Path != "" {
+		interval := time.Duration(max(cfg.File.PollIntervalSeconds, 1)) * time.Second
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info().Msg("config: reload requested by SIGHUP")
+			r.report(r.reload(ctx, true))
+		case <-poll:
+			r.report(r.reload(ctx, false))
+		}
+	}
+}
+
+func (r *Reloader) report(err error) {
+	if err != nil {
+		log.Error().Err(err).Uint64("generation", Generation()).Msg("config: reload failed, retaining current configuration")
+	}
+}
+
+// reload loads the configuration and applies it if it has changed. Unless
+// forced, the configuration is only loaded when the file content has changed.
+func (r *Reloader) reload(ctx context.Context, force bool) error {
+	current := r.Current()
+	path := current.File.Path
+
+	var digest []byte
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("could not read configuration file: %w", err)
+		}
+
+		sum := sha256.Sum256(content)
+		digest = sum[:]
+
+		// Unchanged content needs no further processing. Content that has
+		// already been rejected is not reported again until it changes.
+		if !force && (bytes.Equal(r.digest, digest) || bytes.Equal(r.rejected, digest)) {
+			return nil
+		}
+	}
+
+	next, err := LoadFile(ctx, path)
+	if err != nil {
+		r.rejected = digest
+		return err
+	}
+
+	// the file location is fixed for the life of the process
+	next.File = current.File
+
+	r.digest = digest
+	r.rejected = nil
+
+	// Only the reloadable settings are applied. The others keep their current
+	// values until the process restarts, so the configuration in use (and its
+	// generation) reflects what is actually in effect.
+	applied := reloadable(current, next)
+
+	if !reflect.DeepEqual(current, applied) {
+		if err := r.apply(applied); err != nil {
+			r.rejected = digest
+			return fmt.Errorf("configuration rejected: %w", err)
+		}
+
+		r.current.Store(&applied)
+
+		gen := generation.Add(1)
+
+		log.Info().Uint64("generation", gen).Msg("config: configuration reloaded")
+	}
+
+	if changed := restartRequired(r.loaded, next); len(changed) > 0 {
+		log.Warn().
+			Strs("settings", changed).
+			Uint64("generation", Generation()).
+			Msg("config: changed settings take effect after a restart")
+	}
+
+	r.loaded = next
+
+	return nil
+}
+
+// reloadable returns the current configuration updated with the settings of
+// the next configuration that can be applied while the process is running.
+func reloadable(current, next Config) Config {
+	applied := current
+	applied.Log = next.Log
+	applied.Log.Format = current.Log.Format
+
+	return applied
+}
+
+// restartRequired returns the sections of the configuration that differ and
+// cannot be applied while the process is running. The log format is fixed
+// when the logger is created, but the remaining log settings can be reloaded.
+func restartRequired(current, next Config) []string {
+	var changed []string
+
+	if current.Log.Format != next.Log.Format {
+		changed = append(changed, "Log.Format")
+	}
+
+	cv := reflect.ValueOf(current)
+	nv := reflect.ValueOf(next)
+
+	for i := 0; i < cv.NumField(); i++ {
+		name := cv.Type().Field(i).Name
+		if name == "Log" {
+			continue
+		}
+
+		if !reflect.DeepEqual(cv.Field(i).Interface(), nv.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+
+	return changed
+}
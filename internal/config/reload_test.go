@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloader_AppliesChangedFile(t *testing.T) {
+	setRequiredEnv(t, "JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_INSTALLATION_ID")
+	ctx := context.Background()
+
+	path := writeFile(t, "config.yaml", "log: {level: info}")
+	cfg, err := LoadFile(ctx, path)
+	require.NoError(t, err)
+
+	var applied []Config
+	r, err := NewReloader(cfg, func(c Config) error {
+		applied = append(applied, c)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), Generation())
+
+	// unchanged content is not applied
+	require.NoError(t, r.reload(ctx, false))
+	assert.Empty(t, applied)
+
+	require.NoError(t, os.WriteFile(path, []byte("log: {level: debug}"), 0o600))
+	require.NoError(t, r.reload(ctx, false))
+
+	require.Len(t, applied, 1)
+	assert.Equal(t, "debug", applied[0].Log.Level)
+	assert.Equal(t, "debug", r.Current().Log.Level)
+	assert.Equal(t, uint64(2), Generation())
+
+	// a forced reload of the same content changes nothing
+	require.NoError(t, r.reload(ctx, true))
+	assert.Len(t, applied, 1)
+	assert.Equal(t, uint64(2), Generation())
+}
+
+func TestReloader_RestartOnlyChangesKeepGeneration(t *testing.T) {
+	setRequiredEnv(t, "JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_INSTALLATION_ID")
+	ctx := context.Background()
+
+	path := writeFile(t, "config.yaml", "log: {level: info, format: json}")
+	cfg, err := LoadFile(ctx, path)
+	require.NoError(t, err)
+
+	var applied []Config
+	r, err := NewReloader(cfg, func(c Config) error {
+		applied = append(applied, c)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// the log format is fixed for the life of the process
+	require.NoError(t, os.WriteFile(path, []byte("log: {level: info, format: console}"), 0o600))
+	require.NoError(t, r.reload(ctx, false))
+
+	assert.Empty(t, applied)
+	assert.Equal(t, "json", r.Current().Log.Format)
+	assert.Equal(t, uint64(1), Generation())
+
+	// only the reloadable part of a mixed change is applied
+	require.NoError(t, os.WriteFile(path, []byte("log: {level: debug, format: console}"), 0o600))
+	require.NoError(t, r.reload(ctx, false))
+
+	require.Len(t, applied, 1)
+	assert.Equal(t, "debug", applied[0].Log.Level)
+	assert.Equal(t, "json", applied[0].Log.Format)
+	assert.Equal(t, uint64(2), Generation())
+}
+
+func TestReloader_ReportsRestartChangesOnce(t *testing.T) {
+	setRequiredEnv(t, "JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_INSTALLATION_ID")
+	ctx := context.Background()
+
+	var logs bytes.Buffer
+	logger := log.Logger
+	log.Logger = zerolog.New(&logs)
+	t.Cleanup(func() { log.Logger = logger })
+
+	path := writeFile(t, "config.yaml", "server: {port: 8080}")
+	cfg, err := LoadFile(ctx, path)
+	require.NoError(t, err)
+
+	r, err := NewReloader(cfg, func(Config) error { return nil })
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("server: {port: 9090}"), 0o600))
+	require.NoError(t, r.reload(ctx, false))
+	assert.Equal(t, 1, strings.Count(logs.String(), "take effect after a restart"))
+
+	// reloading the same configuration again does not repeat the warning
+	require.NoError(t, r.reload(ctx, true))
+	assert.Equal(t, 1, strings.Count(logs.String(), "take effect after a restart"))
+
+	// the port still differs from the configuration in use
+	assert.Equal(t, 8080, r.Current().Server.Port)
+}
+
+func TestReloader_RejectsInvalidConfiguration(t *testing.T) {
+	setRequiredEnv(t, "JWT_BUILDKITE_ORGANIZATION_SLUG", "BUILDKITE_API_TOKEN", "GITHUB_APP_ID", "GITHUB_APP_INSTALLATION_ID")
+	ctx := context.Background()
+
+	path := writeFile(t, "config.yaml", "log: {level: info}")
+	cfg, err := LoadFile(ctx, path)
+	require.NoError(t, err)
+
+	r, err := NewReloader(cfg, func(c Config) error {
+		if c.Log.Level == "loud" {
+			return errors.New(`unknown log level "loud"`)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// fails to load
+	require.NoError(t, os.WriteFile(path, []byte("log: {colour: red}"), 0o600))
+	err = r.reload(ctx, false)
+	assert.ErrorContains(t, err, `unknown setting "log.colour"`)
+
+	// rejected content is not reported again until it changes
+	assert.NoError(t, r.reload(ctx, false))
+
+	// fails to apply
+	require.NoError(t, os.WriteFile(path, []byte("log: {level: loud}"), 0o600))
+	err = r.reload(ctx, false)
+	assert.ErrorContains(t, err, "configuration rejected")
+
+	assert.Equal(t, "info", r.Current().Log.Level)
+	assert.Equal(t, uint64(1), Generation())
+}
+
+func TestRestartRequired(t *testing.T) {
+	current := Config{Log: LogConfig{Level: "info", Format: "json"}}
+
+	next := current
+	next.Log.Level = "debug"
+	assert.Empty(t, restartRequired(current, next), "log levels are reloaded")
+
+	next.Log.Format = "console"
+	next.Server.Port = 9090
+	next.Audit.Sinks = []string{"file"}
+	assert.Equal(t, []string{"Log.Format", "Audit", "Server"}, restartRequired(current, next))
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// redacted replaces the value of secret settings in Settings.
+const redacted = "[REDACTED]"
+
+// Settings returns the configuration as nested sections of settings, in the
+// form read from a configuration file. The values of settings tagged as secret
+// are masked, and the file location and internal settings are omitted.
+func Settings(cfg Config) map[string]any {
+	settings := sectionSettings(reflect.ValueOf(cfg))
+	delete(settings, settingName(fileSection))
+
+	return settings
+}
+
+func sectionSettings(v reflect.Value) map[string]any {
+	settings := map[string]any{}
+
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		value := v.Field(i)
+
+		envName, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if envName == "" {
+			if f.Type.Kind() == reflect.Struct {
+				settings[settingName(f.Name)] = sectionSettings(value)
+			}
+			continue
+		}
+
+		if f.Tag.Get("secret") == "true" && !value.IsZero() {
+			settings[settingName(f.Name)] = redacted
+			continue
+		}
+
+		settings[settingName(f.Name)] = value.Interface()
+	}
+
+	return settings
+}
+
+// settingName converts a field name to snake case, keeping acronyms together:
+// "IssuerURL" becomes "issuer_url".
+func settingName(field string) string {
+	runes := []rune(field)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,359 @@
+// Package gcpkms is a minimal client for signing with Google Cloud KMS
+// asymmetric keys.
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	defaultEndpoint = "https://cloudkms.googleapis.com"
+	defaultMetadata = "metadata.google.internal"
+	scope           = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// requestTimeout bounds each request to Cloud KMS, including token requests.
+const requestTimeout = 10 * time.Second
+
+// Client signs digests with Cloud KMS keys. Credentials are found in the same
+// way as the Google Cloud client libraries (Application Default Credentials):
+// the file named by GOOGLE_APPLICATION_CREDENTIALS, then the credentials
+// written by "gcloud auth application-default login", and finally the
+// metadata server of the instance or workload.
+type Client struct {
+	endpoint string
+	source   func(ctx context.Context) (accessToken, error)
+
+	mu    sync.Mutex
+	token accessToken
+
+	now func() time.Time
+
+	// requests use the default transport, which is configured with telemetry
+	// at startup
+	client *http.Client
+}
+
+type accessToken struct {
+	value  string
+	expiry time.Time
+}
+
+// New creates a client using Application Default Credentials. The credentials
+// are located, but no request is made until the client is used.
+func New() (*Client, error) {
+	c := &Client{
+		endpoint: defaultEndpoint,
+		now:      time.Now,
+		client:   &http.Client{Timeout: requestTimeout},
+	}
+
+	path := credentialsFile()
+	if path == "" {
+		c.source = c.metadataToken
+		return c, nil
+	}
+
+	creds, err := readCredentials(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch creds.Type {
+	case "service_account":
+		c.source = func(ctx context.Context) (accessToken, error) {
+			return c.serviceAccountToken(ctx, creds)
+		}
+	case "authorized_user":
+		c.source = func(ctx context.Context) (accessToken, error) {
+			return c.userToken(ctx, creds)
+		}
+	default:
+		return nil, fmt.Errorf("gcpkms: unsupported credential type %q in %s", creds.Type, path)
+	}
+
+	return c, nil
+}
+
+// credentialsFile returns the path of the credentials file, or an empty string
+// if the metadata server is to be used.
+func credentialsFile() string {
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		return path
+	}
+
+	// gcloud writes its configuration to the same location on Linux and macOS
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(home, ".config", "gcloud", "application_default_credentials.json")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+// credentials holds the fields of a credentials file used by the supported
+// credential types.
+type credentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func readCredentials(path string) (credentials, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return credentials{}, fmt.Errorf("gcpkms: could not read credentials: %w", err)
+	}
+
+	var creds credentials
+	if err := json.Unmarshal(content, &creds); err != nil {
+		return credentials{}, fmt.Errorf("gcpkms: could not parse credentials in %s: %w", path, err)
+	}
+
+	if creds.TokenURI == "" {
+		creds.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	return creds, nil
+}
+
+// AsymmetricSign signs a SHA-256 digest with the key version, for example
+// "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+// The raw signature is returned.
+func (c *Client) AsymmetricSign(ctx context.Context, name string, digest []byte) ([]byte, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request := map[string]any{
+		"digest": map[string]string{
+			"sha256": base64.StdEncoding.EncodeToString(digest),
+		},
+	}
+
+	var response struct {
+		Signature string `json:"signature"`
+	}
+
+	u := c.endpoint + "/v1/" + name + ":asymmetricSign"
+	if err := c.send(ctx, http.MethodPost, u, token, request, &response); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(response.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("gcpkms: could not decode signature: %w", err)
+	}
+
+	return signature, nil
+}
+
+// accessToken returns a cached access token, obtaining a new one shortly
+// before the current token expires.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.value != "" && c.now().Add(time.Minute).Before(c.token.expiry) {
+		return c.token.value, nil
+	}
+
+	token, err := c.source(ctx)
+	if err != nil {
+		return "", fmt.Errorf("gcpkms: could not obtain access token: %w", err)
+	}
+
+	c.token = token
+
+	return token.value, nil
+}
+
+// tokenResponse is the OAuth 2.0 token response.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (c *Client) newToken(response tokenResponse) (accessToken, error) {
+	if response.AccessToken == "" {
+		return accessToken{}, errors.New("response has no access token")
+	}
+
+	return accessToken{
+		value:  response.AccessToken,
+		expiry: c.now().Add(time.Duration(response.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// serviceAccountToken exchanges a JWT signed with the service account key for
+// an access token.
+func (c *Client) serviceAccountToken(ctx context.Context, creds credentials) (accessToken, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(creds.PrivateKey))
+	if err != nil {
+		return accessToken{}, fmt.Errorf("could not parse service account key: %w", err)
+	}
+
+	now := c.now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   creds.ClientEmail,
+		"scope": scope,
+		"aud":   creds.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	assertion.Header["kid"] = creds.PrivateKeyID
+
+	signed, err := assertion.SignedString(key)
+	if err != nil {
+		return accessToken{}, err
+	}
+
+	return c.exchange(ctx, creds.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signed},
+	})
+}
+
+// userToken uses the refresh token of a user's credentials to obtain an
+// access token.
+func (c *Client) userToken(ctx context.Context, creds credentials) (accessToken, error) {
+	return c.exchange(ctx, creds.TokenURI, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {creds.ClientID},
+		"client_secret": {creds.ClientSecret},
+		"refresh_token": {creds.RefreshToken},
+	})
+}
+
+func (c *Client) exchange(ctx context.Context, tokenURI string, form url.Values) (accessToken, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return accessToken{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response tokenResponse
+	if err := c.do(req, &response); err != nil {
+		return accessToken{}, err
+	}
+
+	return c.newToken(response)
+}
+
+// metadataToken obtains an access token for the instance's service account
+// from the metadata server. GCE_METADATA_HOST overrides the server address, as
+// it does for the Google Cloud client libraries.
+func (c *Client) metadataToken(ctx context.Context) (accessToken, error) {
+	host := os.Getenv("GCE_METADATA_HOST")
+	if host == "" {
+		host = defaultMetadata
+	}
+
+	u := "http://" + host + "/computeMetadata/v1/instance/service-accounts/default/token?scopes=" + url.QueryEscape(scope)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return accessToken{}, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	var response tokenResponse
+	if err := c.do(req, &response); err != nil {
+		return accessToken{}, err
+	}
+
+	return c.newToken(response)
+}
+
+func (c *Client) send(ctx context.Context, method, u, token string, in, out any) error {
+	content, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.do(req, out)
+}
+
+func (c *Client) do(req *http.Request, out any) error {
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gcpkms: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseError(res)
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("gcpkms: could not decode response: %w", err)
+	}
+
+	return nil
+}
+
+// responseError describes an unsuccessful response, including the error
+// message of a Google API or OAuth error response.
+func responseError(res *http.Response) error {
+	var body struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}
+	_ = json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+
+	var message string
+
+	// Google APIs describe the error in an object, OAuth with a string code
+	// and a description
+	var apiError struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body.Error, &apiError) == nil && apiError.Message != "" {
+		message = apiError.Message
+	} else if body.ErrorDescription != "" {
+		message = body.ErrorDescription
+	}
+
+	if message != "" {
+		return fmt.Errorf("gcpkms: %s %s: %s: %s", res.Request.Method, res.Request.URL.Path, res.Status, message)
+	}
+
+	return fmt.Errorf("gcpkms: %s %s: %s", res.Request.Method, res.Request.URL.Path, res.Status)
+}
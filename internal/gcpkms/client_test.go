@@ -0,0 +1,188 @@
+package gcpkms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/github-app/cryptoKeyVersions/1"
+
+// fakeKMS is a fake of the Cloud KMS asymmetricSign API, and of the OAuth
+// token and metadata endpoints used to authenticate to it.
+type fakeKMS struct {
+	t         *testing.T
+	saKey     *rsa.PrivateKey
+	signature []byte
+
+	tokens atomic.Int32
+	digest string
+}
+
+func (f *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/token":
+		f.tokens.Add(1)
+		require.NoError(f.t, r.ParseForm())
+
+		switch r.Form.Get("grant_type") {
+		case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+			claims := jwt.MapClaims{}
+			_, err := jwt.ParseWithClaims(r.Form.Get("assertion"), claims, func(*jwt.Token) (any, error) {
+				return &f.saKey.PublicKey, nil
+			})
+			require.NoError(f.t, err)
+			assert.Equal(f.t, "chinmina@p.iam.gserviceaccount.com", claims["iss"])
+			assert.Equal(f.t, scope, claims["scope"])
+		case "refresh_token":
+			assert.Equal(f.t, "refresh", r.Form.Get("refresh_token"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"unsupported_grant_type","error_description":"grant type not supported"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"ya29.token","expires_in":3600}`))
+
+	case "/computeMetadata/v1/instance/service-accounts/default/token":
+		f.tokens.Add(1)
+		assert.Equal(f.t, "Google", r.Header.Get("Metadata-Flavor"))
+		assert.Equal(f.t, scope, r.URL.Query().Get("scopes"))
+		_, _ = w.Write([]byte(`{"access_token":"ya29.metadata","expires_in":3600}`))
+
+	case "/v1/" + keyName + ":asymmetricSign":
+		if r.Header.Get("Authorization") != "Bearer ya29.token" && r.Header.Get("Authorization") != "Bearer ya29.metadata" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":401,"message":"Request had invalid authentication credentials."}}`))
+			return
+		}
+
+		var body struct {
+			Digest struct {
+				SHA256 string `json:"sha256"`
+			} `json:"digest"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&body))
+		f.digest = body.Digest.SHA256
+
+		_, _ = w.Write([]byte(`{"signature":"` + base64.StdEncoding.EncodeToString(f.signature) + `","name":"` + keyName + `"}`))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":{"code":404,"message":"not found"}}`))
+	}
+}
+
+func setup(t *testing.T, credentials map[string]string) (*Client, *fakeKMS) {
+	t.Helper()
+
+	saKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	fake := &fakeKMS{t: t, saKey: saKey, signature: []byte("test_signature")}
+	svr := httptest.NewServer(fake)
+	t.Cleanup(svr.Close)
+
+	// no gcloud credentials are found in the home directory
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+
+	u, _ := url.Parse(svr.URL)
+	t.Setenv("GCE_METADATA_HOST", u.Host)
+
+	if credentials != nil {
+		credentials["token_uri"] = svr.URL + "/token"
+		if credentials["type"] == "service_account" {
+			credentials["private_key"] = string(pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: x509.MarshalPKCS1PrivateKey(saKey),
+			}))
+		}
+
+		content, err := json.Marshal(credentials)
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "credentials.json")
+		require.NoError(t, os.WriteFile(path, content, 0o600))
+		t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+	}
+
+	c, err := New()
+	require.NoError(t, err)
+	c.endpoint = svr.URL
+
+	return c, fake
+}
+
+func TestAsymmetricSign_ServiceAccount(t *testing.T) {
+	c, fake := setup(t, map[string]string{
+		"type":           "service_account",
+		"client_email":   "chinmina@p.iam.gserviceaccount.com",
+		"private_key_id": "key-id",
+	})
+
+	digest := sha256.Sum256([]byte("header.claims"))
+
+	for range 2 {
+		signature, err := c.AsymmetricSign(context.Background(), keyName, digest[:])
+		require.NoError(t, err)
+		assert.Equal(t, []byte("test_signature"), signature)
+	}
+
+	assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), fake.digest)
+	// the access token is reused
+	assert.Equal(t, int32(1), fake.tokens.Load())
+}
+
+func TestAsymmetricSign_AuthorizedUser(t *testing.T) {
+	c, _ := setup(t, map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "client",
+		"client_secret": "secret",
+		"refresh_token": "refresh",
+	})
+
+	signature, err := c.AsymmetricSign(context.Background(), keyName, []byte("digest"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("test_signature"), signature)
+}
+
+func TestAsymmetricSign_MetadataServer(t *testing.T) {
+	c, fake := setup(t, nil)
+
+	signature, err := c.AsymmetricSign(context.Background(), keyName, []byte("digest"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("test_signature"), signature)
+	assert.Equal(t, int32(1), fake.tokens.Load())
+}
+
+func TestAsymmetricSign_ReportsAPIErrors(t *testing.T) {
+	c, _ := setup(t, nil)
+
+	_, err := c.AsymmetricSign(context.Background(), "projects/p/missing", []byte("digest"))
+	assert.ErrorContains(t, err, "gcpkms: POST /v1/projects/p/missing:asymmetricSign: 404 Not Found: not found")
+}
+
+func TestNew_UnsupportedCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"type":"external_account"}`), 0o600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", path)
+
+	_, err := New()
+	assert.ErrorContains(t, err, `unsupported credential type "external_account"`)
+}
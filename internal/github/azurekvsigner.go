@@ -0,0 +1,42 @@
+package github
+
+import (
+	"context"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+)
+
+var _ ghinstallation.Signer = AzureKeyVaultSigner{}
+
+// AzureKeyVaultClient defines the Azure Key Vault API required by the
+// AzureKeyVaultSigner.
+type AzureKeyVaultClient interface {
+	Sign(ctx context.Context, keyURL string, digest []byte) ([]byte, error)
+}
+
+// AzureKeyVaultSigner defines a Signer compatible with the ghinstallation
+// plugin that uses an Azure Key Vault RSA key to sign the JWT.
+type AzureKeyVaultSigner struct {
+	KeyURL string
+	Method jwt.SigningMethod
+}
+
+func NewAzureKeyVaultSigner(client AzureKeyVaultClient, keyURL string) AzureKeyVaultSigner {
+	return AzureKeyVaultSigner{
+		KeyURL: keyURL,
+		Method: remoteRS256{
+			service: "Key Vault",
+			sign: func(ctx context.Context, digest []byte) ([]byte, error) {
+				return client.Sign(ctx, keyURL, digest)
+			},
+		},
+	}
+}
+
+func (s AzureKeyVaultSigner) Sign(claims jwt.Claims) (string, error) {
+	defer functionDuration(func(l zerolog.Logger) { l.Info().Msg("AzureKeyVaultSigner.Sign()") })()
+
+	return jwt.NewWithClaims(s.Method, claims).SignedString(s.KeyURL)
+}
@@ -0,0 +1,11 @@
+package github_test
+
+import "context"
+
+type AzureKeyVaultClientFunc func(ctx context.Context, keyURL string, digest []byte) ([]byte, error)
+
+func (f AzureKeyVaultClientFunc) Sign(ctx context.Context, keyURL string, digest []byte) ([]byte, error) {
+	return f(ctx, keyURL, digest)
+}
+
+const azureKeyURL = "https://example.vault.azure.net/keys/github-app"
@@ -0,0 +1,42 @@
+package github
+
+import (
+	"context"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+)
+
+var _ ghinstallation.Signer = GCPKMSSigner{}
+
+// GCPKMSClient defines the Google Cloud KMS API required by the GCPKMSSigner.
+type GCPKMSClient interface {
+	AsymmetricSign(ctx context.Context, name string, digest []byte) ([]byte, error)
+}
+
+// GCPKMSSigner defines a Signer compatible with the ghinstallation plugin that
+// uses a Google Cloud KMS key to sign the JWT. The key version must have the
+// RSA_SIGN_PKCS1_2048_SHA256 algorithm.
+type GCPKMSSigner struct {
+	Name   string
+	Method jwt.SigningMethod
+}
+
+func NewGCPKMSSigner(client GCPKMSClient, name string) GCPKMSSigner {
+	return GCPKMSSigner{
+		Name: name,
+		Method: remoteRS256{
+			service: "Cloud KMS",
+			sign: func(ctx context.Context, digest []byte) ([]byte, error) {
+				return client.AsymmetricSign(ctx, name, digest)
+			},
+		},
+	}
+}
+
+func (s GCPKMSSigner) Sign(claims jwt.Claims) (string, error) {
+	defer functionDuration(func(l zerolog.Logger) { l.Info().Msg("GCPKMSSigner.Sign()") })()
+
+	return jwt.NewWithClaims(s.Method, claims).SignedString(s.Name)
+}
@@ -0,0 +1,39 @@
+package github_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/stretchr/testify/assert"
+)
+
+type GCPKMSClientFunc func(ctx context.Context, name string, digest []byte) ([]byte, error)
+
+func (f GCPKMSClientFunc) AsymmetricSign(ctx context.Context, name string, digest []byte) ([]byte, error) {
+	return f(ctx, name, digest)
+}
+
+const gcpKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/github-app/cryptoKeyVersions/1"
+
+func TestNew_SucceedsWithKeyURI(t *testing.T) {
+	// credentials are located, but no request is made
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("AZURE_TENANT_ID", "")
+	t.Setenv("AZURE_CLIENT_ID", "")
+
+	uris := []string{
+		"gcpkms://" + gcpKeyName,
+		"azurekms://example.vault.azure.net/github-app",
+	}
+
+	for _, uri := range uris {
+		_, err := github.New(context.Background(), config.GithubConfig{PrivateKeyURI: uri})
+		assert.NoError(t, err, uri)
+	}
+
+	_, err := github.New(context.Background(), config.GithubConfig{PrivateKeyURI: "awskms:///alias/github-app"})
+	assert.ErrorContains(t, err, `invalid key URI "awskms:///alias/github-app"`)
+}
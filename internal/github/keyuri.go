@@ -0,0 +1,110 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/jamestelfer/chinmina-bridge/internal/azurekv"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/gcpkms"
+	"github.com/jamestelfer/chinmina-bridge/internal/pkcs11"
+)
+
+// The schemes of key URIs, which identify the service holding the key.
+const (
+	gcpKMSScheme   = "gcpkms://"
+	azureKMSScheme = "azurekms://"
+	pkcs11Scheme   = pkcs11.Scheme
+)
+
+var gcpKeyVersionName = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+/cryptoKeyVersions/[^/]+$`)
+
+// ValidateKeyURI checks that the URI identifies a key in a supported service:
+//
+//   - gcpkms://projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>
+//   - azurekms://<vault>.vault.azure.net/<key>[/<version>]
+//   - pkcs11:token=<token>;object=<key>?module-path=<module>[&pin-source=<file>]
+func ValidateKeyURI(uri string) error {
+	_, _, err := parseKeyURI(uri)
+	return err
+}
+
+// parseKeyURI returns the scheme of the URI, and the identifier of the key
+// used by the service's API.
+func parseKeyURI(uri string) (string, string, error) {
+	if name, ok := strings.CutPrefix(uri, gcpKMSScheme); ok {
+		if !gcpKeyVersionName.MatchString(name) {
+			return "", "", fmt.Errorf("invalid key URI %q: expected %sprojects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>/cryptoKeyVersions/<version>", uri, gcpKMSScheme)
+		}
+
+		return gcpKMSScheme, name, nil
+	}
+
+	if rest, ok := strings.CutPrefix(uri, azureKMSScheme); ok {
+		host, key, _ := strings.Cut(rest, "/")
+		name, version, _ := strings.Cut(key, "/")
+		if host == "" || name == "" || strings.Contains(version, "/") {
+			return "", "", fmt.Errorf("invalid key URI %q: expected %s<vault>.vault.azure.net/<key>[/<version>]", uri, azureKMSScheme)
+		}
+
+		keyURL := "https://" + host + "/keys/" + name
+		if version != "" {
+			keyURL += "/" + version
+		}
+
+		return azureKMSScheme, keyURL, nil
+	}
+
+	if strings.HasPrefix(uri, pkcs11Scheme) {
+		if _, err := pkcs11.ParseURI(uri); err != nil {
+			return "", "", err
+		}
+		if !pkcs11.Supported {
+			return "", "", errors.New("PKCS #11 support is not included in this build: build with CGO_ENABLED=1 and -tags pkcs11")
+		}
+
+		return pkcs11Scheme, uri, nil
+	}
+
+	return "", "", fmt.Errorf("invalid key URI %q: expected a %s, %s or %s URI", uri, gcpKMSScheme, azureKMSScheme, pkcs11Scheme)
+}
+
+// newKeyURISigner creates a signer for the key identified by the URI, using
+// the credentials available to the process for the key's service. A PKCS #11
+// token is logged in to with the PIN given by the URI, or by
+// GITHUB_APP_PKCS11_PIN.
+func newKeyURISigner(cfg config.GithubConfig) (ghinstallation.Signer, error) {
+	scheme, key, err := parseKeyURI(cfg.PrivateKeyURI)
+	if err != nil {
+		return nil, err
+	}
+
+	switch scheme {
+	case pkcs11Scheme:
+		hsmCfg, _ := pkcs11.ParseURI(key)
+		if hsmCfg.PIN == "" && hsmCfg.PINSource == "" {
+			hsmCfg.PIN = cfg.PKCS11PIN
+		}
+
+		module, err := pkcs11.Open(hsmCfg)
+		if err != nil {
+			return nil, err
+		}
+		return NewPKCS11Signer(module), nil
+	case gcpKMSScheme:
+		client, err := gcpkms.New()
+		if err != nil {
+			return nil, err
+		}
+		return NewGCPKMSSigner(client, key), nil
+	default:
+		client, err := azurekv.New()
+		if err != nil {
+			return nil, err
+		}
+		return NewAzureKeyVaultSigner(client, key), nil
+	}
+}
@@ -0,0 +1,72 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/pkcs11"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyURI(t *testing.T) {
+	cases := map[string]struct {
+		scheme string
+		key    string
+		err    string
+	}{
+		"gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1": {
+			scheme: gcpKMSScheme,
+			key:    "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+		},
+		"gcpkms://projects/p/locations/global/keyRings/r/cryptoKeys/k": {
+			err: "expected gcpkms://projects/<project>",
+		},
+		"azurekms://example.vault.azure.net/github-app": {
+			scheme: azureKMSScheme,
+			key:    "https://example.vault.azure.net/keys/github-app",
+		},
+		"azurekms://example.vault.azure.net/github-app/0123abcd": {
+			scheme: azureKMSScheme,
+			key:    "https://example.vault.azure.net/keys/github-app/0123abcd",
+		},
+		"azurekms://example.vault.azure.net": {
+			err: "expected azurekms://<vault>.vault.azure.net/<key>[/<version>]",
+		},
+		"azurekms://example.vault.azure.net/keys/github-app/0123abcd": {
+			err: "expected azurekms://<vault>.vault.azure.net/<key>[/<version>]",
+		},
+		"awskms:///alias/github-app": {
+			err: "expected a gcpkms://, azurekms:// or pkcs11: URI",
+		},
+		"pkcs11:token=chinmina;object=github-app": {
+			err: "module-path is required",
+		},
+	}
+
+	for uri, expected := range cases {
+		t.Run(uri, func(t *testing.T) {
+			scheme, key, err := parseKeyURI(uri)
+			if expected.err != "" {
+				assert.ErrorContains(t, err, expected.err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, expected.scheme, scheme)
+			assert.Equal(t, expected.key, key)
+		})
+	}
+}
+
+func TestParseKeyURI_PKCS11(t *testing.T) {
+	uri := "pkcs11:token=chinmina;object=github-app?module-path=/usr/lib/softhsm/libsofthsm2.so"
+
+	scheme, key, err := parseKeyURI(uri)
+	if !pkcs11.Supported {
+		assert.ErrorContains(t, err, "PKCS #11 support is not included in this build")
+		return
+	}
+
+	assert.NoError(t, err)
+	assert.Equal(t, pkcs11Scheme, scheme)
+	assert.Equal(t, uri, key)
+}
@@ -2,10 +2,7 @@ package github
 
 import (
 	"context"
-	"crypto"
-	"encoding/base64"
 	"errors"
-	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,12 +11,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/kms/types"
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
-
-	// Explicitly import this to ensure the hash is available. This allows us to
-	// assume that crypto.SHA256.Available() will return true.
-	_ "crypto/sha256"
 )
 
 var _ ghinstallation.Signer = KMSSigner{}
@@ -68,15 +61,11 @@ func (s KMSSigner) Sign(claims jwt.Claims) (string, error) {
 // Defines a golang-jwt compatible signing method that uses AWS KMS.
 type KMSSigningMethod struct {
 	client KMSClient
-	hash   crypto.Hash
 }
 
 func NewSigningMethod(client KMSClient) KMSSigningMethod {
-	alg := crypto.SHA256
-
 	return KMSSigningMethod{
 		client: client,
-		hash:   alg,
 	}
 }
 
@@ -95,32 +84,7 @@ func (k KMSSigningMethod) Sign(signingString string, key any) (string, error) {
 		return "", errors.New("unexpected key type supplied (string expected)")
 	}
 
-	// create a digest of the source material, ensuring that the data sent to AWS
-	// is both anonymous and a constant size.
-	hasher := k.hash.New()
-	hasher.Write([]byte(signingString))
-	digest := hasher.Sum(nil)
-
-	// Use KMS to sign the digest with the given ARN.
-	//
-	// Note: there is an outstanding PR on ghinstallation to allow this method to
-	// pass a context: https://github.com/bradleyfalzon/ghinstallation/pull/119
-	result, err := k.client.Sign(context.Background(), &kms.SignInput{
-		KeyId:            aws.String(keyArn),
-		SigningAlgorithm: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
-		MessageType:      types.MessageTypeDigest,
-		Message:          digest,
-	})
-	if err != nil {
-		return "", fmt.Errorf("KMS signing failed: %w", err)
-	}
-
-	// Return the base64 encoded signature. The JWT spec defines that no base64
-	// padding should be included, so RawURLEncoding is used.
-	sig := result.Signature
-	encodedSig := base64.RawURLEncoding.EncodeToString(sig)
-
-	return encodedSig, nil
+	return k.remote(keyArn).Sign(signingString, keyArn)
 }
 
 func (k KMSSigningMethod) Verify(signingString string, signature string, key interface{}) error {
@@ -129,11 +93,31 @@ func (k KMSSigningMethod) Verify(signingString string, signature string, key int
 	return errors.New("not implemented")
 }
 
+// remote returns the signing method that signs with the given key.
+func (k KMSSigningMethod) remote(keyArn string) remoteRS256 {
+	return remoteRS256{
+		service: "KMS",
+		sign: func(ctx context.Context, digest []byte) ([]byte, error) {
+			result, err := k.client.Sign(ctx, &kms.SignInput{
+				KeyId:            aws.String(keyArn),
+				SigningAlgorithm: types.SigningAlgorithmSpecRsassaPkcs1V15Sha256,
+				MessageType:      types.MessageTypeDigest,
+				Message:          digest,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return result.Signature, nil
+		},
+	}
+}
+
 func functionDuration(l func(zerolog.Logger)) func() {
 	start := time.Now()
 
 	return func() {
 		d := time.Since(start)
-		l(log.With().Dur("duration", d).Logger())
+		l(logging.Component("github").With().Dur("duration", d).Logger())
 	}
 }
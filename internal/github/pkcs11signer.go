@@ -0,0 +1,40 @@
+package github
+
+import (
+	"context"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+)
+
+var _ ghinstallation.Signer = PKCS11Signer{}
+
+// PKCS11Key defines a private key held in a PKCS #11 token, as required by the
+// PKCS11Signer.
+type PKCS11Key interface {
+	SignDigest(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// PKCS11Signer defines a Signer compatible with the ghinstallation plugin that
+// signs the JWT with a non-exportable RSA key held in an HSM.
+type PKCS11Signer struct {
+	Key    PKCS11Key
+	Method jwt.SigningMethod
+}
+
+func NewPKCS11Signer(key PKCS11Key) PKCS11Signer {
+	return PKCS11Signer{
+		Key: key,
+		Method: remoteRS256{
+			service: "PKCS #11",
+			sign:    key.SignDigest,
+		},
+	}
+}
+
+func (s PKCS11Signer) Sign(claims jwt.Claims) (string, error) {
+	defer functionDuration(func(l zerolog.Logger) { l.Info().Msg("PKCS11Signer.Sign()") })()
+
+	return jwt.NewWithClaims(s.Method, claims).SignedString(s.Key)
+}
@@ -0,0 +1,9 @@
+package github_test
+
+import "context"
+
+type PKCS11KeyFunc func(ctx context.Context, digest []byte) ([]byte, error)
+
+func (f PKCS11KeyFunc) SignDigest(ctx context.Context, digest []byte) ([]byte, error) {
+	return f(ctx, digest)
+}
@@ -0,0 +1,63 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	// Explicitly import this to ensure the hash is available. This allows us to
+	// assume that crypto.SHA256.Available() will return true.
+	_ "crypto/sha256"
+)
+
+var _ jwt.SigningMethod = remoteRS256{}
+
+// remoteRS256 is a golang-jwt compatible signing method for an RSA key held by
+// a remote service, such as a key management service or an HSM. The signing
+// string is hashed locally, so that the data sent to the service is both
+// anonymous and a constant size, and the service signs the SHA-256 digest with
+// RSASSA-PKCS1-v1_5.
+type remoteRS256 struct {
+	// service names the key service in errors.
+	service string
+
+	// sign returns the signature of the digest. The key is bound by the
+	// backend: the key passed to the signing method is not used.
+	sign func(ctx context.Context, digest []byte) ([]byte, error)
+}
+
+// Alg returns the signing algorithm allowed for this method, which is "RS256".
+func (m remoteRS256) Alg() string {
+	return "RS256"
+}
+
+// Sign hashes the signing string and has the remote service sign the digest.
+func (m remoteRS256) Sign(signingString string, _ any) (string, error) {
+	hasher := crypto.SHA256.New()
+	hasher.Write([]byte(signingString))
+	digest := hasher.Sum(nil)
+
+	// Note: there is an outstanding PR on ghinstallation to allow this method to
+	// pass a context: https://github.com/bradleyfalzon/ghinstallation/pull/119
+	ctx, cancel := context.WithTimeout(context.Background(), jwtSignTimeout)
+	defer cancel()
+
+	signature, err := m.sign(ctx, digest)
+	if err != nil {
+		return "", fmt.Errorf("%s signing failed: %w", m.service, err)
+	}
+
+	// The JWT spec defines that no base64 padding should be included, so
+	// RawURLEncoding is used.
+	return base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func (m remoteRS256) Verify(signingString string, signature string, key interface{}) error {
+	// Not implemented as we are only signing JWTs for GitHub access, not
+	// verifying them
+	return errors.New("not implemented")
+}
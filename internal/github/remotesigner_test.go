@@ -0,0 +1,113 @@
+package github_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signDigest is the signing operation of a remote key service.
+type signDigest func(ctx context.Context, digest []byte) ([]byte, error)
+
+// remoteSigners creates a signer for each remote key service, backed by the
+// given signing operation.
+var remoteSigners = []struct {
+	name    string
+	failure string
+	signer  func(t *testing.T, sign signDigest) ghinstallation.Signer
+}{
+	{
+		name:    "AWS KMS",
+		failure: "KMS signing failed: simulated failure",
+		signer: func(t *testing.T, sign signDigest) ghinstallation.Signer {
+			return github.NewKMSSigner(KMSClientFunc(func(ctx context.Context, in *kms.SignInput, _ ...func(*kms.Options)) (*kms.SignOutput, error) {
+				assert.Equal(t, "arn:fictional", *in.KeyId)
+				signature, err := sign(ctx, in.Message)
+				if err != nil {
+					return nil, err
+				}
+				return &kms.SignOutput{Signature: signature}, nil
+			}), "arn:fictional")
+		},
+	},
+	{
+		name:    "Cloud KMS",
+		failure: "Cloud KMS signing failed: simulated failure",
+		signer: func(t *testing.T, sign signDigest) ghinstallation.Signer {
+			return github.NewGCPKMSSigner(GCPKMSClientFunc(func(ctx context.Context, name string, digest []byte) ([]byte, error) {
+				assert.Equal(t, gcpKeyName, name)
+				return sign(ctx, digest)
+			}), gcpKeyName)
+		},
+	},
+	{
+		name:    "Azure Key Vault",
+		failure: "Key Vault signing failed: simulated failure",
+		signer: func(t *testing.T, sign signDigest) ghinstallation.Signer {
+			return github.NewAzureKeyVaultSigner(AzureKeyVaultClientFunc(func(ctx context.Context, keyURL string, digest []byte) ([]byte, error) {
+				assert.Equal(t, azureKeyURL, keyURL)
+				return sign(ctx, digest)
+			}), azureKeyURL)
+		},
+	},
+	{
+		name:    "Vault Transit",
+		failure: "Vault Transit signing failed: simulated failure",
+		signer: func(t *testing.T, sign signDigest) ghinstallation.Signer {
+			return github.NewVaultTransitSigner(VaultTransitClientFunc(func(ctx context.Context, key string, digest []byte) ([]byte, error) {
+				assert.Equal(t, "github-app", key)
+				return sign(ctx, digest)
+			}), "github-app")
+		},
+	},
+	{
+		name:    "PKCS #11",
+		failure: "PKCS #11 signing failed: simulated failure",
+		signer: func(_ *testing.T, sign signDigest) ghinstallation.Signer {
+			return github.NewPKCS11Signer(PKCS11KeyFunc(sign))
+		},
+	},
+}
+
+func TestRemoteSigners(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	for _, tc := range remoteSigners {
+		t.Run(tc.name+" signs verifiable JWT", func(t *testing.T) {
+			s := tc.signer(t, func(_ context.Context, digest []byte) ([]byte, error) {
+				return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+			})
+
+			tok, err := s.Sign(&jwt.RegisteredClaims{Issuer: "test"})
+			require.NoError(t, err)
+
+			claims := &jwt.RegisteredClaims{}
+			_, err = jwt.ParseWithClaims(tok, claims, func(token *jwt.Token) (any, error) {
+				assert.Equal(t, "RS256", token.Method.Alg())
+				return &key.PublicKey, nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "test", claims.Issuer)
+		})
+
+		t.Run(tc.name+" fails when the service fails", func(t *testing.T) {
+			s := tc.signer(t, func(context.Context, []byte) ([]byte, error) {
+				return nil, errors.New("simulated failure")
+			})
+
+			_, err := s.Sign(&jwt.RegisteredClaims{Issuer: "test"})
+			assert.ErrorContains(t, err, tc.failure)
+		})
+	}
+}
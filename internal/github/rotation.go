@@ -0,0 +1,152 @@
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// keyNames identify the keys of a key set, in order, in logs and metrics.
+var keyNames = []string{"primary", "secondary"}
+
+// keySet holds the ordered keys used to sign application JWTs. GitHub allows an
+// application to have more than one private key, so a key is rotated by adding
+// the new key to the application and configuring it alongside the current
+// key. The active key is used until GitHub rejects a JWT it has signed, when
+// the next key is tried and becomes active if GitHub accepts it.
+type keySet struct {
+	signers []*replaceableSigner
+	active  atomic.Int32
+
+	rejections metric.Int64Counter
+}
+
+func newKeySet(signers ...ghinstallation.Signer) (*keySet, error) {
+	k := &keySet{}
+	for _, signer := range signers {
+		k.signers = append(k.signers, newReplaceableSigner(signer))
+	}
+
+	meter := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/github")
+
+	active, err := meter.Int64ObservableGauge(
+		"github.signing_key.active",
+		metric.WithDescription("1 for the GitHub application key currently used to sign JWTs, 0 for other configured keys"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	k.rejections, err = meter.Int64Counter(
+		"github.signing_key.rejections",
+		metric.WithDescription("The number of application JWTs rejected by GitHub, by the key that signed them"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		current := int(k.active.Load())
+
+		for i := range k.signers {
+			value := int64(0)
+			if i == current {
+				value = 1
+			}
+
+			o.ObserveInt64(active, value, metric.WithAttributes(attribute.String("key", keyNames[i])))
+		}
+
+		return nil
+	}, active)
+	if err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// activeSigner returns the signer of the key currently in use.
+func (k *keySet) activeSigner() *replaceableSigner {
+	return k.signers[k.active.Load()]
+}
+
+// replace replaces the key at the given position, making the primary key
+// active again: a replaced key is expected to be accepted by GitHub.
+func (k *keySet) replace(index int, signer ghinstallation.Signer) {
+	k.signers[index].replace(signer)
+	k.active.Store(0)
+}
+
+// activate makes the key at the given position active in place of the key
+// that was rejected. The active key is left as is if it has changed since,
+// as it has been replaced or another request has already switched keys.
+func (k *keySet) activate(rejected, index int) {
+	if k.active.CompareAndSwap(int32(rejected), int32(index)) {
+		log.Warn().
+			Str("rejected", keyNames[rejected]).
+			Str("active", keyNames[index]).
+			Msg("github: application JWT rejected, switched signing key")
+	}
+}
+
+// failoverTransport sends requests authenticated with the active key, trying
+// each of the other keys in turn when GitHub rejects the application JWT.
+type failoverTransport struct {
+	keys       *keySet
+	transports []*ghinstallation.AppsTransport // in key order
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := int(t.keys.active.Load())
+	count := len(t.transports)
+
+	for attempt := 0; ; attempt++ {
+		index := (start + attempt) % count
+
+		// the apps transport sets the authorization header, so each attempt
+		// has its own copy of the request
+		attemptReq := req.Clone(req.Context())
+		if attempt > 0 && req.Body != nil && req.Body != http.NoBody {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq.Body = body
+		}
+
+		res, err := t.transports[index].RoundTrip(attemptReq)
+		if err != nil {
+			return nil, err
+		}
+
+		if res.StatusCode != http.StatusUnauthorized {
+			if attempt > 0 {
+				t.keys.activate(start, index)
+			}
+			return res, nil
+		}
+
+		t.keys.rejections.Add(req.Context(), 1, metric.WithAttributes(attribute.String("key", keyNames[index])))
+
+		// the cached JWT is not reused once GitHub has rejected it
+		t.keys.signers[index].invalidate()
+
+		// the last rejection is returned when every key has been tried, or
+		// when the request can't be sent again
+		retryable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if attempt == count-1 || !retryable {
+			return res, nil
+		}
+
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}
+}
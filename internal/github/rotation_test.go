@@ -0,0 +1,197 @@
+package github_test
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	api "github.com/google/go-github/v61/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGitHub accepts application JWTs signed by the current key, recording
+// the key used for each request.
+type fakeGitHub struct {
+	mu       sync.Mutex
+	accepted *rsa.PublicKey
+	keys     map[*rsa.PublicKey]string
+	requests []string
+}
+
+func (f *fakeGitHub) accept(key *rsa.PublicKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.accepted = key
+}
+
+func (f *fakeGitHub) signedBy() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.requests
+}
+
+func (f *fakeGitHub) handler(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tokenString, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	name := "unknown"
+	for key, keyName := range f.keys {
+		if _, err := jwt.Parse(tokenString, func(*jwt.Token) (any, error) { return key, nil }); err == nil {
+			name = keyName
+		}
+	}
+	f.requests = append(f.requests, name)
+
+	if name == "unknown" || f.keys[f.accepted] != name {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	JSON(w, &api.InstallationToken{Token: api.String("expected-token")})
+}
+
+type testKey struct {
+	pem    string
+	public *rsa.PublicKey
+}
+
+func setupRotation(t *testing.T) (*fakeGitHub, config.GithubConfig, map[string]testKey) {
+	t.Helper()
+
+	fake := &fakeGitHub{keys: map[*rsa.PublicKey]string{}}
+	keys := map[string]testKey{}
+
+	for _, name := range []string{"primary", "secondary", "replacement"} {
+		keyPEM := generateKey(t)
+		key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyPEM))
+		require.NoError(t, err)
+
+		keys[name] = testKey{pem: keyPEM, public: &key.PublicKey}
+		fake.keys[&key.PublicKey] = name
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/app/installations/{installationID}/access_tokens", fake.handler)
+
+	svr := httptest.NewServer(router)
+	t.Cleanup(svr.Close)
+
+	cfg := config.GithubConfig{
+		ApiURL:              svr.URL,
+		PrivateKey:          keys["primary"].pem,
+		SecondaryPrivateKey: keys["secondary"].pem,
+		ApplicationID:       10,
+		InstallationID:      20,
+	}
+
+	return fake, cfg, keys
+}
+
+func TestKeyRotation_UsesSecondaryWhenPrimaryRejected(t *testing.T) {
+	fake, cfg, keys := setupRotation(t)
+	fake.accept(keys["secondary"].public)
+
+	gh, err := github.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	token, _, err := gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	require.NoError(t, err)
+	assert.Equal(t, "expected-token", token)
+
+	// the secondary key remains active once GitHub has accepted it
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"primary", "secondary", "secondary"}, fake.signedBy())
+}
+
+func TestKeyRotation_FailsWhenAllKeysRejected(t *testing.T) {
+	fake, cfg, keys := setupRotation(t)
+	fake.accept(keys["replacement"].public)
+
+	gh, err := github.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	assert.ErrorContains(t, err, ": 401")
+
+	assert.Equal(t, []string{"primary", "secondary"}, fake.signedBy())
+}
+
+func TestKeyRotation_WithoutSecondaryKey(t *testing.T) {
+	fake, cfg, keys := setupRotation(t)
+	fake.accept(keys["secondary"].public)
+	cfg.SecondaryPrivateKey = ""
+
+	gh, err := github.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	assert.ErrorContains(t, err, ": 401")
+	assert.Equal(t, []string{"primary"}, fake.signedBy())
+
+	err = gh.SetSecondaryPrivateKey(generateKey(t))
+	assert.EqualError(t, err, "no secondary key is configured")
+}
+
+func TestKeyRotation_ReplacedKeyBecomesActive(t *testing.T) {
+	fake, cfg, keys := setupRotation(t)
+	fake.accept(keys["secondary"].public)
+
+	gh, err := github.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	require.NoError(t, err)
+
+	// the primary key is rotated: the replacement is used first, and the
+	// secondary is no longer needed
+	fake.accept(keys["replacement"].public)
+	require.NoError(t, gh.SetPrivateKey(keys["replacement"].pem))
+
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"primary", "secondary", "replacement"}, fake.signedBy())
+}
+
+func TestKeyRotation_SetSecondaryPrivateKey(t *testing.T) {
+	fake, cfg, keys := setupRotation(t)
+	fake.accept(keys["replacement"].public)
+
+	gh, err := github.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, gh.SetSecondaryPrivateKey(keys["replacement"].pem))
+
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"primary", "replacement"}, fake.signedBy())
+
+	err = gh.SetSecondaryPrivateKey("not a key")
+	assert.ErrorContains(t, err, "could not parse private key")
+}
+
+func TestNew_FailsWithInvalidSecondaryKey(t *testing.T) {
+	_, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			PrivateKey:          generateKey(t),
+			SecondaryPrivateKey: "not a key",
+		},
+	)
+	assert.ErrorContains(t, err, "could not create signer for secondary key: could not parse private key")
+}
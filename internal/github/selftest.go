@@ -0,0 +1,265 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v61/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// requiredPermissions are the installation permissions needed to create the
+// tokens vended by the service. This must be kept in line with the permissions
+// requested by CreateAccessToken.
+var requiredPermissions = map[string]string{
+	"contents": "read",
+}
+
+// permissionLevels orders GitHub permission levels so that a granted level can
+// be compared with a required one.
+var permissionLevels = map[string]int{
+	"read":  1,
+	"write": 2,
+	"admin": 3,
+}
+
+// SelfTestReport describes the state of the GitHub application configuration
+// as seen by GitHub.
+type SelfTestReport struct {
+	CheckedAt           time.Time
+	ApplicationID       int64
+	ApplicationSlug     string
+	InstallationID      int64
+	InstallationAccount string
+	GrantedPermissions  map[string]string
+	MissingPermissions  []string
+	Errors              []string
+}
+
+// OK returns true when no problems were found.
+func (r SelfTestReport) OK() bool {
+	return len(r.Errors) == 0 && len(r.MissingPermissions) == 0
+}
+
+// MarshalZerologObject implements zerolog.LogObjectMarshaler.
+func (r SelfTestReport) MarshalZerologObject(event *zerolog.Event) {
+	event.Bool("ok", r.OK()).
+		Int64("applicationID", r.ApplicationID).
+		Str("applicationSlug", r.ApplicationSlug).
+		Int64("installationID", r.InstallationID).
+		Str("installationAccount", r.InstallationAccount)
+
+	if len(r.GrantedPermissions) > 0 {
+		event.Interface("grantedPermissions", r.GrantedPermissions)
+	}
+
+	if len(r.MissingPermissions) > 0 {
+		event.Strs("missingPermissions", r.MissingPermissions)
+	}
+
+	if len(r.Errors) > 0 {
+		event.Strs("errors", r.Errors)
+	}
+}
+
+// SelfTest checks the GitHub application configuration against GitHub. It
+// confirms that GitHub accepts the application JWT created by the configured
+// key, that the configured installation exists and that the installation has
+// been granted the permissions the service requires. Problems are reported in
+// the returned report rather than as an error.
+func (c Client) SelfTest(ctx context.Context) SelfTestReport {
+	report := SelfTestReport{
+		CheckedAt:      time.Now(),
+		ApplicationID:  c.applicationID,
+		InstallationID: c.installationID,
+	}
+
+	// GET /app requires the application JWT: success confirms that the key is
+	// accepted.
+	app, _, err := c.client.Apps.Get(ctx, "")
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("application JWT rejected or application not found: %v", err))
+		return report
+	}
+	report.ApplicationSlug = app.GetSlug()
+
+	if app.GetID() != 0 && app.GetID() != c.applicationID {
+		report.Errors = append(report.Errors, fmt.Sprintf("key belongs to application %d, configured with %d", app.GetID(), c.applicationID))
+	}
+
+	installation, _, err := c.client.Apps.GetInstallation(ctx, c.installationID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("installation not found: %v", err))
+		return report
+	}
+	report.InstallationAccount = installation.GetAccount().GetLogin()
+
+	if installation.SuspendedAt != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("installation suspended at %s", installation.GetSuspendedAt().Time))
+	}
+
+	granted, err := permissionMap(installation.GetPermissions())
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("could not read installation permissions: %v", err))
+		return report
+	}
+	report.GrantedPermissions = granted
+	report.MissingPermissions = missingPermissions(requiredPermissions, granted)
+
+	return report
+}
+
+// RunSelfTest runs the self test at startup, and then at the configured
+// interval until the context is cancelled. Each report is logged and recorded
+// in metrics. Each run is limited to selfTestTimeout. If the startup test fails
+// and the configuration requires it, an error is returned; periodic failures
+// are only reported.
+func (c Client) RunSelfTest(ctx context.Context, cfg config.GithubConfig) error {
+	monitor, err := newSelfTestMonitor()
+	if err != nil {
+		return fmt.Errorf("could not configure self test metrics: %w", err)
+	}
+
+	report := monitor.run(ctx, c)
+	if !report.OK() && cfg.SelfTestFatal {
+		return errors.New("GitHub application self test failed")
+	}
+
+	if cfg.SelfTestIntervalSeconds > 0 {
+		interval := time.Duration(cfg.SelfTestIntervalSeconds) * time.Second
+
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					monitor.run(ctx, c)
+				}
+			}
+		}()
+	}
+
+	return nil
+}
+
+// selfTestTimeout bounds each self test run, so that a slow GitHub API cannot
+// hold up startup indefinitely. It is a variable for testing.
+var selfTestTimeout = 30 * time.Second
+
+// selfTestMonitor records the outcome of the most recent self test, reporting
+// it via metrics.
+type selfTestMonitor struct {
+	mu     sync.Mutex
+	latest *SelfTestReport
+}
+
+func newSelfTestMonitor() (*selfTestMonitor, error) {
+	m := &selfTestMonitor{}
+
+	meter := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/github")
+
+	status, err := meter.Int64ObservableGauge(
+		"github.selftest.status",
+		metric.WithDescription("1 if the last GitHub application self test passed, 0 otherwise"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	missing, err := meter.Int64ObservableGauge(
+		"github.selftest.missing_permissions",
+		metric.WithDescription("The number of required permissions not granted to the GitHub installation"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.latest == nil {
+			return nil
+		}
+
+		ok := int64(0)
+		if m.latest.OK() {
+			ok = 1
+		}
+
+		o.ObserveInt64(status, ok)
+		o.ObserveInt64(missing, int64(len(m.latest.MissingPermissions)))
+
+		return nil
+	}, status, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *selfTestMonitor) run(ctx context.Context, c Client) SelfTestReport {
+	testCtx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	report := c.SelfTest(testCtx)
+
+	m.mu.Lock()
+	m.latest = &report
+	m.mu.Unlock()
+
+	logger := logging.Ctx(ctx, "github")
+	ev := logger.Info()
+	if !report.OK() {
+		ev = logger.Error()
+	}
+	ev.EmbedObject(report).Msg("github: application self test")
+
+	return report
+}
+
+// permissionMap converts the installation permissions to a map of permission
+// name to access level.
+func permissionMap(p *github.InstallationPermissions) (map[string]string, error) {
+	content, err := json.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+
+	m := map[string]string{}
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// missingPermissions returns a sorted description of each required permission
+// that has not been granted at the required level.
+func missingPermissions(required, granted map[string]string) []string {
+	var missing []string
+
+	for name, level := range required {
+		if permissionLevels[granted[name]] < permissionLevels[level] {
+			missing = append(missing, fmt.Sprintf("%s:%s", name, level))
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
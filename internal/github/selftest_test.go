@@ -0,0 +1,140 @@
+package github_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	api "github.com/google/go-github/v61/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfTest(t *testing.T) {
+	cases := []struct {
+		name            string
+		appID           int64
+		appStatus       int
+		permissions     *api.InstallationPermissions
+		expectOK        bool
+		expectMissing   []string
+		expectErrorText string
+	}{
+		{
+			name:        "permissions granted",
+			appID:       10,
+			appStatus:   http.StatusOK,
+			permissions: &api.InstallationPermissions{Contents: api.String("read"), Metadata: api.String("read")},
+			expectOK:    true,
+		},
+		{
+			name:        "higher permission level granted",
+			appID:       10,
+			appStatus:   http.StatusOK,
+			permissions: &api.InstallationPermissions{Contents: api.String("write")},
+			expectOK:    true,
+		},
+		{
+			name:          "permission removed",
+			appID:         10,
+			appStatus:     http.StatusOK,
+			permissions:   &api.InstallationPermissions{Metadata: api.String("read")},
+			expectMissing: []string{"contents:read"},
+		},
+		{
+			name:            "key for a different application",
+			appID:           99,
+			appStatus:       http.StatusOK,
+			permissions:     &api.InstallationPermissions{Contents: api.String("read")},
+			expectErrorText: "key belongs to application 99, configured with 10",
+		},
+		{
+			name:            "application JWT rejected",
+			appID:           10,
+			appStatus:       http.StatusUnauthorized,
+			expectErrorText: "application JWT rejected",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svr := selfTestServer(t, tc.appID, tc.appStatus, tc.permissions)
+			defer svr.Close()
+
+			gh := selfTestClient(t, svr.URL)
+
+			report := gh.SelfTest(context.Background())
+
+			assert.Equal(t, tc.expectOK, report.OK())
+			assert.Equal(t, tc.expectMissing, report.MissingPermissions)
+			if tc.expectErrorText != "" {
+				require.NotEmpty(t, report.Errors)
+				assert.Contains(t, report.Errors[0], tc.expectErrorText)
+			} else {
+				assert.Empty(t, report.Errors)
+				assert.Equal(t, "test-app", report.ApplicationSlug)
+				assert.Equal(t, "test-org", report.InstallationAccount)
+			}
+		})
+	}
+}
+
+func TestRunSelfTest_FatalFailure(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	svr := selfTestServer(t, 10, http.StatusOK, &api.InstallationPermissions{})
+	defer svr.Close()
+
+	gh := selfTestClient(t, svr.URL)
+
+	err := gh.RunSelfTest(context.Background(), config.GithubConfig{SelfTestFatal: true})
+	assert.ErrorContains(t, err, "self test failed")
+
+	err = gh.RunSelfTest(context.Background(), config.GithubConfig{SelfTestFatal: false})
+	assert.NoError(t, err)
+}
+
+func selfTestServer(t *testing.T, appID int64, appStatus int, permissions *api.InstallationPermissions) *httptest.Server {
+	t.Helper()
+
+	router := http.NewServeMux()
+
+	router.HandleFunc("GET /app", func(w http.ResponseWriter, r *http.Request) {
+		if appStatus != http.StatusOK {
+			w.WriteHeader(appStatus)
+			return
+		}
+		JSON(w, &api.App{ID: api.Int64(appID), Slug: api.String("test-app")})
+	})
+
+	router.HandleFunc("GET /app/installations/{installationID}", func(w http.ResponseWriter, r *http.Request) {
+		JSON(w, &api.Installation{
+			ID:          api.Int64(20),
+			Account:     &api.User{Login: api.String("test-org")},
+			Permissions: permissions,
+		})
+	})
+
+	return httptest.NewServer(router)
+}
+
+func selfTestClient(t *testing.T, url string) github.Client {
+	t.Helper()
+
+	gh, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			ApiURL:         url,
+			PrivateKey:     generateKey(t),
+			ApplicationID:  10,
+			InstallationID: 20,
+		},
+	)
+	require.NoError(t, err)
+
+	return gh
+}
@@ -0,0 +1,54 @@
+package github
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunSelfTest_BoundedByTimeout(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	release := make(chan struct{})
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer svr.Close()
+	defer close(release)
+
+	previous := selfTestTimeout
+	selfTestTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { selfTestTimeout = previous })
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	gh, err := New(context.Background(), config.GithubConfig{
+		ApiURL:         svr.URL,
+		PrivateKey:     string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		ApplicationID:  10,
+		InstallationID: 20,
+	})
+	require.NoError(t, err)
+
+	// the caller's context has no deadline: only the self test timeout ends the
+	// run
+	start := time.Now()
+	err = gh.RunSelfTest(context.Background(), config.GithubConfig{SelfTestFatal: true})
+	assert.ErrorContains(t, err, "self test failed")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
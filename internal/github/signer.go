@@ -0,0 +1,212 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// jwtLifetime is the lifetime of a cached application JWT. GitHub rejects
+	// JWTs that expire more than 10 minutes in the future.
+	jwtLifetime = 9 * time.Minute
+	// jwtRefreshMargin is how long before expiry a cached JWT is replaced, so
+	// that it doesn't expire while a request is in flight.
+	jwtRefreshMargin = time.Minute
+	// jwtClockSkew backdates the issue time, allowing for clock drift between
+	// the service and GitHub.
+	jwtClockSkew = 30 * time.Second
+	// jwtSignTimeout bounds a signing call to a remote key service, and how
+	// long a caller waits for a JWT to be signed.
+	jwtSignTimeout = 10 * time.Second
+)
+
+var _ ghinstallation.Signer = (*replaceableSigner)(nil)
+
+// replaceableSigner delegates to the current signer, which can be replaced
+// while the GitHub transport is in use. Application JWTs are cached and reused
+// until shortly before they expire, avoiding a signing call (a round trip to a
+// key service, for keys held remotely) for each request to GitHub.
+type replaceableSigner struct {
+	current atomic.Pointer[signerRef]
+
+	// for testing
+	now         func() time.Time
+	signTimeout time.Duration
+}
+
+// signerRef allows signers of different types to be stored atomically. The
+// cached JWT is held alongside the signer that created it, so that it is
+// discarded when the signer is replaced.
+type signerRef struct {
+	ghinstallation.Signer
+
+	mu      sync.Mutex
+	issuer  string
+	token   string
+	expiry  time.Time
+	refresh *jwtRefresh
+}
+
+// jwtRefresh is a JWT being signed. Callers that need the JWT wait for done,
+// then read the result.
+type jwtRefresh struct {
+	issuer string
+	done   chan struct{}
+
+	token string
+	err   error
+}
+
+func newReplaceableSigner(signer ghinstallation.Signer) *replaceableSigner {
+	s := &replaceableSigner{now: time.Now, signTimeout: jwtSignTimeout}
+	s.replace(signer)
+
+	return s
+}
+
+// Sign returns a JWT for the issuer of the claims, reusing the cached JWT if it
+// is not close to expiry. The issue and expiry times of the claims are
+// replaced, so that the JWT can be cached for longer than the transport
+// requests.
+//
+// The lock is not held while signing. Concurrent callers share a single
+// signing call, and the cached JWT is returned while it is in flight if it has
+// not yet expired. Callers without a usable JWT give up if it is not signed
+// within the timeout.
+func (s *replaceableSigner) Sign(claims jwt.Claims) (string, error) {
+	ref := s.current.Load()
+
+	registered, ok := claims.(*jwt.RegisteredClaims)
+	if !ok {
+		return ref.Sign(claims)
+	}
+
+	ref.mu.Lock()
+
+	now := s.now()
+	cached := ref.token != "" && ref.issuer == registered.Issuer
+	if cached && now.Add(jwtRefreshMargin).Before(ref.expiry) {
+		token := ref.token
+		ref.mu.Unlock()
+
+		jwtCacheMetrics().reused.Add(context.Background(), 1)
+		return token, nil
+	}
+
+	r := ref.refresh
+	if r == nil || r.issuer != registered.Issuer {
+		issued := now.Add(-jwtClockSkew).Truncate(time.Second)
+		expiry := now.Add(jwtLifetime).Truncate(time.Second)
+
+		cacheable := *registered
+		cacheable.IssuedAt = jwt.NewNumericDate(issued)
+		cacheable.ExpiresAt = jwt.NewNumericDate(expiry)
+
+		r = &jwtRefresh{issuer: registered.Issuer, done: make(chan struct{})}
+		ref.refresh = r
+
+		go ref.sign(r, &cacheable)
+	}
+
+	// the JWT being replaced remains usable until it expires
+	if cached && now.Before(ref.expiry) {
+		token := ref.token
+		ref.mu.Unlock()
+
+		jwtCacheMetrics().reused.Add(context.Background(), 1)
+		return token, nil
+	}
+
+	ref.mu.Unlock()
+
+	timeout := time.NewTimer(s.signTimeout)
+	defer timeout.Stop()
+
+	select {
+	case <-r.done:
+		return r.token, r.err
+	case <-timeout.C:
+		return "", errors.New("timed out waiting for the application JWT to be signed")
+	}
+}
+
+// sign signs the claims, caching the JWT if successful, and completes the
+// refresh.
+func (ref *signerRef) sign(r *jwtRefresh, claims *jwt.RegisteredClaims) {
+	defer close(r.done)
+
+	r.token, r.err = ref.Sign(claims)
+
+	ref.mu.Lock()
+	defer ref.mu.Unlock()
+
+	if ref.refresh == r {
+		ref.refresh = nil
+	}
+
+	if r.err != nil {
+		return
+	}
+	jwtCacheMetrics().signed.Add(context.Background(), 1)
+
+	ref.issuer = r.issuer
+	ref.token = r.token
+	ref.expiry = claims.ExpiresAt.Time
+}
+
+// signUncached signs the claims with the current signer, bypassing the cache.
+func (s *replaceableSigner) signUncached(claims jwt.Claims) (string, error) {
+	return s.current.Load().Sign(claims)
+}
+
+// replace replaces the signer, discarding the cached JWT.
+func (s *replaceableSigner) replace(signer ghinstallation.Signer) {
+	s.current.Store(&signerRef{Signer: signer})
+}
+
+// invalidate discards the cached JWT, so that the next JWT is newly signed.
+func (s *replaceableSigner) invalidate() {
+	ref := s.current.Load()
+
+	ref.mu.Lock()
+	defer ref.mu.Unlock()
+
+	ref.token = ""
+}
+
+type jwtMetrics struct {
+	signed metric.Int64Counter
+	reused metric.Int64Counter
+}
+
+var jwtCacheMetrics = sync.OnceValue(func() jwtMetrics {
+	// The global meter delegates to the configured provider once it is set, so
+	// the counters can be created before telemetry is configured.
+	meter := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/github")
+
+	signed, err := meter.Int64Counter(
+		"github.app_jwt.signed",
+		metric.WithDescription("The number of application JWTs signed with the GitHub application key"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	reused, err := meter.Int64Counter(
+		"github.app_jwt.reused",
+		metric.WithDescription("The number of requests that reused a cached application JWT, each avoiding a signing call"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return jwtMetrics{signed: signed, reused: reused}
+})
@@ -0,0 +1,202 @@
+package github
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSigner returns a JWT that identifies the signing call. If release is
+// set, signing waits until it is closed.
+type countingSigner struct {
+	name    string
+	calls   atomic.Int32
+	last    atomic.Pointer[jwt.RegisteredClaims]
+	err     error
+	release chan struct{}
+}
+
+func (s *countingSigner) Sign(claims jwt.Claims) (string, error) {
+	if s.release != nil {
+		<-s.release
+	}
+
+	if s.err != nil {
+		return "", s.err
+	}
+
+	if registered, ok := claims.(*jwt.RegisteredClaims); ok {
+		s.last.Store(registered)
+	}
+
+	n := s.calls.Add(1)
+	return s.name + "-" + strconv.Itoa(int(n)), nil
+}
+
+func appClaims(issuer string) *jwt.RegisteredClaims {
+	return &jwt.RegisteredClaims{Issuer: issuer}
+}
+
+func testSigner(signer *countingSigner) (*replaceableSigner, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := newReplaceableSigner(signer)
+	s.now = func() time.Time { return now }
+
+	return s, &now
+}
+
+func TestReplaceableSigner_ReusesJWTUntilNearExpiry(t *testing.T) {
+	signer := &countingSigner{name: "key"}
+	s, now := testSigner(signer)
+
+	first, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", first)
+
+	// the lifetime is extended beyond that requested by the transport
+	issued := signer.last.Load()
+	assert.Equal(t, now.Add(-jwtClockSkew), issued.IssuedAt.Time.UTC())
+	assert.Equal(t, now.Add(jwtLifetime), issued.ExpiresAt.Time.UTC())
+	assert.Equal(t, "10", issued.Issuer)
+
+	*now = now.Add(jwtLifetime - jwtRefreshMargin - time.Second)
+	reused, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", reused)
+
+	// the JWT is refreshed once it has expired
+	*now = now.Add(jwtRefreshMargin + time.Second)
+	refreshed, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", refreshed)
+}
+
+func TestReplaceableSigner_ServesCachedJWTWhileRefreshing(t *testing.T) {
+	signer := &countingSigner{name: "key"}
+	s, now := testSigner(signer)
+
+	_, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+
+	// within the refresh margin the JWT is still valid, so it is returned
+	// without waiting for the refresh
+	signer.release = make(chan struct{})
+	*now = now.Add(jwtLifetime - jwtRefreshMargin)
+
+	for range 3 {
+		token, err := s.Sign(appClaims("10"))
+		require.NoError(t, err)
+		assert.Equal(t, "key-1", token)
+	}
+
+	close(signer.release)
+
+	assert.Eventually(t, func() bool {
+		token, err := s.Sign(appClaims("10"))
+		return err == nil && token == "key-2"
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(2), signer.calls.Load())
+}
+
+func TestReplaceableSigner_WaitersGiveUpAfterTimeout(t *testing.T) {
+	signer := &countingSigner{name: "key", release: make(chan struct{})}
+	t.Cleanup(func() { close(signer.release) })
+
+	s, _ := testSigner(signer)
+	s.signTimeout = 50 * time.Millisecond
+
+	_, err := s.Sign(appClaims("10"))
+	assert.EqualError(t, err, "timed out waiting for the application JWT to be signed")
+}
+
+func TestReplaceableSigner_SignsForNewIssuer(t *testing.T) {
+	signer := &countingSigner{name: "key"}
+	s, _ := testSigner(signer)
+
+	_, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+
+	token, err := s.Sign(appClaims("11"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", token)
+}
+
+func TestReplaceableSigner_ReplaceDiscardsCachedJWT(t *testing.T) {
+	s, _ := testSigner(&countingSigner{name: "old"})
+
+	_, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+
+	s.replace(&countingSigner{name: "new"})
+
+	token, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "new-1", token)
+}
+
+func TestReplaceableSigner_InvalidateDiscardsCachedJWT(t *testing.T) {
+	s, _ := testSigner(&countingSigner{name: "key"})
+
+	_, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+
+	s.invalidate()
+
+	token, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", token)
+}
+
+func TestReplaceableSigner_DoesNotCacheErrors(t *testing.T) {
+	signer := &countingSigner{name: "key", err: errors.New("sign failed")}
+	s, _ := testSigner(signer)
+
+	_, err := s.Sign(appClaims("10"))
+	assert.EqualError(t, err, "sign failed")
+
+	signer.err = nil
+
+	token, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", token)
+}
+
+func TestReplaceableSigner_ConcurrentCallersSignOnce(t *testing.T) {
+	signer := &countingSigner{name: "key"}
+	s, _ := testSigner(signer)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			token, err := s.Sign(appClaims("10"))
+			assert.NoError(t, err)
+			assert.Equal(t, "key-1", token)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), signer.calls.Load())
+}
+
+func TestReplaceableSigner_SignUncached(t *testing.T) {
+	signer := &countingSigner{name: "key"}
+	s, _ := testSigner(signer)
+
+	_, err := s.Sign(appClaims("10"))
+	require.NoError(t, err)
+
+	token, err := s.signUncached(appClaims("10"))
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", token)
+}
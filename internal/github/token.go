@@ -2,47 +2,93 @@ package github
 
 import (
 	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bradleyfalzon/ghinstallation/v2"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/go-github/v61/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/awsarn"
 	"github.com/jamestelfer/chinmina-bridge/internal/config"
-	"github.com/rs/zerolog/log"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
 )
 
 type Client struct {
 	client         *github.Client
+	keys           *keySet
+	applicationID  int64
 	installationID int64
 }
 
-func New(ctx context.Context, cfg config.GithubConfig) (Client, error) {
-	signer, err := createSigner(ctx, cfg)
+// Option configures optional dependencies of the Client.
+type Option func(*options)
+
+type options struct {
+	vault VaultTransitClient
+}
+
+// WithVaultClient supplies the Vault client used to sign JWTs when the private
+// key is held in Vault Transit.
+func WithVaultClient(client VaultTransitClient) Option {
+	return func(o *options) {
+		o.vault = client
+	}
+}
+
+func New(ctx context.Context, cfg config.GithubConfig, opts ...Option) (Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	primary, err := createSigner(ctx, cfg, o)
 	if err != nil {
 		return Client{}, fmt.Errorf("could not create signer for GitHub transport: %w", err)
 	}
+	signers := []ghinstallation.Signer{primary}
 
-	// We're calling "installation_token", which is JWT authenticated, so we use
-	// the AppsTransport.
-	appInstallationTransport, err := ghinstallation.NewAppsTransportWithOptions(
-		http.DefaultTransport,
-		cfg.ApplicationID,
-		ghinstallation.WithSigner(signer),
-	)
+	if HasSecondaryKey(cfg) {
+		secondary, err := createSigner(ctx, secondaryKeyConfig(cfg), o)
+		if err != nil {
+			return Client{}, fmt.Errorf("could not create signer for secondary key: %w", err)
+		}
+		signers = append(signers, secondary)
+	}
+
+	// the keys can be replaced once the transport has been created
+	keys, err := newKeySet(signers...)
 	if err != nil {
-		return Client{}, fmt.Errorf("could not create GitHub transport: %w", err)
+		return Client{}, fmt.Errorf("could not create GitHub signing keys: %w", err)
+	}
+
+	// We're calling "installation_token", which is JWT authenticated, so we use
+	// the AppsTransport, with one transport per key.
+	transport := &failoverTransport{keys: keys}
+
+	for _, signer := range keys.signers {
+		appInstallationTransport, err := ghinstallation.NewAppsTransportWithOptions(
+			http.DefaultTransport,
+			cfg.ApplicationID,
+			ghinstallation.WithSigner(signer),
+		)
+		if err != nil {
+			return Client{}, fmt.Errorf("could not create GitHub transport: %w", err)
+		}
+
+		transport.transports = append(transport.transports, appInstallationTransport)
 	}
 
 	// Create a client for use with the application credentials. This client
 	// will be used concurrently.
 	client := github.NewClient(
 		&http.Client{
-			Transport: appInstallationTransport,
+			Transport: transport,
 		},
 	)
 
@@ -53,17 +99,50 @@ func New(ctx context.Context, cfg config.GithubConfig) (Client, error) {
 			apiURL += "/"
 		}
 
-		appInstallationTransport.BaseURL = cfg.ApiURL
+		for _, t := range transport.transports {
+			t.BaseURL = cfg.ApiURL
+		}
 		u, _ := url.Parse(apiURL)
 		client.BaseURL = u
 	}
 
 	return Client{
-		client,
-		cfg.InstallationID,
+		client:         client,
+		keys:           keys,
+		applicationID:  cfg.ApplicationID,
+		installationID: cfg.InstallationID,
 	}, nil
 }
 
+// SetPrivateKey replaces the primary private key used to sign application
+// JWTs with the PEM encoded RSA key, and makes it the active key. The current
+// key remains in use if the key cannot be parsed.
+func (c Client) SetPrivateKey(keyPEM string) error {
+	return c.setKey(0, keyPEM)
+}
+
+// SetSecondaryPrivateKey replaces the secondary private key with the PEM
+// encoded RSA key. The primary key is made active again, as it is expected to
+// be accepted by GitHub once either key has been rotated.
+func (c Client) SetSecondaryPrivateKey(keyPEM string) error {
+	if len(c.keys.signers) < 2 {
+		return errors.New("no secondary key is configured")
+	}
+
+	return c.setKey(1, keyPEM)
+}
+
+func (c Client) setKey(index int, keyPEM string) error {
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return err
+	}
+
+	c.keys.replace(index, ghinstallation.NewRSASigner(jwt.SigningMethodRS256, key))
+
+	return nil
+}
+
 func (c Client) CreateAccessToken(ctx context.Context, repositoryURL string) (string, time.Time, error) {
 	u, err := url.Parse(repositoryURL)
 	if err != nil {
@@ -84,20 +163,95 @@ func (c Client) CreateAccessToken(ctx context.Context, repositoryURL string) (st
 		return "", time.Time{}, err
 	}
 
-	log.Info().Int("limit", r.Rate.Limit).Int("remaining", r.Rate.Remaining).Msg("github token API rate")
+	logging.Ctx(ctx, "github").Info().Int("limit", r.Rate.Limit).Int("remaining", r.Rate.Remaining).Msg("github token API rate")
 
 	return tok.GetToken(), tok.GetExpiresAt().Time, nil
 }
 
-func createSigner(ctx context.Context, cfg config.GithubConfig) (ghinstallation.Signer, error) {
+// CheckSigner verifies that the active key is able to sign an application
+// JWT. When the key is held in KMS, this confirms that KMS is reachable and
+// that signing is permitted, as the cached JWT is not used. No request is made
+// to GitHub.
+func (c Client) CheckSigner(_ context.Context) error {
+	now := time.Now()
+	_, err := c.keys.activeSigner().signUncached(jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now.Add(-30 * time.Second)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		Issuer:    strconv.FormatInt(c.applicationID, 10),
+	})
+	if err != nil {
+		return fmt.Errorf("could not sign application JWT: %w", err)
+	}
+
+	return nil
+}
+
+// CheckAppAuthentication verifies that GitHub accepts the application JWT, and
+// that the configured installation exists.
+func (c Client) CheckAppAuthentication(ctx context.Context) error {
+	_, _, err := c.client.Apps.GetInstallation(ctx, c.installationID)
+	if err != nil {
+		return fmt.Errorf("GitHub rejected the application or installation: %w", err)
+	}
+
+	return nil
+}
+
+// UsesPrivateKey reports whether JWTs are signed with GITHUB_APP_PRIVATE_KEY,
+// rather than a key held by a key service.
+func UsesPrivateKey(cfg config.GithubConfig) bool {
+	return cfg.PrivateKeyARN == "" && cfg.PrivateKeyURI == "" && cfg.PrivateKeyVaultTransitKey == ""
+}
+
+// UsesVaultTransit reports whether JWTs are signed with a Vault Transit key.
+// As with the signer, a KMS key or key URI takes precedence.
+func UsesVaultTransit(cfg config.GithubConfig) bool {
+	return cfg.PrivateKeyARN == "" && cfg.PrivateKeyURI == "" && cfg.PrivateKeyVaultTransitKey != ""
+}
+
+// HasSecondaryKey reports whether a secondary key is configured, to be used
+// when GitHub rejects JWTs signed with the primary key.
+func HasSecondaryKey(cfg config.GithubConfig) bool {
+	return cfg.SecondaryPrivateKeyARN != "" || cfg.SecondaryPrivateKey != ""
+}
+
+// UsesSecondaryPrivateKey reports whether the secondary key is
+// GITHUB_APP_SECONDARY_PRIVATE_KEY rather than a KMS key.
+func UsesSecondaryPrivateKey(cfg config.GithubConfig) bool {
+	return cfg.SecondaryPrivateKeyARN == "" && cfg.SecondaryPrivateKey != ""
+}
+
+// secondaryKeyConfig returns the configuration of the secondary key in the
+// form used for the primary key, so that the signer is created in the same
+// way.
+func secondaryKeyConfig(cfg config.GithubConfig) config.GithubConfig {
+	return config.GithubConfig{
+		PrivateKey:    cfg.SecondaryPrivateKey,
+		PrivateKeyARN: cfg.SecondaryPrivateKeyARN,
+	}
+}
+
+func createSigner(ctx context.Context, cfg config.GithubConfig, o options) (ghinstallation.Signer, error) {
 	if cfg.PrivateKeyARN != "" {
 		return NewAWSKMSSigner(ctx, cfg.PrivateKeyARN)
 	}
 
+	if cfg.PrivateKeyURI != "" {
+		return newKeyURISigner(cfg)
+	}
+
+	if cfg.PrivateKeyVaultTransitKey != "" {
+		if o.vault == nil {
+			return nil, errors.New("a Vault client is required to sign with a Vault Transit key")
+		}
+
+		return NewVaultTransitSigner(o.vault, cfg.PrivateKeyVaultTransitKey), nil
+	}
+
 	if cfg.PrivateKey != "" {
-		key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+		key, err := parsePrivateKey(cfg.PrivateKey)
 		if err != nil {
-			return nil, fmt.Errorf("could not parse private key: %s", err)
+			return nil, err
 		}
 
 		return ghinstallation.NewRSASigner(jwt.SigningMethodRS256, key), nil
@@ -106,6 +260,73 @@ func createSigner(ctx context.Context, cfg config.GithubConfig) (ghinstallation.
 	return nil, errors.New("no private key configuration specified")
 }
 
+func parsePrivateKey(keyPEM string) (*rsa.PrivateKey, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %s", err)
+	}
+
+	return key, nil
+}
+
+// ValidateConfig checks the signing key configuration without creating a
+// signer: a private key must be a PEM encoded RSA key, a KMS key must be
+// identified by a key or alias ARN, and a key URI must identify a key in a
+// supported service. The secondary key, if any, is checked in the same way. No
+// request is made to a key service or GitHub.
+func ValidateConfig(cfg config.GithubConfig) error {
+	return errors.Join(validatePrimaryKey(cfg), ValidateSecondaryKey(cfg))
+}
+
+func validatePrimaryKey(cfg config.GithubConfig) error {
+	// as with the signer, the KMS key takes precedence
+	if cfg.PrivateKeyARN != "" {
+		if err := awsarn.ValidateKMSKey(cfg.PrivateKeyARN); err != nil {
+			return fmt.Errorf("invalid GITHUB_APP_PRIVATE_KEY_ARN: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.PrivateKeyURI != "" {
+		if err := ValidateKeyURI(cfg.PrivateKeyURI); err != nil {
+			return fmt.Errorf("invalid GITHUB_APP_PRIVATE_KEY_URI: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.PrivateKeyVaultTransitKey != "" {
+		return nil
+	}
+
+	if cfg.PrivateKey != "" {
+		if _, err := parsePrivateKey(cfg.PrivateKey); err != nil {
+			return fmt.Errorf("invalid GITHUB_APP_PRIVATE_KEY: %w", err)
+		}
+		return nil
+	}
+
+	return errors.New("no private key configuration specified: set GITHUB_APP_PRIVATE_KEY, GITHUB_APP_PRIVATE_KEY_ARN, GITHUB_APP_PRIVATE_KEY_URI or GITHUB_APP_PRIVATE_KEY_VAULT_TRANSIT_KEY")
+}
+
+// ValidateSecondaryKey checks the configuration of the secondary key, if one
+// is configured. As with the primary key, the KMS key takes precedence.
+func ValidateSecondaryKey(cfg config.GithubConfig) error {
+	if cfg.SecondaryPrivateKeyARN != "" {
+		if err := awsarn.ValidateKMSKey(cfg.SecondaryPrivateKeyARN); err != nil {
+			return fmt.Errorf("invalid GITHUB_APP_SECONDARY_PRIVATE_KEY_ARN: %w", err)
+		}
+		return nil
+	}
+
+	if cfg.SecondaryPrivateKey != "" {
+		if _, err := parsePrivateKey(cfg.SecondaryPrivateKey); err != nil {
+			return fmt.Errorf("invalid GITHUB_APP_SECONDARY_PRIVATE_KEY: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func RepoForURL(u url.URL) (string, string) {
 	if u.Hostname() != "github.com" || u.Path == "" {
 		return "", ""
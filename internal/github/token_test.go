@@ -9,9 +9,11 @@ import (
 	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
 	api "github.com/google/go-github/v61/github"
 	"github.com/jamestelfer/chinmina-bridge/internal/config"
 	"github.com/jamestelfer/chinmina-bridge/internal/github"
@@ -44,6 +46,76 @@ func TestNew_SucceedsWithKMSConfig(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, github.ValidateConfig(config.GithubConfig{PrivateKey: generateKey(t)}))
+	assert.NoError(t, github.ValidateConfig(config.GithubConfig{PrivateKeyARN: "arn:aws:kms:us-east-1:123456789012:alias/github-app"}))
+	assert.NoError(t, github.ValidateConfig(config.GithubConfig{PrivateKeyVaultTransitKey: "github-app"}))
+	assert.NoError(t, github.ValidateConfig(config.GithubConfig{PrivateKeyURI: "azurekms://example.vault.azure.net/github-app"}))
+
+	err := github.ValidateConfig(config.GithubConfig{PrivateKeyURI: "gcpkms://github-app"})
+	assert.ErrorContains(t, err, `invalid GITHUB_APP_PRIVATE_KEY_URI: invalid key URI "gcpkms://github-app"`)
+
+	err = github.ValidateConfig(config.GithubConfig{})
+	assert.ErrorContains(t, err, "no private key configuration specified")
+
+	err = github.ValidateConfig(config.GithubConfig{PrivateKey: "not a key"})
+	assert.ErrorContains(t, err, "invalid GITHUB_APP_PRIVATE_KEY: could not parse private key")
+
+	err = github.ValidateConfig(config.GithubConfig{PrivateKey: generateKey(t), PrivateKeyARN: "arn://foo"})
+	assert.ErrorContains(t, err, `invalid GITHUB_APP_PRIVATE_KEY_ARN: invalid KMS key ARN "arn://foo"`)
+
+	assert.NoError(t, github.ValidateConfig(config.GithubConfig{PrivateKey: generateKey(t), SecondaryPrivateKey: generateKey(t)}))
+	assert.NoError(t, github.ValidateConfig(config.GithubConfig{PrivateKey: generateKey(t), SecondaryPrivateKeyARN: "arn:aws:kms:us-east-1:123456789012:alias/github-app-next"}))
+
+	err = github.ValidateConfig(config.GithubConfig{PrivateKey: generateKey(t), SecondaryPrivateKey: "not a key"})
+	assert.ErrorContains(t, err, "invalid GITHUB_APP_SECONDARY_PRIVATE_KEY: could not parse private key")
+
+	err = github.ValidateConfig(config.GithubConfig{PrivateKey: generateKey(t), SecondaryPrivateKeyARN: "arn://foo"})
+	assert.ErrorContains(t, err, `invalid GITHUB_APP_SECONDARY_PRIVATE_KEY_ARN: invalid KMS key ARN "arn://foo"`)
+}
+
+func TestSetPrivateKey_ReplacesSigningKey(t *testing.T) {
+	var authorization string
+
+	router := http.NewServeMux()
+	router.HandleFunc("/app/installations/{installationID}/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		JSON(w, &api.InstallationToken{Token: api.String("expected-token")})
+	})
+
+	svr := httptest.NewServer(router)
+	defer svr.Close()
+
+	gh, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			ApiURL:         svr.URL,
+			PrivateKey:     generateKey(t),
+			ApplicationID:  10,
+			InstallationID: 20,
+		},
+	)
+	require.NoError(t, err)
+
+	replacement, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(generateKey(t)))
+	require.NoError(t, err)
+	replacementPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(replacement)})
+
+	require.NoError(t, gh.SetPrivateKey(string(replacementPEM)))
+
+	_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+	require.NoError(t, err)
+
+	// the application JWT is signed with the replacement key
+	tokenString, ok := strings.CutPrefix(authorization, "Bearer ")
+	require.True(t, ok)
+	_, err = jwt.Parse(tokenString, func(*jwt.Token) (any, error) { return &replacement.PublicKey, nil })
+	assert.NoError(t, err)
+
+	err = gh.SetPrivateKey("not a key")
+	assert.ErrorContains(t, err, "could not parse private key")
+}
+
 func TestCreateAccessToken_Succeeds(t *testing.T) {
 	router := http.NewServeMux()
 
@@ -84,6 +156,38 @@ func TestCreateAccessToken_Succeeds(t *testing.T) {
 	assert.Equal(t, "20", actualInstallation)
 }
 
+func TestCreateAccessToken_ReusesApplicationJWT(t *testing.T) {
+	var authorizations []string
+
+	router := http.NewServeMux()
+	router.HandleFunc("/app/installations/{installationID}/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		JSON(w, &api.InstallationToken{Token: api.String("expected-token")})
+	})
+
+	svr := httptest.NewServer(router)
+	defer svr.Close()
+
+	gh, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			ApiURL:         svr.URL,
+			PrivateKey:     generateKey(t),
+			ApplicationID:  10,
+			InstallationID: 20,
+		},
+	)
+	require.NoError(t, err)
+
+	for range 2 {
+		_, _, err = gh.CreateAccessToken(context.Background(), "https://github.com/organization/repository")
+		require.NoError(t, err)
+	}
+
+	require.Len(t, authorizations, 2)
+	assert.Equal(t, authorizations[0], authorizations[1])
+}
+
 func TestCreateAccessToken_Fails_On_Invalid_URL(t *testing.T) {
 	router := http.NewServeMux()
 
@@ -144,6 +248,82 @@ func TestCreateAccessToken_Fails_On_Failed_Request(t *testing.T) {
 	assert.ErrorContains(t, err, ": 418")
 }
 
+func TestCheckAppAuthentication_Succeeds(t *testing.T) {
+	router := http.NewServeMux()
+
+	actualInstallation := "unknown"
+	actualAuth := ""
+
+	router.HandleFunc("/app/installations/{installationID}", func(w http.ResponseWriter, r *http.Request) {
+		actualInstallation = r.PathValue("installationID")
+		actualAuth = r.Header.Get("Authorization")
+
+		JSON(w, &api.Installation{ID: api.Int64(20)})
+	})
+
+	svr := httptest.NewServer(router)
+	defer svr.Close()
+
+	gh, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			ApiURL:         svr.URL,
+			PrivateKey:     generateKey(t),
+			ApplicationID:  10,
+			InstallationID: 20,
+		},
+	)
+	require.NoError(t, err)
+
+	err = gh.CheckAppAuthentication(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, "20", actualInstallation)
+	assert.True(t, strings.HasPrefix(actualAuth, "Bearer "), "application JWT expected")
+}
+
+func TestCheckAppAuthentication_FailsWhenRejected(t *testing.T) {
+	router := http.NewServeMux()
+
+	router.HandleFunc("/app/installations/{installationID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	svr := httptest.NewServer(router)
+	defer svr.Close()
+
+	gh, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			ApiURL:         svr.URL,
+			PrivateKey:     generateKey(t),
+			ApplicationID:  10,
+			InstallationID: 20,
+		},
+	)
+	require.NoError(t, err)
+
+	err = gh.CheckAppAuthentication(context.Background())
+
+	assert.ErrorContains(t, err, ": 401")
+}
+
+func TestCheckSigner_Succeeds(t *testing.T) {
+	gh, err := github.New(
+		context.Background(),
+		config.GithubConfig{
+			PrivateKey:     generateKey(t),
+			ApplicationID:  10,
+			InstallationID: 20,
+		},
+	)
+	require.NoError(t, err)
+
+	err = gh.CheckSigner(context.Background())
+
+	assert.NoError(t, err)
+}
+
 func JSON(w http.ResponseWriter, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	res, _ := json.Marshal(payload)
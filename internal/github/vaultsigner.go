@@ -0,0 +1,42 @@
+package github
+
+import (
+	"context"
+
+	"github.com/bradleyfalzon/ghinstallation/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rs/zerolog"
+)
+
+var _ ghinstallation.Signer = VaultTransitSigner{}
+
+// VaultTransitClient defines the Vault API required by the VaultTransitSigner.
+type VaultTransitClient interface {
+	TransitSign(ctx context.Context, key string, digest []byte) ([]byte, error)
+}
+
+// VaultTransitSigner defines a Signer compatible with the ghinstallation
+// plugin that uses a HashiCorp Vault Transit key to sign the JWT. As with KMS,
+// the private key is never exposed to the application.
+type VaultTransitSigner struct {
+	Key    string
+	Method jwt.SigningMethod
+}
+
+func NewVaultTransitSigner(client VaultTransitClient, key string) VaultTransitSigner {
+	return VaultTransitSigner{
+		Key: key,
+		Method: remoteRS256{
+			service: "Vault Transit",
+			sign: func(ctx context.Context, digest []byte) ([]byte, error) {
+				return client.TransitSign(ctx, key, digest)
+			},
+		},
+	}
+}
+
+func (s VaultTransitSigner) Sign(claims jwt.Claims) (string, error) {
+	defer functionDuration(func(l zerolog.Logger) { l.Info().Msg("VaultTransitSigner.Sign()") })()
+
+	return jwt.NewWithClaims(s.Method, claims).SignedString(s.Key)
+}
@@ -0,0 +1,43 @@
+package github_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type VaultTransitClientFunc func(ctx context.Context, key string, digest []byte) ([]byte, error)
+
+func (f VaultTransitClientFunc) TransitSign(ctx context.Context, key string, digest []byte) ([]byte, error) {
+	return f(ctx, key, digest)
+}
+
+// rsaTransit signs digests with a local key, as Vault Transit would.
+func rsaTransit(t *testing.T, key *rsa.PrivateKey) VaultTransitClientFunc {
+	return func(_ context.Context, name string, digest []byte) ([]byte, error) {
+		assert.Equal(t, "github-app", name)
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest)
+	}
+}
+
+func TestNew_VaultTransitKey(t *testing.T) {
+	cfg := config.GithubConfig{PrivateKeyVaultTransitKey: "github-app", ApplicationID: 1}
+
+	_, err := github.New(context.Background(), cfg)
+	assert.ErrorContains(t, err, "a Vault client is required")
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	gh, err := github.New(context.Background(), cfg, github.WithVaultClient(rsaTransit(t, key)))
+	require.NoError(t, err)
+
+	assert.NoError(t, gh.CheckSigner(context.Background()))
+}
@@ -0,0 +1,183 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK    = "ok"
+	StatusError = "error"
+
+	// checkTimeout limits the time any single check can take.
+	checkTimeout = 5 * time.Second
+
+	// failedMessage replaces the error of a failed check in a public report.
+	failedMessage = "check failed, details are in the service log"
+)
+
+// Check verifies a single dependency of the service, returning an error if the
+// dependency is not usable.
+type Check func(ctx context.Context) error
+
+// Report is the result of running all registered checks.
+type Report struct {
+	Status    string                 `json:"status"`
+	CheckedAt time.Time              `json:"checkedAt"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// Ready returns true if all checks in the report succeeded.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Public returns a copy of the report that can be returned to unauthenticated
+// callers. Check errors can include upstream URLs and API responses, so they
+// are replaced with a generic message.
+func (r Report) Public() Report {
+	public := r
+	public.Checks = make(map[string]CheckResult, len(r.Checks))
+
+	for name, result := range r.Checks {
+		if result.Error != "" {
+			result.Error = failedMessage
+		}
+		public.Checks[name] = result
+	}
+
+	return public
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker runs a set of dependency checks and caches the result for a short
+// period. Caching limits the load placed on upstream services when the
+// readiness of the service is polled frequently.
+type Checker struct {
+	ttl    time.Duration
+	checks []namedCheck
+
+	mu      sync.Mutex
+	report  *Report
+	running chan struct{} // closed when the checks in progress complete
+}
+
+// NewChecker creates a Checker that caches its report for the given duration.
+func NewChecker(ttl time.Duration) *Checker {
+	return &Checker{ttl: ttl}
+}
+
+// Add registers a named check. Checks must be added before the first report is
+// requested.
+func (c *Checker) Add(name string, check Check) {
+	c.checks = append(c.checks, namedCheck{name, check})
+}
+
+// Report returns the status of all checks. The checks are run concurrently in
+// the background if the cached report has expired, and concurrent callers share
+// the same run. The expired report is returned while the checks run, so that
+// callers are not held up by slow dependencies: only the first report is waited
+// for.
+func (c *Checker) Report(ctx context.Context) Report {
+	c.mu.Lock()
+	report, running := c.report, c.running
+	fresh := report != nil && time.Since(report.CheckedAt) < c.ttl
+	if !fresh && running == nil {
+		running = make(chan struct{})
+		c.running = running
+		go c.refresh(ctx, running)
+	}
+	c.mu.Unlock()
+
+	if report != nil {
+		return *report
+	}
+
+	// the run is bounded by the check timeout
+	<-running
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return *c.report
+}
+
+// refresh runs the checks and stores the report, then closes done.
+func (c *Checker) refresh(ctx context.Context, done chan struct{}) {
+	report := c.run(ctx)
+
+	c.mu.Lock()
+	c.report = &report
+	c.running = nil
+	c.mu.Unlock()
+
+	close(done)
+}
+
+func (c *Checker) run(ctx context.Context) Report {
+	// the checks are run independently of the request that triggered them, as
+	// the result is shared
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), checkTimeout)
+	defer cancel()
+
+	results := make([]CheckResult, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, nc := range c.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, nc.check)
+		}()
+	}
+	wg.Wait()
+
+	report := Report{
+		Status:    StatusOK,
+		CheckedAt: time.Now(),
+		Checks:    make(map[string]CheckResult, len(c.checks)),
+	}
+
+	for i, nc := range c.checks {
+		result := results[i]
+		if result.Status != StatusOK {
+			report.Status = StatusError
+		}
+		report.Checks[nc.name] = result
+	}
+
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) (result CheckResult) {
+	start := time.Now()
+	defer func() {
+		result.DurationMs = time.Since(start).Milliseconds()
+	}()
+
+	if err := check(ctx); err != nil {
+		return CheckResult{Status: StatusError, Error: err.Error()}
+	}
+
+	return CheckResult{Status: StatusOK}
+}
+
+// Static adapts a function that reports readiness without needing a context,
+// such as the JWKS readiness check.
+func Static(ready func() error) Check {
+	return func(_ context.Context) error {
+		return ready()
+	}
+}
@@ -0,0 +1,137 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker_AllChecksPass(t *testing.T) {
+	c := health.NewChecker(time.Minute)
+	c.Add("one", func(context.Context) error { return nil })
+	c.Add("two", health.Static(func() error { return nil }))
+
+	report := c.Report(context.Background())
+
+	assert.True(t, report.Ready())
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, health.StatusOK, report.Checks["one"].Status)
+	assert.Equal(t, health.StatusOK, report.Checks["two"].Status)
+}
+
+func TestChecker_FailedCheckReported(t *testing.T) {
+	c := health.NewChecker(time.Minute)
+	c.Add("good", func(context.Context) error { return nil })
+	c.Add("bad", func(context.Context) error { return errors.New("token revoked") })
+
+	report := c.Report(context.Background())
+
+	assert.False(t, report.Ready())
+	assert.Equal(t, health.StatusError, report.Status)
+	assert.Equal(t, health.StatusOK, report.Checks["good"].Status)
+	assert.Equal(t, health.CheckResult{Status: health.StatusError, Error: "token revoked"}, withoutDuration(report.Checks["bad"]))
+}
+
+func TestChecker_ResultsCached(t *testing.T) {
+	var calls atomic.Int32
+
+	c := health.NewChecker(time.Minute)
+	c.Add("counted", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	c.Report(context.Background())
+	c.Report(context.Background())
+
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestChecker_ResultsExpire(t *testing.T) {
+	var calls atomic.Int32
+
+	c := health.NewChecker(0)
+	c.Add("counted", func(context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+
+	c.Report(context.Background())
+	c.Report(context.Background())
+
+	// the expired report is returned while the checks run again
+	assert.Eventually(t, func() bool { return calls.Load() == 2 }, time.Second, 10*time.Millisecond)
+}
+
+func TestChecker_SlowChecksDoNotBlockCallers(t *testing.T) {
+	release := make(chan struct{})
+	var slow atomic.Bool
+
+	c := health.NewChecker(0)
+	c.Add("dependency", func(context.Context) error {
+		if slow.Load() {
+			<-release
+			return errors.New("timed out")
+		}
+		return nil
+	})
+
+	// the first report is waited for
+	assert.True(t, c.Report(context.Background()).Ready())
+
+	slow.Store(true)
+	defer close(release)
+
+	done := make(chan health.Report)
+	go func() {
+		c.Report(context.Background())
+		done <- c.Report(context.Background())
+	}()
+
+	select {
+	case report := <-done:
+		assert.True(t, report.Ready(), "the previous report is returned")
+	case <-time.After(time.Second):
+		t.Fatal("callers waited for the checks in progress")
+	}
+}
+
+func TestReport_PublicOmitsErrors(t *testing.T) {
+	c := health.NewChecker(time.Minute)
+	c.Add("good", func(context.Context) error { return nil })
+	c.Add("bad", func(context.Context) error { return errors.New("GET https://internal.example.com: 500") })
+
+	report := c.Report(context.Background())
+	public := report.Public()
+
+	assert.Equal(t, health.StatusError, public.Status)
+	assert.Equal(t, health.StatusOK, public.Checks["good"].Status)
+	assert.Equal(t, health.StatusError, public.Checks["bad"].Status)
+	assert.NotContains(t, public.Checks["bad"].Error, "internal.example.com")
+
+	// the original report retains the error for logging
+	assert.Equal(t, "GET https://internal.example.com: 500", report.Checks["bad"].Error)
+}
+
+func TestChecker_ChecksNotCancelledWithRequest(t *testing.T) {
+	c := health.NewChecker(time.Minute)
+	c.Add("context", func(ctx context.Context) error { return ctx.Err() })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report := c.Report(ctx)
+
+	assert.True(t, report.Ready())
+}
+
+func withoutDuration(r health.CheckResult) health.CheckResult {
+	r.DurationMs = 0
+	return r
+}
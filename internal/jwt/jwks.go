@@ -0,0 +1,381 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog/log"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+
+	// The validator uses go-jose v2: the key set must use the same version to
+	// be recognized during signature verification.
+	"gopkg.in/go-jose/go-jose.v2"
+	"gopkg.in/go-jose/go-jose.v2/jwt"
+)
+
+const (
+	defaultJWKSRefreshInterval    = 5 * time.Minute
+	defaultJWKSMinRefreshInterval = 15 * time.Second
+
+	// JWKS documents are small: anything larger than this is unexpected.
+	maxJWKSResponseBytes = 1 << 20 // 1 MB
+)
+
+// ErrKeySetUnavailable is returned when a token cannot be verified because no
+// key set has been successfully loaded.
+var ErrKeySetUnavailable = errors.New("JWKS not available")
+
+// KeySet supplies the JSON Web Key Set used to verify the signature of incoming
+// JWTs.
+type KeySet interface {
+	// Keys returns the current key set. ErrKeySetUnavailable is returned if no
+	// key set has been loaded.
+	Keys(ctx context.Context) (*jose.JSONWebKeySet, error)
+
+	// RequireKey is called before a token is verified with the key ID from the
+	// token header. Implementations may refresh the key set if the key is not
+	// known. An error is only returned when no key set is available at all: an
+	// unknown key will fail signature validation as normal.
+	RequireKey(ctx context.Context, kid string) error
+
+	// Ready returns nil if the key set is loaded and available for use, or an
+	// error describing why it is not.
+	Ready() error
+}
+
+// NewKeySet creates the KeySet appropriate for the configuration. A remote key
+// set begins loading immediately, and is refreshed in the background until the
+// supplied context is cancelled. A file key set is watched for changes for the
+// lifetime of the context.
+func NewKeySet(ctx context.Context, cfg config.AuthorizationConfig) (KeySet, error) {
+	// allow for static configuration when testing
+	if cfg.ConfigurationStatic != "" {
+		return newStaticKeySet(cfg.ConfigurationStatic)
+	}
+
+	if cfg.JWKSFile != "" {
+		pollInterval := secondsOrDefault(cfg.JWKSFilePollIntervalSeconds, defaultJWKSFilePollInterval)
+		return newFileKeySet(ctx, cfg.JWKSFile, pollInterval)
+	}
+
+	return newRemoteKeySet(ctx, cfg)
+}
+
+// ValidateConfig checks the authorization configuration without fetching any
+// keys: the issuer and JWKS URLs must be absolute, a static or file key set
+// must be valid, and only one of the JWKS file and URL may be set.
+func ValidateConfig(cfg config.AuthorizationConfig) error {
+	var errs []error
+
+	if err := validateURL(cfg.IssuerURL); err != nil {
+		errs = append(errs, fmt.Errorf("invalid JWT_ISSUER_URL: %w", err))
+	}
+
+	if cfg.JWKSURL != "" {
+		if err := validateURL(cfg.JWKSURL); err != nil {
+			errs = append(errs, fmt.Errorf("invalid JWT_JWKS_URL: %w", err))
+		}
+	}
+
+	if cfg.ConfigurationStatic != "" {
+		if _, err := parseJWKS([]byte(cfg.ConfigurationStatic)); err != nil {
+			errs = append(errs, fmt.Errorf("invalid JWT_JWKS_STATIC: %w", err))
+		}
+	}
+
+	if cfg.JWKSFile != "" {
+		content, err := os.ReadFile(cfg.JWKSFile)
+		if err == nil {
+			_, err = parseJWKSFile(content)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid JWT_JWKS_FILE: %w", err))
+		}
+
+		if cfg.JWKSURL != "" {
+			errs = append(errs, errors.New("JWT_JWKS_FILE and JWT_JWKS_URL cannot both be set"))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an absolute http or https URL", value)
+	}
+
+	return nil
+}
+
+// staticKeySet is a fixed key set supplied via configuration.
+type staticKeySet struct {
+	jwks *jose.JSONWebKeySet
+}
+
+func newStaticKeySet(content string) (staticKeySet, error) {
+	jwks, err := parseJWKS([]byte(content))
+	if err != nil {
+		return staticKeySet{}, err
+	}
+
+	return staticKeySet{jwks}, nil
+}
+
+func (s staticKeySet) Keys(_ context.Context) (*jose.JSONWebKeySet, error) {
+	return s.jwks, nil
+}
+
+func (s staticKeySet) RequireKey(_ context.Context, _ string) error {
+	return nil
+}
+
+func (s staticKeySet) Ready() error {
+	return nil
+}
+
+// remoteKeySet retrieves the key set from the issuer, either by using OIDC
+// discovery or from an explicitly configured JWKS URL. The key set is fetched
+// at startup and refreshed periodically in the background. A token that refers
+// to an unknown key triggers a refresh, limited to one fetch per minimum
+// refresh interval.
+type remoteKeySet struct {
+	client             *http.Client
+	issuerURL          *url.URL
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	// fetchMu serializes fetches, and guards the fields used by the fetch process.
+	fetchMu   sync.Mutex
+	jwksURL   string
+	lastFetch time.Time
+
+	// stateMu guards the current key set and the error from the most recent
+	// fetch.
+	stateMu sync.RWMutex
+	jwks    *jose.JSONWebKeySet
+	lastErr error
+}
+
+func newRemoteKeySet(ctx context.Context, cfg config.AuthorizationConfig) (*remoteKeySet, error) {
+	issuerURL, err := url.Parse(cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the issuer URL: %w", err)
+	}
+
+	if cfg.JWKSURL != "" {
+		if _, err := url.Parse(cfg.JWKSURL); err != nil {
+			return nil, fmt.Errorf("failed to parse the JWKS URL: %w", err)
+		}
+	}
+
+	k := &remoteKeySet{
+		// the default client is configured with telemetry at startup
+		client:             http.DefaultClient,
+		issuerURL:          issuerURL,
+		jwksURL:            cfg.JWKSURL,
+		refreshInterval:    secondsOrDefault(cfg.JWKSRefreshIntervalSeconds, defaultJWKSRefreshInterval),
+		minRefreshInterval: secondsOrDefault(cfg.JWKSMinRefreshIntervalSeconds, defaultJWKSMinRefreshInterval),
+		lastErr:            errors.New("initial fetch pending"),
+	}
+
+	go k.refreshLoop(ctx)
+
+	return k, nil
+}
+
+func (k *remoteKeySet) Keys(_ context.Context) (*jose.JSONWebKeySet, error) {
+	k.stateMu.RLock()
+	defer k.stateMu.RUnlock()
+
+	if k.jwks == nil {
+		return nil, fmt.Errorf("%w: %w", ErrKeySetUnavailable, k.lastErr)
+	}
+
+	return k.jwks, nil
+}
+
+func (k *remoteKeySet) Ready() error {
+	_, err := k.Keys(context.Background())
+	return err
+}
+
+func (k *remoteKeySet) RequireKey(ctx context.Context, kid string) error {
+	if k.hasKey(kid) {
+		return nil
+	}
+
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+
+	// the key may have been loaded by another request while waiting
+	if k.hasKey(kid) {
+		return nil
+	}
+
+	if time.Since(k.lastFetch) >= k.minRefreshInterval {
+		log.Info().Str("kid", kid).Msg("jwks: unknown key requested, refreshing key set")
+		k.fetch(ctx)
+	}
+
+	// An unknown key will fail validation as normal, only a complete lack of
+	// keys is reported.
+	_, err := k.Keys(ctx)
+
+	return err
+}
+
+// hasKey returns true if a key set is loaded that contains the given key ID.
+// An empty key ID is satisfied by any loaded key set.
+func (k *remoteKeySet) hasKey(kid string) bool {
+	k.stateMu.RLock()
+	defer k.stateMu.RUnlock()
+
+	if k.jwks == nil {
+		return false
+	}
+
+	return kid == "" || len(k.jwks.Key(kid)) > 0
+}
+
+func (k *remoteKeySet) refreshLoop(ctx context.Context) {
+	for {
+		k.fetchMu.Lock()
+		k.fetch(ctx)
+		k.fetchMu.Unlock()
+
+		// retry failures sooner than the standard refresh
+		next := k.refreshInterval
+		if k.Ready() != nil {
+			next = k.minRefreshInterval
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(next):
+		}
+	}
+}
+
+// fetch retrieves the key set and updates the current state. A failure retains
+// any previously loaded keys. The caller must hold fetchMu.
+func (k *remoteKeySet) fetch(ctx context.Context) {
+	k.lastFetch = time.Now()
+
+	jwks, err := k.retrieve(ctx)
+
+	k.stateMu.Lock()
+	defer k.stateMu.Unlock()
+
+	k.lastErr = err
+	if err != nil {
+		log.Warn().Err(err).Bool("retainingPrevious", k.jwks != nil).Msg("jwks: refresh failed")
+		return
+	}
+
+	k.jwks = jwks
+
+	log.Info().Int("keys", len(jwks.Keys)).Msg("jwks: key set loaded")
+}
+
+func (k *remoteKeySet) retrieve(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	if k.jwksURL == "" {
+		jwksURL, err := k.discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		k.jwksURL = jwksURL
+	}
+
+	var jwks jose.JSONWebKeySet
+	if err := k.getJSON(ctx, k.jwksURL, &jwks); err != nil {
+		return nil, fmt.Errorf("could not retrieve JWKS: %w", err)
+	}
+
+	if len(jwks.Keys) == 0 {
+		return nil, fmt.Errorf("JWKS at %s contains no keys", k.jwksURL)
+	}
+
+	return &jwks, nil
+}
+
+// discover uses the issuer's OpenID configuration document to find the JWKS
+// URL.
+func (k *remoteKeySet) discover(ctx context.Context) (string, error) {
+	wellKnown := k.issuerURL.JoinPath(".well-known", "openid-configuration")
+
+	var discovery struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := k.getJSON(ctx, wellKnown.String(), &discovery); err != nil {
+		return "", fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	if discovery.JWKSURI == "" {
+		return "", fmt.Errorf("OIDC discovery failed: jwks_uri not present in %s", wellKnown)
+	}
+
+	return discovery.JWKSURI, nil
+}
+
+func (k *remoteKeySet) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxJWKSResponseBytes)).Decode(v)
+}
+
+// keySetValidator ensures that the key referenced by the token is available
+// before the token is validated, giving the key set the opportunity to refresh
+// when keys are rotated.
+func keySetValidator(keys KeySet, next jwtmiddleware.ValidateToken) jwtmiddleware.ValidateToken {
+	return func(ctx context.Context, token string) (interface{}, error) {
+		// a token that can't be parsed will be rejected by the validator
+		kid := ""
+		if parsed, err := jwt.ParseSigned(token); err == nil && len(parsed.Headers) > 0 {
+			kid = parsed.Headers[0].KeyID
+		}
+
+		if err := keys.RequireKey(ctx, kid); err != nil {
+			return nil, err
+		}
+
+		return next(ctx, token)
+	}
+}
+
+func secondsOrDefault(seconds int, def time.Duration) time.Duration {
+	if seconds <= 0 {
+		return def
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,235 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/justinas/alice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteKeySet_DiscoversAndLoadsAtStartup(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	jwk := generateJWK(t)
+	server := setupTestServer(t, jwk)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys, err := NewKeySet(ctx, config.AuthorizationConfig{IssuerURL: server.URL})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return keys.Ready() == nil }, 2*time.Second, 10*time.Millisecond)
+
+	jwks, err := keys.Keys(ctx)
+	require.NoError(t, err)
+	assert.Len(t, jwks.Key("kid"), 1)
+}
+
+func TestRemoteKeySet_UsesConfiguredJWKSURL(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	jwk := generateJWK(t)
+	server := setupTestServer(t, jwk)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the issuer is not reachable, so discovery would fail
+	keys, err := NewKeySet(ctx, config.AuthorizationConfig{
+		IssuerURL: "http://issuer.invalid",
+		JWKSURL:   server.URL + "/.well-known/jwks.json",
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return keys.Ready() == nil }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestRemoteKeySet_NotReadyWhenUnavailable(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys, err := NewKeySet(ctx, config.AuthorizationConfig{IssuerURL: server.URL})
+	require.NoError(t, err)
+
+	err = keys.RequireKey(ctx, "kid")
+	assert.ErrorIs(t, err, ErrKeySetUnavailable)
+	assert.ErrorIs(t, keys.Ready(), ErrKeySetUnavailable)
+}
+
+func TestRemoteKeySet_UnknownKeyTriggersLimitedRefresh(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	var fetches atomic.Int32
+	var current atomic.Pointer[jose.JSONWebKey]
+	current.Store(generateJWK(t))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{current.Load().Public()},
+		})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys, err := newRemoteKeySet(ctx, config.AuthorizationConfig{
+		IssuerURL:                     server.URL,
+		JWKSURL:                       server.URL,
+		JWKSRefreshIntervalSeconds:    3600,
+		JWKSMinRefreshIntervalSeconds: 3600,
+	})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return keys.Ready() == nil }, 2*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// known key: no refresh required
+	require.NoError(t, keys.RequireKey(ctx, "kid"))
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// unknown key within the minimum interval: no refresh, existing keys retained
+	rotated := generateJWK(t)
+	rotated.KeyID = "rotated"
+	current.Store(rotated)
+
+	require.NoError(t, keys.RequireKey(ctx, "rotated"))
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// unknown key after the minimum interval: refresh occurs
+	keys.minRefreshInterval = 0
+
+	require.NoError(t, keys.RequireKey(ctx, "rotated"))
+	assert.Equal(t, int32(2), fetches.Load())
+	assert.True(t, keys.hasKey("rotated"))
+}
+
+func TestMiddleware_UnavailableKeysReportedAsServiceFailure(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := config.AuthorizationConfig{
+		Audience:                  "audience",
+		IssuerURL:                 server.URL,
+		BuildkiteOrganizationSlug: "test-organization",
+	}
+
+	keys, err := NewKeySet(ctx, cfg)
+	require.NoError(t, err)
+
+	authMiddleware, err := Middleware(cfg, keys)
+	require.NoError(t, err)
+
+	jwk := generateJWK(t)
+	token := createRequestJWT(t, jwk, server.URL, valid(jwt.Claims{
+		Audience: []string{"audience"},
+		Subject:  "subject",
+	}), custom("test-organization", "test-pipeline"))
+
+	auditCtx, _ := audit.Context(ctx)
+	request, err := http.NewRequestWithContext(auditCtx, http.MethodGet, "", nil)
+	require.NoError(t, err)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	responseRecorder := httptest.NewRecorder()
+
+	handler := alice.New(audit.Middleware(), authMiddleware).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler.ServeHTTP(responseRecorder, request)
+
+	assert.Equal(t, http.StatusServiceUnavailable, responseRecorder.Code)
+
+	entry := audit.Log(auditCtx)
+	assert.False(t, entry.Authorized)
+	assert.Contains(t, entry.Error, "JWKS not available")
+}
+
+func TestStaticKeySet(t *testing.T) {
+	jwk := generateJWK(t)
+
+	content, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	require.NoError(t, err)
+
+	keys, err := NewKeySet(context.Background(), config.AuthorizationConfig{
+		ConfigurationStatic: string(content),
+	})
+	require.NoError(t, err)
+
+	assert.NoError(t, keys.Ready())
+	assert.NoError(t, keys.RequireKey(context.Background(), "unknown"))
+
+	jwks, err := keys.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, jwks.Key("kid"), 1)
+}
+
+func TestStaticKeySet_InvalidContent(t *testing.T) {
+	_, err := NewKeySet(context.Background(), config.AuthorizationConfig{
+		ConfigurationStatic: "{not json",
+	})
+	assert.ErrorContains(t, err, "could not decode jwks")
+}
+
+func TestStaticKeySet_AllowsEmptyKeySet(t *testing.T) {
+	keys, err := NewKeySet(context.Background(), config.AuthorizationConfig{
+		ConfigurationStatic: `{"keys":[]}`,
+	})
+	require.NoError(t, err)
+
+	jwks, err := keys.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, jwks.Keys)
+}
+
+func TestValidateConfig(t *testing.T) {
+	assert.NoError(t, ValidateConfig(config.AuthorizationConfig{IssuerURL: "https://agent.buildkite.com"}))
+
+	err := ValidateConfig(config.AuthorizationConfig{
+		IssuerURL:           "agent.buildkite.com",
+		JWKSURL:             "ftp://example.com/jwks",
+		ConfigurationStatic: "{not json",
+		JWKSFile:            "/does/not/exist.json",
+	})
+	assert.ErrorContains(t, err, `invalid JWT_ISSUER_URL: "agent.buildkite.com" is not an absolute http or https URL`)
+	assert.ErrorContains(t, err, "invalid JWT_JWKS_URL")
+	assert.ErrorContains(t, err, "invalid JWT_JWKS_STATIC: could not decode jwks")
+	assert.ErrorContains(t, err, "invalid JWT_JWKS_FILE")
+	assert.ErrorContains(t, err, "JWT_JWKS_FILE and JWT_JWKS_URL cannot both be set")
+
+	// only a key set file is required to contain keys
+	assert.NoError(t, ValidateConfig(config.AuthorizationConfig{
+		IssuerURL:           "https://agent.buildkite.com",
+		ConfigurationStatic: `{"keys":[]}`,
+	}))
+}
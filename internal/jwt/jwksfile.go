@@ -0,0 +1,141 @@
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/go-jose/go-jose.v2"
+)
+
+const defaultJWKSFilePollInterval = 10 * time.Second
+
+// fileKeySet reads the key set from a file, polling for changes. Polling is
+// used rather than filesystem notifications as it is robust to the symlink
+// swaps used when Kubernetes updates mounted secrets. A changed file is parsed
+// completely before it replaces the current key set, so a file that fails to
+// parse never replaces the last good keys.
+type fileKeySet struct {
+	path string
+
+	// digest and rejected are only accessed by the reload process, which is
+	// not concurrent.
+	digest   []byte
+	rejected []byte
+
+	mu   sync.RWMutex
+	jwks *jose.JSONWebKeySet
+}
+
+func newFileKeySet(ctx context.Context, path string, pollInterval time.Duration) (*fileKeySet, error) {
+	k := &fileKeySet{path: path}
+
+	// the file must be valid at startup: this is a configuration error
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	go k.watch(ctx, pollInterval)
+
+	return k, nil
+}
+
+func (k *fileKeySet) Keys(_ context.Context) (*jose.JSONWebKeySet, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.jwks, nil
+}
+
+func (k *fileKeySet) RequireKey(_ context.Context, _ string) error {
+	// keys are loaded when the file changes, not on demand
+	return nil
+}
+
+// Ready is always successful as the initial load is required to succeed. A
+// subsequent failure to reload retains the previous keys.
+func (k *fileKeySet) Ready() error {
+	return nil
+}
+
+func (k *fileKeySet) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := k.reload(); err != nil {
+				log.Error().Err(err).Str("path", k.path).Msg("jwks: file reload failed, retaining previous keys")
+			}
+		}
+	}
+}
+
+// reload reads the file and replaces the current key set if the content has
+// changed and is valid.
+func (k *fileKeySet) reload() error {
+	content, err := os.ReadFile(k.path)
+	if err != nil {
+		return fmt.Errorf("could not read JWKS file: %w", err)
+	}
+
+	digest := sha256.Sum256(content)
+
+	// Unchanged content needs no further processing. Content that has already
+	// been rejected is not reported again until it changes.
+	if bytes.Equal(k.digest, digest[:]) || bytes.Equal(k.rejected, digest[:]) {
+		return nil
+	}
+
+	jwks, err := parseJWKSFile(content)
+	if err != nil {
+		k.rejected = digest[:]
+		return fmt.Errorf("invalid JWKS file %s: %w", k.path, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.jwks = jwks
+	k.digest = digest[:]
+	k.rejected = nil
+
+	log.Info().Str("path", k.path).Int("keys", len(jwks.Keys)).Msg("jwks: key set loaded from file")
+
+	return nil
+}
+
+func parseJWKS(content []byte) (*jose.JSONWebKeySet, error) {
+	var jwks jose.JSONWebKeySet
+	if err := json.Unmarshal(content, &jwks); err != nil {
+		return nil, fmt.Errorf("could not decode jwks: %w", err)
+	}
+
+	return &jwks, nil
+}
+
+// parseJWKSFile parses the content of a JWKS file. A file without keys is
+// rejected, as it is more likely to be a partially written file than an
+// intentional change.
+func parseJWKSFile(content []byte) (*jose.JSONWebKeySet, error) {
+	jwks, err := parseJWKS(content)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jwks.Keys) == 0 {
+		return nil, errors.New("jwks contains no keys")
+	}
+
+	return jwks, nil
+}
@@ -0,0 +1,103 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileKeySet_LoadsAtStartup(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKSFile(t, path, generateJWK(t))
+
+	keys, err := NewKeySet(context.Background(), config.AuthorizationConfig{JWKSFile: path})
+	require.NoError(t, err)
+
+	assert.NoError(t, keys.Ready())
+
+	jwks, err := keys.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, jwks.Key("kid"), 1)
+}
+
+func TestFileKeySet_InvalidAtStartup(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	dir := t.TempDir()
+
+	_, err := NewKeySet(context.Background(), config.AuthorizationConfig{JWKSFile: filepath.Join(dir, "missing.json")})
+	assert.ErrorContains(t, err, "could not read JWKS file")
+
+	path := filepath.Join(dir, "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[]}`), 0o600))
+
+	_, err = NewKeySet(context.Background(), config.AuthorizationConfig{JWKSFile: path})
+	assert.ErrorContains(t, err, "contains no keys")
+}
+
+func TestFileKeySet_ReloadsOnChange(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKSFile(t, path, generateJWK(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys, err := newFileKeySet(ctx, path, 10*time.Millisecond)
+	require.NoError(t, err)
+
+	rotated := generateJWK(t)
+	rotated.KeyID = "rotated"
+	writeJWKSFile(t, path, rotated)
+
+	require.Eventually(t, func() bool {
+		jwks, _ := keys.Keys(ctx)
+		return len(jwks.Key("rotated")) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestFileKeySet_InvalidChangeRetainsPreviousKeys(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKSFile(t, path, generateJWK(t))
+
+	keys, err := newFileKeySet(context.Background(), path, time.Hour)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o600))
+
+	err = keys.reload()
+	assert.ErrorContains(t, err, "could not decode jwks")
+
+	// the same invalid content is only reported once
+	assert.NoError(t, keys.reload())
+
+	jwks, err := keys.Keys(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, jwks.Key("kid"), 1)
+}
+
+func writeJWKSFile(t *testing.T, path string, jwk *jose.JSONWebKey) {
+	t.Helper()
+
+	content, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk.Public()}})
+	require.NoError(t, err)
+
+	// write and rename so the change is atomic, as it is for mounted secrets
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, content, 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+}
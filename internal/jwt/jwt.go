@@ -2,17 +2,15 @@ package jwt
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"time"
 
-	"github.com/go-jose/go-jose/v4"
 	"github.com/justinas/alice"
 
 	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
-	"github.com/auth0/go-jwt-middleware/v2/jwks"
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 
 	"github.com/jamestelfer/chinmina-bridge/internal/audit"
@@ -21,17 +19,16 @@ import (
 
 // Middleware returns HTTP middleware that verifies the JWT and
 // enforces the validity claims. The retrieved claims are set on the request
-// context and can be retrieved by calling jwt.ClaimsFromContext(ctx).
-func Middleware(cfg config.AuthorizationConfig, options ...jwtmiddleware.Option) (func(http.Handler) http.Handler, error) {
-	// allow for static configuration when testing
-	jwksConfig := remoteJWKS
-	if cfg.ConfigurationStatic != "" {
-		jwksConfig = staticJWKS
+// context and can be retrieved by calling jwt.ClaimsFromContext(ctx). The
+// signature of the JWT is verified using the supplied key set.
+func Middleware(cfg config.AuthorizationConfig, keys KeySet, options ...jwtmiddleware.Option) (func(http.Handler) http.Handler, error) {
+	url, err := url.Parse(cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the issuer URL: %w", err)
 	}
 
-	url, keyFunc, err := jwksConfig(cfg)
-	if err != nil {
-		return nil, err
+	keyFunc := func(ctx context.Context) (any, error) {
+		return keys.Keys(ctx)
 	}
 
 	// the validator is used by the middleware to check the JWT signature and claims
@@ -60,7 +57,9 @@ func Middleware(cfg config.AuthorizationConfig, options ...jwtmiddleware.Option)
 
 	// wrap the standard validator with additional validation that ensures the
 	// core claims (including validity periods) are present
-	tokenValidator := registeredClaimsValidator(jwtValidator.ValidateToken)
+	tokenValidator := registeredClaimsValidator(
+		keySetValidator(keys, jwtValidator.ValidateToken),
+	)
 
 	validationMiddleware := jwtmiddleware.New(tokenValidator, options...).CheckJWT
 
@@ -121,6 +120,19 @@ func auditClaimsMiddleware() func(next http.Handler) http.Handler {
 				entry.AuthIssuer = reg.Issuer
 				entry.AuthAudience = reg.Audience
 				entry.AuthExpirySecs = reg.Expiry
+
+				if bk, ok := claims.CustomClaims.(*BuildkiteClaims); ok {
+					entry.OrganizationSlug = bk.OrganizationSlug
+					entry.PipelineSlug = bk.PipelineSlug
+					entry.PipelineID = bk.PipelineID
+					entry.BuildNumber = bk.BuildNumber
+					entry.BuildBranch = bk.BuildBranch
+					entry.BuildTag = bk.BuildTag
+					entry.BuildCommit = bk.BuildCommit
+					entry.StepKey = bk.StepKey
+					entry.JobID = bk.JobId
+					entry.AgentID = bk.AgentId
+				}
 			}
 
 			next.ServeHTTP(w, r)
@@ -133,38 +145,18 @@ func auditErrorHandler() jwtmiddleware.ErrorHandler {
 		entry := audit.Log(r.Context())
 		entry.Error = fmt.Sprintf("JWT authorization failure: %s", err.Error())
 
+		// Without keys no token can be verified: this is a service failure, not
+		// a client failure, so it's not reported as unauthorized.
+		if errors.Is(err, ErrKeySetUnavailable) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"message":"JWT verification keys are not available."}`))
+			return
+		}
+
 		// The default error handler will write the appropriate response status
 		// code. The status code is recorded centrally by the central audit
 		// middleware.
 		jwtmiddleware.DefaultErrorHandler(w, r, err)
 	}
 }
-
-type KeyFunc = func(ctx context.Context) (any, error)
-
-func remoteJWKS(cfg config.AuthorizationConfig) (url.URL, KeyFunc, error) {
-	issuerURL, err := url.Parse(cfg.IssuerURL)
-	if err != nil {
-		return url.URL{}, nil, fmt.Errorf("failed to parse the issuer URL: %w", err)
-	}
-
-	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
-
-	return *issuerURL, provider.KeyFunc, nil
-}
-
-func staticJWKS(cfg config.AuthorizationConfig) (url.URL, KeyFunc, error) {
-	issuerURL, err := url.Parse(cfg.IssuerURL)
-	if err != nil {
-		return url.URL{}, nil, fmt.Errorf("failed to parse the issuer URL: %w", err)
-	}
-
-	var jwks jose.JSONWebKeySet
-	if err := json.Unmarshal([]byte(cfg.ConfigurationStatic), &jwks); err != nil {
-		return url.URL{}, nil, fmt.Errorf("could not decode jwks: %w", err)
-	}
-
-	keyFunc := func(_ context.Context) (any, error) { return jwks, nil }
-
-	return *issuerURL, keyFunc, nil
-}
@@ -134,7 +134,10 @@ func TestMiddleware(t *testing.T) {
 
 			responseRecorder := httptest.NewRecorder()
 
-			authMiddleware, err := Middleware(cfg, test.options...)
+			keys, err := NewKeySet(context.Background(), cfg)
+			require.NoError(t, err)
+
+			authMiddleware, err := Middleware(cfg, keys, test.options...)
 			require.NoError(t, err)
 
 			testMiddleware := alice.New(audit.Middleware(), authMiddleware)
@@ -154,6 +157,14 @@ func TestMiddleware(t *testing.T) {
 				assert.Equal(t, "subject", auditEntry.AuthSubject)
 				assert.ElementsMatch(t, []string{"audience"}, auditEntry.AuthAudience)
 				assert.NotZero(t, auditEntry.AuthExpirySecs)
+				assert.Equal(t, expectedOrganizationSlug, auditEntry.OrganizationSlug)
+				assert.Equal(t, "test-pipeline", auditEntry.PipelineSlug)
+				assert.Equal(t, "test-pipeline--UUID", auditEntry.PipelineID)
+				assert.Equal(t, "default-buildbranch", auditEntry.BuildBranch)
+				assert.Equal(t, "default-buildcommit", auditEntry.BuildCommit)
+				assert.Equal(t, "default-stepkey", auditEntry.StepKey)
+				assert.Equal(t, "default-jobid", auditEntry.JobID)
+				assert.Equal(t, "default-agentid", auditEntry.AgentID)
 			} else {
 				assert.False(t, auditEntry.Authorized)
 				assert.NotEmpty(t, auditEntry.Error)
@@ -161,6 +172,7 @@ func TestMiddleware(t *testing.T) {
 				assert.Empty(t, auditEntry.AuthSubject)
 				assert.Empty(t, auditEntry.AuthAudience)
 				assert.Zero(t, auditEntry.AuthExpirySecs)
+				assert.Empty(t, auditEntry.PipelineID)
 			}
 		})
 	}
@@ -0,0 +1,174 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Components are the subsystems whose log level can be set independently of
+// the global level.
+var Components = []string{"http", "vendor", "github", "buildkite", "otel"}
+
+// settings are the levels and sampling applied to log events. They are
+// replaced as a whole when the configuration changes, so events are never
+// filtered with a mix of old and new settings.
+type settings struct {
+	level       zerolog.Level
+	components  map[string]zerolog.Level
+	infoSampler zerolog.Sampler
+}
+
+var current atomic.Pointer[settings]
+
+func init() {
+	current.Store(&settings{level: zerolog.InfoLevel})
+}
+
+// Validate checks the levels and format of the log configuration.
+func Validate(cfg config.LogConfig) error {
+	var errs []error
+
+	if _, err := ParseLevel(cfg.Level); err != nil {
+		errs = append(errs, err)
+	}
+
+	if _, err := ParseComponentLevels(cfg.ComponentLevels); err != nil {
+		errs = append(errs, err)
+	}
+
+	switch cfg.Format {
+	case "", "json", "console":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log format %q, expected json or console", cfg.Format))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Apply validates the log configuration, then replaces the current levels and
+// sampling. It takes effect immediately for all loggers that use Sampler.
+func Apply(cfg config.LogConfig) error {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+
+	components, err := ParseComponentLevels(cfg.ComponentLevels)
+	if err != nil {
+		return err
+	}
+
+	next := &settings{level: level, components: components}
+
+	if cfg.SampleInfoBurst > 0 {
+		next.infoSampler = &zerolog.BurstSampler{
+			Burst:  uint32(cfg.SampleInfoBurst),
+			Period: time.Duration(cfg.SampleInfoPeriodSecs) * time.Second,
+		}
+	}
+
+	current.Store(next)
+
+	return nil
+}
+
+// ParseComponentLevels parses a map of component names to level names, failing
+// if a component or level is not known.
+func ParseComponentLevels(configured map[string]string) (map[string]zerolog.Level, error) {
+	parsed := make(map[string]zerolog.Level, len(configured))
+
+	for component, name := range configured {
+		if !slices.Contains(Components, component) {
+			return nil, fmt.Errorf("unknown log component %q, expected one of %v", component, Components)
+		}
+
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level for component %q: %w", component, err)
+		}
+
+		parsed[component] = level
+	}
+
+	return parsed, nil
+}
+
+// ParseLevel parses a level name (trace, debug, info, warn, error, fatal,
+// panic or disabled). The empty string is treated as info.
+func ParseLevel(name string) (zerolog.Level, error) {
+	if name == "" {
+		return zerolog.InfoLevel, nil
+	}
+
+	level, err := zerolog.ParseLevel(name)
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("unknown log level %q", name)
+	}
+
+	return level, nil
+}
+
+// ComponentLevel returns the configured level of the component, if it has one.
+func ComponentLevel(component string) (zerolog.Level, bool) {
+	level, ok := current.Load().components[component]
+	return level, ok
+}
+
+// Sampler returns a zerolog sampler that applies the configured level of the
+// component (or the global level if the component is empty or has no level),
+// and samples info events if configured. Levels above panic are custom levels
+// (such as the audit level) and are always written.
+func Sampler(component string) zerolog.Sampler {
+	return levelSampler{component}
+}
+
+type levelSampler struct {
+	component string
+}
+
+func (s levelSampler) Sample(lvl zerolog.Level) bool {
+	if lvl > zerolog.PanicLevel {
+		return true
+	}
+
+	st := current.Load()
+
+	threshold := st.level
+	if level, ok := st.components[s.component]; ok {
+		threshold = level
+	}
+
+	if lvl < threshold {
+		return false
+	}
+
+	if lvl == zerolog.InfoLevel && st.infoSampler != nil {
+		return st.infoSampler.Sample(lvl)
+	}
+
+	return true
+}
+
+// Component returns a logger for the component, derived from the global logger.
+func Component(component string) *zerolog.Logger {
+	return forComponent(log.Logger, component)
+}
+
+// Ctx returns a logger for the component, derived from the context logger.
+func Ctx(ctx context.Context, component string) *zerolog.Logger {
+	return forComponent(*zerolog.Ctx(ctx), component)
+}
+
+func forComponent(base zerolog.Logger, component string) *zerolog.Logger {
+	l := base.Sample(Sampler(component)).With().Str("component", component).Logger()
+
+	return &l
+}
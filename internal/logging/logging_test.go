@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels(map[string]string{"vendor": "debug", "otel": "warn"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]zerolog.Level{"vendor": zerolog.DebugLevel, "otel": zerolog.WarnLevel}, levels)
+}
+
+func TestParseComponentLevels_Invalid(t *testing.T) {
+	_, err := ParseComponentLevels(map[string]string{"database": "debug"})
+	assert.ErrorContains(t, err, `unknown log component "database"`)
+
+	_, err = ParseComponentLevels(map[string]string{"vendor": "loud"})
+	assert.ErrorContains(t, err, `invalid log level for component "vendor"`)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("")
+	require.NoError(t, err)
+	assert.Equal(t, zerolog.InfoLevel, level)
+
+	level, err = ParseLevel("warn")
+	require.NoError(t, err)
+	assert.Equal(t, zerolog.WarnLevel, level)
+
+	_, err = ParseLevel("verbose")
+	assert.ErrorContains(t, err, `unknown log level "verbose"`)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(config.LogConfig{Level: "debug", Format: "console"}))
+
+	err := Validate(config.LogConfig{Level: "loud", Format: "xml", ComponentLevels: map[string]string{"disk": "debug"}})
+	assert.ErrorContains(t, err, `unknown log level "loud"`)
+	assert.ErrorContains(t, err, `unknown log format "xml"`)
+	assert.ErrorContains(t, err, `unknown log component "disk"`)
+}
+
+func TestComponent_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	setupLogger(t, zerolog.New(&buf))
+
+	err := Apply(config.LogConfig{ComponentLevels: map[string]string{"vendor": "debug", "github": "error"}})
+	require.NoError(t, err)
+
+	Component("vendor").Debug().Msg("vendor debug")
+	Component("github").Info().Msg("github info")
+	Component("http").Debug().Msg("http debug")
+	Component("http").Info().Msg("http info")
+
+	out := buf.String()
+	assert.Contains(t, out, `"component":"vendor","message":"vendor debug"`)
+	assert.NotContains(t, out, "github info")
+	assert.NotContains(t, out, "http debug", "components without a level use the global level")
+	assert.Contains(t, out, "http info")
+}
+
+func TestCtx_UsesContextLogger(t *testing.T) {
+	setupLogger(t, zerolog.Nop())
+	err := Apply(config.LogConfig{ComponentLevels: map[string]string{"buildkite": "debug"}})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).With().Str("request", "1").Logger().WithContext(context.Background())
+
+	Ctx(ctx, "buildkite").Debug().Msg("lookup")
+
+	assert.Contains(t, buf.String(), `"request":"1","component":"buildkite","message":"lookup"`)
+}
+
+func TestSampler(t *testing.T) {
+	setupLogger(t, zerolog.Nop())
+
+	err := Apply(config.LogConfig{Level: "warn", SampleInfoBurst: 1, SampleInfoPeriodSecs: 3600})
+	require.NoError(t, err)
+
+	sampler := Sampler("")
+	assert.False(t, sampler.Sample(zerolog.DebugLevel))
+	assert.True(t, sampler.Sample(zerolog.ErrorLevel))
+
+	// the sampled level applies when the level is lowered
+	err = Apply(config.LogConfig{Level: "info", SampleInfoBurst: 1, SampleInfoPeriodSecs: 3600})
+	require.NoError(t, err)
+
+	assert.True(t, sampler.Sample(zerolog.InfoLevel))
+	assert.False(t, sampler.Sample(zerolog.InfoLevel), "info events beyond the burst are dropped")
+	assert.True(t, sampler.Sample(zerolog.ErrorLevel), "other levels are not sampled")
+
+	for range 10 {
+		assert.True(t, sampler.Sample(zerolog.Level(20)), "custom levels are never sampled")
+	}
+}
+
+func TestApply_InvalidKeepsCurrent(t *testing.T) {
+	setupLogger(t, zerolog.Nop())
+
+	err := Apply(config.LogConfig{Level: "error"})
+	require.NoError(t, err)
+
+	err = Apply(config.LogConfig{Level: "debug", ComponentLevels: map[string]string{"disk": "debug"}})
+	assert.ErrorContains(t, err, `unknown log component "disk"`)
+
+	assert.False(t, Sampler("").Sample(zerolog.InfoLevel), "the previous level still applies")
+}
+
+func setupLogger(t *testing.T, logger zerolog.Logger) {
+	t.Helper()
+
+	previous := log.Logger
+	t.Cleanup(func() {
+		log.Logger = previous
+		_ = Apply(config.LogConfig{})
+	})
+
+	log.Logger = logger
+}
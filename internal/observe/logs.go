@@ -0,0 +1,219 @@
+package observe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/rs/zerolog"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// logScope is the instrumentation scope of log records exported from
+	// zerolog.
+	logScope = "github.com/jamestelfer/chinmina-bridge"
+
+	// auditEventName is set as the "event.name" attribute of audit records,
+	// distinguishing them from application logs.
+	auditEventName = "chinmina.audit"
+)
+
+// bridge holds the logger that zerolog records are exported to. It is nil until
+// log export is configured.
+var bridge atomic.Pointer[otelLogger]
+
+type otelLogger struct {
+	otellog.Logger
+}
+
+// LogWriter returns a writer for zerolog that writes each record to w, and
+// exports it as an OpenTelemetry log record once log export has been
+// configured by Configure.
+func LogWriter(w io.Writer) zerolog.LevelWriter {
+	return zerolog.MultiLevelWriter(w, logBridge{})
+}
+
+// TraceHook adds the IDs of the active span to log events created with a
+// context, so they can be correlated with traces. Audit events are skipped, as
+// they already record the trace.
+type TraceHook struct{}
+
+func (TraceHook) Run(e *zerolog.Event, level zerolog.Level, _ string) {
+	if level == audit.Level {
+		return
+	}
+
+	sc := trace.SpanContextFromContext(e.GetCtx())
+	if !sc.IsValid() {
+		return
+	}
+
+	e.Str("traceID", sc.TraceID().String()).Str("spanID", sc.SpanID().String())
+}
+
+// setLogExport enables (or with a nil provider, disables) the export of log
+// records.
+func setLogExport(provider otellog.LoggerProvider) {
+	if provider == nil {
+		bridge.Store(nil)
+		return
+	}
+
+	bridge.Store(&otelLogger{provider.Logger(logScope)})
+}
+
+// logBridge converts zerolog JSON records into OpenTelemetry log records.
+type logBridge struct{}
+
+func (b logBridge) Write(p []byte) (int, error) {
+	return b.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (logBridge) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	logger := bridge.Load()
+	if logger == nil {
+		return len(p), nil
+	}
+
+	fields := map[string]any{}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		// not a JSON record: export it unchanged
+		fields = map[string]any{zerolog.MessageFieldName: string(bytes.TrimSpace(p))}
+	}
+
+	// the SDK reports its own failures through the logger: exporting these
+	// could create a feedback loop when the collector is unavailable
+	if fields["source"] == "otel" {
+		return len(p), nil
+	}
+
+	ctx, record := logRecord(level, fields)
+	logger.Emit(ctx, record)
+
+	// export failures are handled by the SDK, and must not affect local logging
+	return len(p), nil
+}
+
+// logRecord creates the log record for the zerolog fields, returning a context
+// carrying the trace of the record if it has one.
+func logRecord(level zerolog.Level, fields map[string]any) (context.Context, otellog.Record) {
+	var record otellog.Record
+
+	record.SetObservedTimestamp(time.Now())
+	record.SetSeverity(logSeverity(level))
+
+	if text, ok := fields[zerolog.LevelFieldName].(string); ok {
+		record.SetSeverityText(text)
+		delete(fields, zerolog.LevelFieldName)
+	}
+
+	if msg, ok := fields[zerolog.MessageFieldName].(string); ok {
+		record.SetBody(otellog.StringValue(msg))
+		delete(fields, zerolog.MessageFieldName)
+	}
+
+	if ts, ok := fields[zerolog.TimestampFieldName].(string); ok {
+		if t, err := time.Parse(zerolog.TimeFieldFormat, ts); err == nil {
+			record.SetTimestamp(t)
+			delete(fields, zerolog.TimestampFieldName)
+		}
+	}
+
+	ctx := context.Background()
+	if sc := recordSpanContext(fields); sc.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, sc)
+		delete(fields, "traceID")
+		delete(fields, "spanID")
+	}
+
+	if level == audit.Level {
+		record.AddAttributes(otellog.String("event.name", auditEventName))
+	}
+
+	for k, v := range fields {
+		record.AddAttributes(otellog.KeyValue{Key: k, Value: logValue(v)})
+	}
+
+	return ctx, record
+}
+
+func recordSpanContext(fields map[string]any) trace.SpanContext {
+	traceID, _ := fields["traceID"].(string)
+	spanID, _ := fields["spanID"].(string)
+
+	tid, err := trace.TraceIDFromHex(traceID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	sid, err := trace.SpanIDFromHex(spanID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    tid,
+		SpanID:     sid,
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+}
+
+func logSeverity(level zerolog.Level) otellog.Severity {
+	switch {
+	case level == audit.Level:
+		return otellog.SeverityInfo4
+	case level == zerolog.NoLevel:
+		return otellog.SeverityUndefined
+	case level < zerolog.DebugLevel:
+		// trace, and the levels used by the OTel SDK logger
+		return otellog.SeverityTrace
+	case level == zerolog.DebugLevel:
+		return otellog.SeverityDebug
+	case level == zerolog.InfoLevel:
+		return otellog.SeverityInfo
+	case level == zerolog.WarnLevel:
+		return otellog.SeverityWarn
+	case level == zerolog.ErrorLevel:
+		return otellog.SeverityError
+	default:
+		return otellog.SeverityFatal
+	}
+}
+
+// logValue converts a decoded JSON value to a log attribute value.
+func logValue(v any) otellog.Value {
+	switch v := v.(type) {
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return otellog.Int64Value(i)
+		}
+		f, _ := v.Float64()
+		return otellog.Float64Value(f)
+	case []any:
+		values := make([]otellog.Value, 0, len(v))
+		for _, e := range v {
+			values = append(values, logValue(e))
+		}
+		return otellog.SliceValue(values...)
+	case map[string]any:
+		kvs := make([]otellog.KeyValue, 0, len(v))
+		for k, e := range v {
+			kvs = append(kvs, otellog.KeyValue{Key: k, Value: logValue(e)})
+		}
+		return otellog.MapValue(kvs...)
+	default:
+		return otellog.Value{}
+	}
+}
@@ -0,0 +1,158 @@
+package observe
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestLogWriter_ExportsRecords(t *testing.T) {
+	exporter := setupLogExport(t)
+
+	var out testWriter
+	logger := zerolog.New(LogWriter(&out)).With().Timestamp().Logger()
+
+	logger.Warn().Str("pipeline", "pipe").Int("count", 3).Msg("something happened")
+
+	require.Len(t, exporter.records(), 1)
+	assert.Contains(t, out.String(), `"message":"something happened"`, "records are still written locally")
+
+	r := exporter.records()[0]
+	assert.Equal(t, "something happened", r.Body().AsString())
+	assert.Equal(t, otellog.SeverityWarn, r.Severity())
+	assert.Equal(t, "warn", r.SeverityText())
+	assert.False(t, r.Timestamp().IsZero())
+
+	attrs := recordAttributes(r)
+	assert.Equal(t, "pipe", attrs["pipeline"].AsString())
+	assert.Equal(t, int64(3), attrs["count"].AsInt64())
+	assert.NotContains(t, attrs, "event.name")
+}
+
+func TestLogWriter_CorrelatesTrace(t *testing.T) {
+	exporter := setupLogExport(t)
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	logger := zerolog.New(LogWriter(&testWriter{})).Hook(TraceHook{})
+	logger.Info().Ctx(ctx).Msg("in a span")
+
+	require.Len(t, exporter.records(), 1)
+	r := exporter.records()[0]
+	assert.Equal(t, trace.TraceID{1}, r.TraceID())
+	assert.Equal(t, trace.SpanID{2}, r.SpanID())
+	assert.NotContains(t, recordAttributes(r), "traceID")
+}
+
+func TestLogWriter_MarksAuditRecords(t *testing.T) {
+	exporter := setupLogExport(t)
+
+	logger := zerolog.New(LogWriter(&testWriter{})).Hook(TraceHook{})
+	logger.WithLevel(audit.Level).
+		Str("traceID", "0102030405060708090a0b0c0d0e0f10").
+		Str("spanID", "0102030405060708").
+		Str("type", "audit").
+		Msg("audit_event")
+
+	require.Len(t, exporter.records(), 1)
+	r := exporter.records()[0]
+	assert.Equal(t, otellog.SeverityInfo4, r.Severity())
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", r.TraceID().String())
+	assert.Equal(t, auditEventName, recordAttributes(r)["event.name"].AsString())
+}
+
+func TestLogWriter_SkipsOTelRecords(t *testing.T) {
+	exporter := setupLogExport(t)
+
+	logger := zerolog.New(LogWriter(&testWriter{}))
+	logger.Error().Str("source", "otel").Msg("export failed")
+
+	assert.Empty(t, exporter.records())
+}
+
+func TestLogWriter_DisabledExport(t *testing.T) {
+	setLogExport(nil)
+
+	var out testWriter
+	logger := zerolog.New(LogWriter(&out))
+	logger.Info().Msg("local only")
+
+	assert.Contains(t, out.String(), "local only")
+}
+
+func setupLogExport(t *testing.T) *fakeLogExporter {
+	t.Helper()
+
+	exporter := &fakeLogExporter{}
+	provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+
+	setLogExport(provider)
+	t.Cleanup(func() {
+		setLogExport(nil)
+		_ = provider.Shutdown(context.Background())
+	})
+
+	return exporter
+}
+
+func recordAttributes(r sdklog.Record) map[string]otellog.Value {
+	attrs := map[string]otellog.Value{}
+	r.WalkAttributes(func(kv otellog.KeyValue) bool {
+		attrs[kv.Key] = kv.Value
+		return true
+	})
+	return attrs
+}
+
+type fakeLogExporter struct {
+	mu       sync.Mutex
+	exported []sdklog.Record
+}
+
+func (e *fakeLogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, r := range records {
+		e.exported = append(e.exported, r.Clone())
+	}
+	return nil
+}
+
+func (e *fakeLogExporter) Shutdown(context.Context) error   { return nil }
+func (e *fakeLogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *fakeLogExporter) records() []sdklog.Record {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]sdklog.Record(nil), e.exported...)
+}
+
+type testWriter struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
+
+func (w *testWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return string(w.buf)
+}
@@ -3,6 +3,7 @@ package observe
 import (
 	"net/http"
 
+	"github.com/rs/zerolog"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
@@ -25,7 +26,7 @@ func (mux *Mux) Handle(pattern string, handler http.Handler) {
 	// Configure the standard OTel handler along with route tagging for this
 	// path
 	taggedHandler := otelhttp.NewHandler(
-		otelhttp.WithRouteTag(pattern, handler),
+		otelhttp.WithRouteTag(pattern, withContextLogger(handler)),
 		pattern,
 	)
 
@@ -35,3 +36,14 @@ func (mux *Mux) Handle(pattern string, handler http.Handler) {
 func (mux *Mux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mux.wrapped.ServeHTTP(w, r)
 }
+
+// withContextLogger makes the request context available to events logged with
+// zerolog.Ctx, so that they can be correlated with the request trace.
+func withContextLogger(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := zerolog.Ctx(ctx).With().Ctx(ctx).Logger()
+
+		handler.ServeHTTP(w, r.WithContext(logger.WithContext(ctx)))
+	})
+}
@@ -3,23 +3,35 @@ package observe
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptrace"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/go-logr/zerologr"
 	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
@@ -39,6 +51,22 @@ func Configure(ctx context.Context, cfg config.ObserveConfig) (shutdown func(con
 
 	configureLogging(cfg)
 
+	// validate before starting anything that would need to be shut down
+	exporters, err := configuredExporters(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sampler, err := newSampler(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	var shutdownFuncs []func(context.Context) error
 
 	// Allow clean up functions to be executed for the various subsystems that
@@ -61,29 +89,69 @@ func Configure(ctx context.Context, cfg config.ObserveConfig) (shutdown func(con
 	prop := newPropagator()
 	otel.SetTextMapPropagator(prop)
 
-	exporters := configuredExporters(cfg)
-
-	tracerProvider, err := newTraceProvider(ctx, cfg, exporters)
-	if err != nil {
-		handleErr(err)
-		return
+	if cfg.TracesEnabled {
+		tracerProvider, err := newTraceProvider(ctx, cfg, exporters, sampler, r)
+		if err != nil {
+			handleErr(err)
+			return shutdown, err
+		}
+		shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
+		otel.SetTracerProvider(tracerProvider)
 	}
-	shutdownFuncs = append(shutdownFuncs, tracerProvider.Shutdown)
-	otel.SetTracerProvider(tracerProvider)
 
 	if cfg.MetricsEnabled {
-		meterProvider, err := newMeterProvider(ctx, cfg, exporters)
+		meterProvider, promHandler, err := newMeterProvider(ctx, cfg, exporters, r)
 		if err != nil {
 			handleErr(err)
 			return shutdown, err
 		}
-		shutdownFuncs = append(shutdownFuncs, meterProvider.Shutdown)
+		shutdownFuncs = append(shutdownFuncs, func(ctx context.Context) error {
+			metricsHandler.Store(nil)
+			return meterProvider.Shutdown(ctx)
+		})
 		otel.SetMeterProvider(meterProvider)
+
+		if promHandler != nil {
+			metricsHandler.Store(&promHandler)
+		}
+	}
+
+	if cfg.LogsEnabled {
+		loggerProvider, err := newLoggerProvider(ctx, exporters, r)
+		if err != nil {
+			handleErr(err)
+			return shutdown, err
+		}
+		// stop exporting before shutdown, so records aren't sent to a provider
+		// that has stopped
+		shutdownFuncs = append(shutdownFuncs, func(ctx context.Context) error {
+			setLogExport(nil)
+			return loggerProvider.Shutdown(ctx)
+		})
+		setLogExport(loggerProvider)
 	}
 
 	return
 }
 
+// metricsHandler serves the Prometheus scrape endpoint when it is enabled.
+var metricsHandler atomic.Pointer[http.Handler]
+
+// MetricsHandler serves metrics in the Prometheus exposition format, once
+// Configure has enabled the Prometheus exporter. Until then (or if it is not
+// enabled), it responds with 404 Not Found.
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler := metricsHandler.Load()
+		if handler == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		(*handler).ServeHTTP(w, r)
+	})
+}
+
 func HttpTransport(wrapped http.RoundTripper, cfg config.ObserveConfig) http.RoundTripper {
 	if !cfg.Enabled || !cfg.HttpTransportEnabled {
 		return wrapped
@@ -109,18 +177,72 @@ func clientHttpTrace(ctx context.Context) *httptrace.ClientTrace {
 	)
 }
 
-func configuredExporters(cfg config.ObserveConfig) exporters {
+// Validate checks the telemetry configuration without starting any providers.
+// Nothing is checked when telemetry is disabled.
+func Validate(cfg config.ObserveConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	_, exportersErr := configuredExporters(cfg)
+	_, samplerErr := newSampler(cfg)
+
+	return errors.Join(exportersErr, samplerErr)
+}
+
+func configuredExporters(cfg config.ObserveConfig) (exporters, error) {
 	switch cfg.Type {
 	case "stdout":
-		return stdoutExporters{}
-
+		return stdoutExporters{}, nil
 	case "grpc":
-		fallthrough
+		return grpcExporters{}, nil
+	case "http/protobuf":
+		return httpExporters{}, nil
 	default:
-		return grpcExporters{}
+		return nil, fmt.Errorf("unknown OBSERVE_TYPE %q, expected grpc, http/protobuf or stdout", cfg.Type)
 	}
 }
 
+// newSampler samples the configured ratio of new traces, and follows the
+// sampling decision of the parent span for traces started elsewhere.
+func newSampler(cfg config.ObserveConfig) (trace.Sampler, error) {
+	if cfg.TraceSampleRatio < 0 || cfg.TraceSampleRatio > 1 {
+		return nil, fmt.Errorf("OBSERVE_TRACE_SAMPLE_RATIO must be between 0 and 1, got %v", cfg.TraceSampleRatio)
+	}
+
+	return trace.ParentBased(trace.TraceIDRatioBased(cfg.TraceSampleRatio)), nil
+}
+
+// newResource describes the service, and (when enabled) the host and container
+// it is running in.
+func newResource(ctx context.Context, cfg config.ObserveConfig) (*resource.Resource, error) {
+	base := resource.Default()
+
+	if cfg.ResourceDetectionEnabled {
+		detected, err := resource.New(ctx,
+			resource.WithHost(),
+			resource.WithOS(),
+			resource.WithContainer(),
+			resource.WithProcessRuntimeName(),
+			resource.WithProcessRuntimeVersion(),
+		)
+		if err != nil {
+			// detection is best effort: whatever could be detected is still used
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("telemetry: resource detection incomplete")
+		}
+
+		if detected != nil {
+			merged, err := resource.Merge(base, detected)
+			if err != nil {
+				return nil, err
+			}
+			base = merged
+		}
+	}
+
+	return resourceWithServiceName(base, cfg.ServiceName)
+}
+
 func newPropagator() propagation.TextMapPropagator {
 	return propagation.NewCompositeTextMapPropagator(
 		propagation.TraceContext{},
@@ -128,22 +250,18 @@ func newPropagator() propagation.TextMapPropagator {
 	)
 }
 
-func newTraceProvider(ctx context.Context, cfg config.ObserveConfig, e exporters) (*trace.TracerProvider, error) {
+func newTraceProvider(ctx context.Context, cfg config.ObserveConfig, e exporters, sampler trace.Sampler, r *resource.Resource) (*trace.TracerProvider, error) {
 	traceExporter, err := e.Trace(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	r, err := resourceWithServiceName(resource.Default(), cfg.ServiceName)
-	if err != nil {
-		return nil, err
-	}
-
 	traceProvider := trace.NewTracerProvider(
 		trace.WithBatcher(traceExporter,
 			trace.WithBatchTimeout(time.Duration(cfg.TraceBatchTimeoutSeconds)*time.Second),
 		),
 		trace.WithResource(r),
+		trace.WithSampler(sampler),
 	)
 	return traceProvider, nil
 }
@@ -158,18 +276,51 @@ func resourceWithServiceName(base *resource.Resource, serviceName string) (*reso
 	)
 }
 
-func newMeterProvider(ctx context.Context, cfg config.ObserveConfig, e exporters) (*metric.MeterProvider, error) {
-	metricExporter, err := e.Metric(ctx)
+// newMeterProvider creates a meter provider that pushes metrics to the
+// configured exporter and/or exposes them for Prometheus to scrape. The handler
+// for the scrape endpoint is nil when Prometheus is not enabled.
+func newMeterProvider(ctx context.Context, cfg config.ObserveConfig, e exporters, r *resource.Resource) (*metric.MeterProvider, http.Handler, error) {
+	opts := []metric.Option{metric.WithResource(r)}
+
+	if cfg.MetricsPushEnabled {
+		metricExporter, err := e.Metric(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		opts = append(opts, metric.WithReader(metric.NewPeriodicReader(metricExporter,
+			metric.WithInterval(time.Duration(cfg.MetricReadIntervalSeconds)*time.Second))))
+	}
+
+	var handler http.Handler
+	if cfg.PrometheusEnabled {
+		// a dedicated registry ensures only the bridge's metrics are exposed
+		registry := prometheus.NewRegistry()
+
+		promExporter, err := otelprom.New(otelprom.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		opts = append(opts, metric.WithReader(promExporter))
+		handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	}
+
+	return metric.NewMeterProvider(opts...), handler, nil
+}
+
+func newLoggerProvider(ctx context.Context, e exporters, r *resource.Resource) (*sdklog.LoggerProvider, error) {
+	logExporter, err := e.Log(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	meterProvider := metric.NewMeterProvider(
-		metric.WithReader(metric.NewPeriodicReader(metricExporter,
-			metric.WithInterval(time.Duration(cfg.MetricReadIntervalSeconds)*time.Second))),
+	loggerProvider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+		sdklog.WithResource(r),
 	)
 
-	return meterProvider, nil
+	return loggerProvider, nil
 }
 
 func configureLogging(cfg config.ObserveConfig) {
@@ -195,6 +346,20 @@ func configureLogging(cfg config.ObserveConfig) {
 			Msg("invalid configuration for OBSERVE_OTEL_LOG_LEVEL, internal OTel logging disabled.")
 	}
 
+	// a level configured for the otel log component takes precedence
+	if componentLevel, ok := logging.ComponentLevel("otel"); ok {
+		switch {
+		case componentLevel <= zerolog.DebugLevel:
+			level = otelDbgLvl
+		case componentLevel == zerolog.InfoLevel:
+			level = otelInfLvl
+		case componentLevel == zerolog.WarnLevel:
+			level = zerolog.DebugLevel
+		default:
+			level = componentLevel
+		}
+	}
+
 	// don't bother to configure when disabled
 	if level == zerolog.Disabled {
 		return
@@ -209,12 +374,15 @@ func configureLogging(cfg config.ObserveConfig) {
 	zerolog.FormattedLevels[otelDbgLvl] = "ODBG"
 	zerolog.LevelColors[otelDbgLvl] = 90 // grey
 
-	// The zerolog logger that otel will write to, using its own level, and
-	// marking all events with the "otel" source.
+	// The zerolog logger that otel will write to, using its own level rather
+	// than the sampled application levels, and marking all events with the
+	// "otel" source.
 	otelLogger := log.Logger.
 		Level(level).
+		Sample(nil).
 		With().
 		Str("source", "otel").
+		Str("component", "otel").
 		Logger()
 
 	// bridge the logger to the logr library used by otel
@@ -225,6 +393,7 @@ func configureLogging(cfg config.ObserveConfig) {
 type exporters interface {
 	Trace(ctx context.Context) (trace.SpanExporter, error)
 	Metric(ctx context.Context) (metric.Exporter, error)
+	Log(ctx context.Context) (sdklog.Exporter, error)
 }
 
 type grpcExporters struct{}
@@ -235,6 +404,23 @@ func (e grpcExporters) Trace(ctx context.Context) (trace.SpanExporter, error) {
 func (e grpcExporters) Metric(ctx context.Context) (metric.Exporter, error) {
 	return otlpmetricgrpc.New(ctx)
 }
+func (e grpcExporters) Log(ctx context.Context) (sdklog.Exporter, error) {
+	return otlploggrpc.New(ctx)
+}
+
+// httpExporters use OTLP over HTTP with protobuf encoding, for environments
+// that only allow HTTPS egress.
+type httpExporters struct{}
+
+func (e httpExporters) Trace(ctx context.Context) (trace.SpanExporter, error) {
+	return otlptracehttp.New(ctx)
+}
+func (e httpExporters) Metric(ctx context.Context) (metric.Exporter, error) {
+	return otlpmetrichttp.New(ctx)
+}
+func (e httpExporters) Log(ctx context.Context) (sdklog.Exporter, error) {
+	return otlploghttp.New(ctx)
+}
 
 type stdoutExporters struct{}
 
@@ -244,3 +430,6 @@ func (e stdoutExporters) Trace(ctx context.Context) (trace.SpanExporter, error)
 func (e stdoutExporters) Metric(ctx context.Context) (metric.Exporter, error) {
 	return stdoutmetric.New()
 }
+func (e stdoutExporters) Log(ctx context.Context) (sdklog.Exporter, error) {
+	return stdoutlog.New()
+}
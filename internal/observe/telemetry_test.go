@@ -1,10 +1,18 @@
 package observe
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 func Test_ResourceMerge(t *testing.T) {
@@ -16,3 +24,128 @@ func Test_ResourceMerge(t *testing.T) {
 
 	require.NoError(t, err)
 }
+
+func TestConfiguredExporters(t *testing.T) {
+	cases := map[string]exporters{
+		"grpc":          grpcExporters{},
+		"http/protobuf": httpExporters{},
+		"stdout":        stdoutExporters{},
+	}
+
+	for typ, expected := range cases {
+		t.Run(typ, func(t *testing.T) {
+			actual, err := configuredExporters(config.ObserveConfig{Type: typ})
+			require.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestConfigure_RejectsUnknownType(t *testing.T) {
+	_, err := Configure(context.Background(), config.ObserveConfig{Enabled: true, Type: "carrier-pigeon", TraceSampleRatio: 1})
+	assert.ErrorContains(t, err, `unknown OBSERVE_TYPE "carrier-pigeon"`)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(config.ObserveConfig{Type: "carrier-pigeon"}), "not checked when disabled")
+	assert.NoError(t, Validate(config.ObserveConfig{Enabled: true, Type: "grpc", TraceSampleRatio: 0.5}))
+
+	err := Validate(config.ObserveConfig{Enabled: true, Type: "carrier-pigeon", TraceSampleRatio: 2})
+	assert.ErrorContains(t, err, `unknown OBSERVE_TYPE "carrier-pigeon"`)
+	assert.ErrorContains(t, err, "OBSERVE_TRACE_SAMPLE_RATIO must be between 0 and 1")
+}
+
+func TestNewSampler(t *testing.T) {
+	sampler, err := newSampler(config.ObserveConfig{TraceSampleRatio: 0})
+	require.NoError(t, err)
+
+	// new traces are sampled at the configured ratio
+	result := sampler.ShouldSample(trace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       oteltrace.TraceID{1},
+	})
+	assert.Equal(t, trace.Drop, result.Decision)
+
+	// sampled parents are followed
+	parent := oteltrace.ContextWithSpanContext(context.Background(), oteltrace.NewSpanContext(oteltrace.SpanContextConfig{
+		TraceID:    oteltrace.TraceID{1},
+		SpanID:     oteltrace.SpanID{1},
+		TraceFlags: oteltrace.FlagsSampled,
+		Remote:     true,
+	}))
+	result = sampler.ShouldSample(trace.SamplingParameters{
+		ParentContext: parent,
+		TraceID:       oteltrace.TraceID{1},
+	})
+	assert.Equal(t, trace.RecordAndSample, result.Decision)
+}
+
+func TestNewSampler_RejectsInvalidRatio(t *testing.T) {
+	_, err := newSampler(config.ObserveConfig{TraceSampleRatio: 1.5})
+	assert.ErrorContains(t, err, "OBSERVE_TRACE_SAMPLE_RATIO must be between 0 and 1")
+}
+
+func TestNewResource(t *testing.T) {
+	r, err := newResource(context.Background(), config.ObserveConfig{
+		ServiceName:              "bridge",
+		ResourceDetectionEnabled: true,
+	})
+	require.NoError(t, err)
+
+	service, ok := r.Set().Value(semconv.ServiceNameKey)
+	require.True(t, ok)
+	assert.Equal(t, "bridge", service.AsString())
+
+	_, ok = r.Set().Value(semconv.HostNameKey)
+	assert.True(t, ok, "host attributes should be detected")
+}
+
+func TestNewResource_DetectionDisabled(t *testing.T) {
+	r, err := newResource(context.Background(), config.ObserveConfig{ServiceName: "bridge"})
+	require.NoError(t, err)
+
+	_, ok := r.Set().Value(semconv.HostNameKey)
+	assert.False(t, ok)
+}
+
+func TestMetricsHandler_Prometheus(t *testing.T) {
+	provider, handler, err := newMeterProvider(context.Background(), config.ObserveConfig{
+		PrometheusEnabled: true,
+	}, stdoutExporters{}, resource.Empty())
+	require.NoError(t, err)
+	require.NotNil(t, handler)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	metricsHandler.Store(&handler)
+	t.Cleanup(func() { metricsHandler.Store(nil) })
+
+	counter, err := provider.Meter("test").Int64Counter("test.requests")
+	require.NoError(t, err)
+	counter.Add(context.Background(), 3)
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "test_requests_total")
+}
+
+func TestMetricsHandler_NotEnabled(t *testing.T) {
+	metricsHandler.Store(nil)
+
+	recorder := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestNewMeterProvider_PushOnly(t *testing.T) {
+	provider, handler, err := newMeterProvider(context.Background(), config.ObserveConfig{
+		MetricsPushEnabled:        true,
+		MetricReadIntervalSeconds: 60,
+	}, stdoutExporters{}, resource.Empty())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	assert.Nil(t, handler)
+}
@@ -0,0 +1,227 @@
+//go:build pkcs11 && cgo
+
+package pkcs11
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/rs/zerolog/log"
+)
+
+// Supported reports whether this build includes PKCS #11 support.
+const Supported = true
+
+// sha256DigestInfo is the DER encoded DigestInfo prefix for a SHA-256 digest.
+// CKM_RSA_PKCS signs its input as given, so the caller supplies the DigestInfo
+// that PKCS #1 v1.5 requires.
+var sha256DigestInfo = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+
+// Module signs with a private key in a token, using a single logged in
+// session. Signing operations are serialized, as a PKCS #11 session can only
+// perform one operation at a time.
+type Module struct {
+	cfg  Config
+	ctx  *p11.Ctx
+	slot uint
+
+	mu      sync.Mutex
+	session p11.SessionHandle
+	open    bool
+	key     p11.ObjectHandle
+}
+
+// Open loads the module, finds the token and logs in, confirming that the key
+// exists.
+func Open(cfg Config) (*Module, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	ctx := p11.New(cfg.ModulePath)
+	if ctx == nil {
+		return nil, fmt.Errorf("pkcs11: could not load module %s", cfg.ModulePath)
+	}
+
+	if err := ctx.Initialize(); err != nil && !errors.Is(err, p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED)) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("pkcs11: could not initialize module: %w", err)
+	}
+
+	slot, err := findSlot(ctx, cfg)
+	if err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	m := &Module{cfg: cfg, ctx: ctx, slot: slot}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.openSession(); err != nil {
+		m.close()
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// findSlot returns the slot of the token selected by slot ID or token label.
+func findSlot(ctx *p11.Ctx, cfg Config) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: could not list slots: %w", err)
+	}
+
+	for _, slot := range slots {
+		if cfg.SlotID != nil && *cfg.SlotID != slot {
+			continue
+		}
+
+		if cfg.TokenLabel != "" {
+			info, err := ctx.GetTokenInfo(slot)
+			if err != nil || info.Label != cfg.TokenLabel {
+				continue
+			}
+		}
+
+		return slot, nil
+	}
+
+	return 0, fmt.Errorf("pkcs11: no token found matching slot-id %s, token %q", formatSlot(cfg.SlotID), cfg.TokenLabel)
+}
+
+func formatSlot(slot *uint) string {
+	if slot == nil {
+		return "(any)"
+	}
+
+	return fmt.Sprint(*slot)
+}
+
+// openSession opens a session, logs in and finds the key. The caller must
+// hold the lock.
+func (m *Module) openSession() error {
+	pin, err := m.cfg.pin()
+	if err != nil {
+		return fmt.Errorf("pkcs11: %w", err)
+	}
+
+	session, err := m.ctx.OpenSession(m.slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("pkcs11: could not open session: %w", err)
+	}
+
+	// login state is shared by the sessions of an application
+	if err := m.ctx.Login(session, p11.CKU_USER, pin); err != nil && !errors.Is(err, p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN)) {
+		_ = m.ctx.CloseSession(session)
+		return fmt.Errorf("pkcs11: login failed: %w", err)
+	}
+
+	key, err := m.findKey(session)
+	if err != nil {
+		_ = m.ctx.CloseSession(session)
+		return err
+	}
+
+	m.session = session
+	m.key = key
+	m.open = true
+
+	return nil
+}
+
+func (m *Module) findKey(session p11.SessionHandle) (p11.ObjectHandle, error) {
+	template := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY),
+		p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_RSA),
+		p11.NewAttribute(p11.CKA_LABEL, m.cfg.KeyLabel),
+	}
+
+	if err := m.ctx.FindObjectsInit(session, template); err != nil {
+		return 0, fmt.Errorf("pkcs11: could not search for key: %w", err)
+	}
+	defer func() { _ = m.ctx.FindObjectsFinal(session) }()
+
+	objects, _, err := m.ctx.FindObjects(session, 2)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: could not search for key: %w", err)
+	}
+
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("pkcs11: no RSA private key with label %q", m.cfg.KeyLabel)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("pkcs11: more than one RSA private key with label %q", m.cfg.KeyLabel)
+	}
+}
+
+// SignDigest signs a SHA-256 digest with the key using RSA PKCS #1 v1.5,
+// returning the raw signature. If signing fails, the session is reopened and
+// signing is attempted once more, so that the module recovers when the token
+// is reset or reconnected.
+func (m *Module) SignDigest(_ context.Context, digest []byte) ([]byte, error) {
+	input := append(append([]byte{}, sha256DigestInfo...), digest...)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		if !m.open {
+			if err := m.openSession(); err != nil {
+				return nil, err
+			}
+		}
+
+		signature, err := m.sign(input)
+		if err == nil {
+			return signature, nil
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt+1).Msg("pkcs11: signing failed, reopening session")
+		m.closeSession()
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf("pkcs11: signing failed: %w", lastErr)
+}
+
+func (m *Module) sign(input []byte) ([]byte, error) {
+	mechanism := []*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_PKCS, nil)}
+
+	if err := m.ctx.SignInit(m.session, mechanism, m.key); err != nil {
+		return nil, err
+	}
+
+	return m.ctx.Sign(m.session, input)
+}
+
+// Close closes the session and unloads the module.
+func (m *Module) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.close()
+
+	return nil
+}
+
+func (m *Module) closeSession() {
+	if m.open {
+		_ = m.ctx.CloseSession(m.session)
+		m.open = false
+	}
+}
+
+func (m *Module) close() {
+	m.closeSession()
+	_ = m.ctx.Finalize()
+	m.ctx.Destroy()
+}
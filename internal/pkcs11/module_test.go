@@ -0,0 +1,173 @@
+//go:build pkcs11 && cgo
+
+package pkcs11
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests use SoftHSM. The module is found at SOFTHSM2_MODULE, or in the
+// usual install locations; the tests are skipped if it is not installed.
+
+const (
+	tokenLabel = "chinmina"
+	keyLabel   = "github-app"
+	userPIN    = "123456"
+)
+
+func softHSMModule(t *testing.T) string {
+	t.Helper()
+
+	candidates := []string{
+		os.Getenv("SOFTHSM2_MODULE"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+		"/opt/homebrew/lib/softhsm/libsofthsm2.so",
+	}
+
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	t.Skip("SoftHSM is not installed: set SOFTHSM2_MODULE to the path of libsofthsm2.so")
+	return ""
+}
+
+// setupToken initializes a SoftHSM token in a temporary directory, and
+// generates an RSA key pair in it. The public key is returned.
+func setupToken(t *testing.T, module string) *rsa.PublicKey {
+	t.Helper()
+
+	dir := t.TempDir()
+	tokens := filepath.Join(dir, "tokens")
+	require.NoError(t, os.Mkdir(tokens, 0o700))
+
+	conf := filepath.Join(dir, "softhsm2.conf")
+	require.NoError(t, os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\nlog.level = ERROR\n"), 0o600))
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := p11.New(module)
+	require.NotNil(t, ctx)
+	defer ctx.Destroy()
+
+	require.NoError(t, ctx.Initialize())
+	defer func() { _ = ctx.Finalize() }()
+
+	slots, err := ctx.GetSlotList(false)
+	require.NoError(t, err)
+	require.NoError(t, ctx.InitToken(slots[0], "so-pin", tokenLabel))
+
+	slot, err := findSlot(ctx, Config{TokenLabel: tokenLabel})
+	require.NoError(t, err)
+
+	session, err := ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	require.NoError(t, err)
+	defer func() { _ = ctx.CloseSession(session) }()
+
+	require.NoError(t, ctx.Login(session, p11.CKU_SO, "so-pin"))
+	require.NoError(t, ctx.InitPIN(session, userPIN))
+	require.NoError(t, ctx.Logout(session))
+	require.NoError(t, ctx.Login(session, p11.CKU_USER, userPIN))
+
+	public, _, err := ctx.GenerateKeyPair(session,
+		[]*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)},
+		[]*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_VERIFY, true),
+			p11.NewAttribute(p11.CKA_MODULUS_BITS, 2048),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+			p11.NewAttribute(p11.CKA_LABEL, keyLabel),
+		},
+		[]*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_PRIVATE, true),
+			p11.NewAttribute(p11.CKA_SIGN, true),
+			p11.NewAttribute(p11.CKA_SENSITIVE, true),
+			p11.NewAttribute(p11.CKA_EXTRACTABLE, false),
+			p11.NewAttribute(p11.CKA_LABEL, keyLabel),
+		},
+	)
+	require.NoError(t, err)
+
+	attrs, err := ctx.GetAttributeValue(session, public, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_MODULUS, nil),
+		p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	require.NoError(t, err)
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attrs[0].Value),
+		E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+	}
+}
+
+func TestModule_SignDigest(t *testing.T) {
+	module := softHSMModule(t)
+	public := setupToken(t, module)
+
+	pinFile := filepath.Join(t.TempDir(), "pin")
+	require.NoError(t, os.WriteFile(pinFile, []byte(userPIN+"\n"), 0o600))
+
+	m, err := Open(Config{ModulePath: module, TokenLabel: tokenLabel, KeyLabel: keyLabel, PINSource: pinFile})
+	require.NoError(t, err)
+	defer m.Close()
+
+	digest := sha256.Sum256([]byte("header.claims"))
+
+	signature, err := m.SignDigest(context.Background(), digest[:])
+	require.NoError(t, err)
+
+	assert.NoError(t, rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature))
+}
+
+func TestModule_SignDigestRecoversSession(t *testing.T) {
+	module := softHSMModule(t)
+	public := setupToken(t, module)
+
+	m, err := Open(Config{ModulePath: module, TokenLabel: tokenLabel, KeyLabel: keyLabel, PIN: userPIN})
+	require.NoError(t, err)
+	defer m.Close()
+
+	// simulate the session being lost, as when a token is reset
+	require.NoError(t, m.ctx.CloseSession(m.session))
+
+	digest := sha256.Sum256([]byte("header.claims"))
+
+	signature, err := m.SignDigest(context.Background(), digest[:])
+	require.NoError(t, err)
+
+	assert.NoError(t, rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature))
+}
+
+func TestOpen_Failures(t *testing.T) {
+	module := softHSMModule(t)
+	setupToken(t, module)
+
+	_, err := Open(Config{ModulePath: module, TokenLabel: "missing", KeyLabel: keyLabel, PIN: userPIN})
+	assert.ErrorContains(t, err, `no token found matching slot-id (any), token "missing"`)
+
+	_, err = Open(Config{ModulePath: module, TokenLabel: tokenLabel, KeyLabel: "missing", PIN: userPIN})
+	assert.ErrorContains(t, err, `no RSA private key with label "missing"`)
+
+	_, err = Open(Config{ModulePath: module, TokenLabel: tokenLabel, KeyLabel: keyLabel, PIN: "000000"})
+	assert.ErrorContains(t, err, "login failed")
+
+	_, err = Open(Config{ModulePath: filepath.Join(t.TempDir(), "missing.so"), TokenLabel: tokenLabel, KeyLabel: keyLabel})
+	assert.ErrorContains(t, err, "could not load module")
+}
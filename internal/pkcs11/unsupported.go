@@ -0,0 +1,33 @@
+//go:build !pkcs11 || !cgo
+
+package pkcs11
+
+import (
+	"context"
+	"errors"
+)
+
+// Supported reports whether this build includes PKCS #11 support.
+const Supported = false
+
+var errUnsupported = errors.New("pkcs11: PKCS #11 support is not included in this build: build with CGO_ENABLED=1 and -tags pkcs11")
+
+// Module is not available in this build.
+type Module struct{}
+
+// Open always fails in this build.
+func Open(cfg Config) (*Module, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	return nil, errUnsupported
+}
+
+func (m *Module) SignDigest(context.Context, []byte) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (m *Module) Close() error {
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package pkcs11 signs with RSA keys held in a hardware security module,
+// accessed through a PKCS #11 module.
+//
+// Using an HSM requires cgo, so support is only included when built with the
+// "pkcs11" build tag and CGO_ENABLED=1. Keys are identified by PKCS #11 URIs
+// (RFC 7512), which can be parsed and validated in any build.
+package pkcs11
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Scheme is the scheme of a PKCS #11 URI.
+const Scheme = "pkcs11:"
+
+// Config identifies a private key in a PKCS #11 token, and how to log in to
+// the token.
+type Config struct {
+	// ModulePath is the path of the PKCS #11 module (shared library).
+	ModulePath string
+	// SlotID selects the token by its slot, if set.
+	SlotID *uint
+	// TokenLabel selects the token by its label, if set.
+	TokenLabel string
+	// KeyLabel is the label (CKA_LABEL) of the private key.
+	KeyLabel string
+	// PIN is the user PIN of the token.
+	PIN string
+	// PINSource is the path of a file containing the user PIN, used if PIN is
+	// not set.
+	PINSource string
+}
+
+// ParseURI parses a PKCS #11 URI such as:
+//
+//	pkcs11:token=chinmina;object=github-app?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/run/secrets/pin
+//
+// The token is selected with the "token" or "slot-id" path attributes, and
+// the key with "object". The module is given by the "module-path" query
+// attribute, and the PIN by "pin-source" (a file) or "pin-value".
+func ParseURI(uri string) (Config, error) {
+	rest, ok := strings.CutPrefix(uri, Scheme)
+	if !ok {
+		return Config{}, fmt.Errorf("invalid PKCS #11 URI %q: expected %s scheme", uri, Scheme)
+	}
+
+	path, query, _ := strings.Cut(rest, "?")
+
+	var cfg Config
+
+	for _, attr := range splitAttributes(path, ";") {
+		name, value, err := attribute(attr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PKCS #11 URI %q: %w", uri, err)
+		}
+
+		switch name {
+		case "token":
+			cfg.TokenLabel = value
+		case "object":
+			cfg.KeyLabel = value
+		case "slot-id":
+			id, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid PKCS #11 URI %q: slot-id %q is not a number", uri, value)
+			}
+			slot := uint(id)
+			cfg.SlotID = &slot
+		case "type":
+			if value != "private" {
+				return Config{}, fmt.Errorf("invalid PKCS #11 URI %q: the object must be a private key", uri)
+			}
+		}
+	}
+
+	for _, attr := range splitAttributes(query, "&") {
+		name, value, err := attribute(attr)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid PKCS #11 URI %q: %w", uri, err)
+		}
+
+		switch name {
+		case "module-path":
+			cfg.ModulePath = value
+		case "pin-source":
+			// RFC 7512 allows the source to be given as a file URI
+			value = strings.TrimPrefix(strings.TrimPrefix(value, "file://"), "file:")
+			cfg.PINSource = value
+		case "pin-value":
+			cfg.PIN = value
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid PKCS #11 URI %q: %w", uri, err)
+	}
+
+	return cfg, nil
+}
+
+func splitAttributes(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, sep)
+}
+
+func attribute(attr string) (string, string, error) {
+	name, value, ok := strings.Cut(attr, "=")
+	if !ok {
+		return "", "", fmt.Errorf("attribute %q has no value", attr)
+	}
+
+	value, err := url.PathUnescape(value)
+	if err != nil {
+		return "", "", fmt.Errorf("attribute %q: %w", name, err)
+	}
+
+	return name, value, nil
+}
+
+func (c Config) validate() error {
+	if c.ModulePath == "" {
+		return errors.New("module-path is required")
+	}
+
+	if c.SlotID == nil && c.TokenLabel == "" {
+		return errors.New("a token or slot-id is required")
+	}
+
+	if c.KeyLabel == "" {
+		return errors.New("an object (the key label) is required")
+	}
+
+	return nil
+}
+
+// pin returns the configured PIN, reading it from the PIN source if required.
+func (c Config) pin() (string, error) {
+	if c.PIN != "" || c.PINSource == "" {
+		return c.PIN, nil
+	}
+
+	content, err := os.ReadFile(c.PINSource)
+	if err != nil {
+		return "", fmt.Errorf("could not read PIN: %w", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
@@ -0,0 +1,75 @@
+package pkcs11
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURI(t *testing.T) {
+	slot := uint(3)
+
+	cases := map[string]Config{
+		"pkcs11:token=chinmina;object=github-app?module-path=/usr/lib/softhsm/libsofthsm2.so": {
+			ModulePath: "/usr/lib/softhsm/libsofthsm2.so",
+			TokenLabel: "chinmina",
+			KeyLabel:   "github-app",
+		},
+		"pkcs11:slot-id=3;object=github%20app;type=private?module-path=/lib/hsm.so&pin-source=file:/run/secrets/pin": {
+			ModulePath: "/lib/hsm.so",
+			SlotID:     &slot,
+			KeyLabel:   "github app",
+			PINSource:  "/run/secrets/pin",
+		},
+		"pkcs11:token=chinmina;object=github-app?module-path=/lib/hsm.so&pin-value=1234": {
+			ModulePath: "/lib/hsm.so",
+			TokenLabel: "chinmina",
+			KeyLabel:   "github-app",
+			PIN:        "1234",
+		},
+	}
+
+	for uri, expected := range cases {
+		t.Run(uri, func(t *testing.T) {
+			cfg, err := ParseURI(uri)
+			require.NoError(t, err)
+			assert.Equal(t, expected, cfg)
+		})
+	}
+}
+
+func TestParseURI_Invalid(t *testing.T) {
+	cases := map[string]string{
+		"pkcs11:token=chinmina;object=github-app":                     "module-path is required",
+		"pkcs11:object=github-app?module-path=/lib/hsm.so":            "a token or slot-id is required",
+		"pkcs11:token=chinmina?module-path=/lib/hsm.so":               "an object (the key label) is required",
+		"pkcs11:slot-id=one;object=k?module-path=/lib/hsm.so":         `slot-id "one" is not a number`,
+		"pkcs11:token=t;object=k;type=public?module-path=/lib/hsm.so": "the object must be a private key",
+		"pkcs11:token;object=k?module-path=/lib/hsm.so":               `attribute "token" has no value`,
+		"gcpkms://projects/p/locations/l/keyRings/r/cryptoKeys/k":     "expected pkcs11: scheme",
+	}
+
+	for uri, expected := range cases {
+		t.Run(uri, func(t *testing.T) {
+			_, err := ParseURI(uri)
+			assert.ErrorContains(t, err, expected)
+		})
+	}
+}
+
+func TestConfig_PINFromSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pin")
+	require.NoError(t, os.WriteFile(path, []byte("1234\n"), 0o600))
+
+	pin, err := Config{PINSource: path}.pin()
+	require.NoError(t, err)
+	assert.Equal(t, "1234", pin)
+
+	// a PIN value takes precedence
+	pin, err = Config{PIN: "5678", PINSource: path}.pin()
+	require.NoError(t, err)
+	assert.Equal(t, "5678", pin)
+}
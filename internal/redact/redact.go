@@ -0,0 +1,142 @@
+// Package redact masks credentials that would otherwise be written to logs.
+package redact
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"slices"
+	"sync"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// pattern matches one kind of secret. The hint is a literal that every match
+// contains, allowing the expression to be skipped for most log lines.
+type pattern struct {
+	kind string
+	hint []byte
+	re   *regexp.Regexp
+}
+
+// patterns are applied in order. None of the expressions match a double quote
+// or split an escape sequence, so masking a JSON encoded record keeps it valid.
+var patterns = []pattern{
+	{
+		// installation (ghs_), personal (ghp_), OAuth (gho_), user-to-server
+		// (ghu_) and refresh (ghr_) tokens
+		kind: "github-token",
+		hint: []byte("gh"),
+		re:   regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}`),
+	},
+	{
+		kind: "github-token",
+		hint: []byte("github_pat_"),
+		re:   regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}`),
+	},
+	{
+		kind: "buildkite-token",
+		hint: []byte("bkua_"),
+		re:   regexp.MustCompile(`\bbkua_[A-Za-z0-9]{20,}`),
+	},
+	{
+		// the encoded header and payload of a JWT are JSON objects, so they
+		// always start with "eyJ"
+		kind: "jwt",
+		hint: []byte("eyJ"),
+		re:   regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`),
+	},
+	{
+		kind: "pem",
+		hint: []byte("-----BEGIN "),
+		re:   regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----(?:[^"\\]|\\[^"])*?-----END [A-Z0-9 ]+-----`),
+	},
+	{
+		// a block that has been truncated is masked to the end of the string
+		kind: "pem",
+		hint: []byte("-----BEGIN "),
+		re:   regexp.MustCompile(`-----BEGIN [A-Z0-9 ]+-----(?:[^"\\]|\\[^"])*`),
+	},
+}
+
+var redactions = sync.OnceValue(func() metric.Int64Counter {
+	// The global meter delegates to the configured provider once it is set, so
+	// the counter can be created before telemetry is configured.
+	counter, err := otel.Meter("github.com/jamestelfer/chinmina-bridge/internal/redact").Int64Counter(
+		"log.redactions",
+		metric.WithDescription("The number of secrets masked in log output"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return counter
+})
+
+// Bytes returns the content with any secrets masked. If nothing is masked, the
+// content is returned unchanged.
+func Bytes(p []byte) []byte {
+	for _, pat := range patterns {
+		if !bytes.Contains(p, pat.hint) {
+			continue
+		}
+
+		count := 0
+		p = pat.re.ReplaceAllFunc(p, func([]byte) []byte {
+			count++
+			return []byte(mask(pat.kind))
+		})
+
+		if count > 0 {
+			record(pat.kind, count)
+		}
+	}
+
+	return p
+}
+
+// String returns the value with any secrets masked.
+func String(s string) string {
+	return string(Bytes([]byte(s)))
+}
+
+func mask(kind string) string {
+	return "[REDACTED:" + kind + "]"
+}
+
+func record(kind string, count int) {
+	if counter := redactions(); counter != nil {
+		counter.Add(context.Background(), int64(count), metric.WithAttributes(attribute.String("kind", kind)))
+	}
+}
+
+// Writer masks secrets in each record before it is written to w. Records at
+// the exempt levels are written unchanged: their fields must be masked before
+// they are logged. Audit records are exempt, as their content is hashed.
+func Writer(w zerolog.LevelWriter, exempt ...zerolog.Level) zerolog.LevelWriter {
+	return writer{w, exempt}
+}
+
+type writer struct {
+	w      zerolog.LevelWriter
+	exempt []zerolog.Level
+}
+
+func (r writer) Write(p []byte) (int, error) {
+	return r.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (r writer) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if slices.Contains(r.exempt, level) {
+		return r.w.WriteLevel(level, p)
+	}
+
+	if _, err := r.w.WriteLevel(level, Bytes(p)); err != nil {
+		return 0, err
+	}
+
+	// the caller's record is considered written even if its length changed
+	return len(p), nil
+}
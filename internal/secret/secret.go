@@ -0,0 +1,369 @@
+// Package secret resolves references to secrets held in files and secret
+// managers, so that secrets need not be set directly in the environment.
+package secret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/vault"
+	"github.com/rs/zerolog/log"
+)
+
+// The schemes of secret references. A value without one of these prefixes is
+// the secret itself.
+const (
+	fileScheme           = "file://"
+	secretsManagerScheme = "awssm://"
+	ssmScheme            = "ssm://"
+	vaultScheme          = "vault://"
+)
+
+var schemes = []string{fileScheme, secretsManagerScheme, ssmScheme, vaultScheme}
+
+// IsReference reports whether the value refers to a secret, rather than being
+// the secret itself.
+func IsReference(value string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateReference checks the form of a reference without resolving it.
+func ValidateReference(value string) error {
+	_, err := parseReference(value)
+	return err
+}
+
+// reference is a parsed secret reference.
+type reference struct {
+	scheme string
+	// location is the file path, secret ID, parameter name or Vault path
+	location string
+	// key selects a field of a JSON (Secrets Manager) or Vault secret
+	key string
+}
+
+func parseReference(value string) (reference, error) {
+	for _, scheme := range schemes {
+		rest, ok := strings.CutPrefix(value, scheme)
+		if !ok {
+			continue
+		}
+
+		location, key, _ := strings.Cut(rest, "#")
+		ref := reference{scheme: scheme, location: location, key: key}
+
+		if location == "" {
+			return ref, fmt.Errorf("secret reference %q has no location", value)
+		}
+
+		switch scheme {
+		case fileScheme:
+			if !filepath.IsAbs(location) {
+				return ref, fmt.Errorf("secret reference %q must be an absolute path, for example file:///run/secrets/token", value)
+			}
+			if key != "" {
+				return ref, fmt.Errorf("secret reference %q: file references do not support a key", value)
+			}
+		case ssmScheme:
+			if key != "" {
+				return ref, fmt.Errorf("secret reference %q: parameter references do not support a key", value)
+			}
+		}
+
+		return ref, nil
+	}
+
+	return reference{}, fmt.Errorf("%q is not a secret reference: expected one of %v", value, schemes)
+}
+
+// SecretsManagerClient defines the AWS Secrets Manager API used by the
+// Resolver.
+type SecretsManagerClient interface {
+	GetSecretValue(ctx context.Context, in *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// SSMClient defines the AWS Systems Manager API used by the Resolver.
+type SSMClient interface {
+	GetParameter(ctx context.Context, in *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+// VaultClient defines the Vault API used by the Resolver.
+type VaultClient interface {
+	Read(ctx context.Context, path string) (map[string]any, error)
+}
+
+// Resolver resolves secret references. Clients for the secret stores are only
+// created when a reference to the store is resolved, so a store that is not
+// used needs no configuration.
+type Resolver struct {
+	vaultConfig config.VaultConfig
+
+	mu             sync.Mutex
+	secretsManager SecretsManagerClient
+	ssm            SSMClient
+	vault          VaultClient
+}
+
+// NewResolver creates a resolver, using the Vault configuration for vault://
+// references.
+func NewResolver(cfg config.VaultConfig) *Resolver {
+	return &Resolver{vaultConfig: cfg}
+}
+
+// NewResolverWithClients creates a resolver that uses the given clients. A
+// nil client is created on first use.
+func NewResolverWithClients(secretsManager SecretsManagerClient, ssm SSMClient, vault VaultClient) *Resolver {
+	return &Resolver{secretsManager: secretsManager, ssm: ssm, vault: vault}
+}
+
+// Resolve returns the secret that the value refers to. A value that is not a
+// reference is returned unchanged.
+//
+// File content has surrounding whitespace removed, as files are usually
+// written with a trailing newline.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	if !IsReference(value) {
+		return value, nil
+	}
+
+	ref, err := parseReference(value)
+	if err != nil {
+		return "", err
+	}
+
+	var secret string
+
+	switch ref.scheme {
+	case fileScheme:
+		secret, err = r.resolveFile(ref)
+	case secretsManagerScheme:
+		secret, err = r.resolveSecretsManager(ctx, ref)
+	case ssmScheme:
+		secret, err = r.resolveSSM(ctx, ref)
+	case vaultScheme:
+		secret, err = r.resolveVault(ctx, ref)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s: %w", value, err)
+	}
+
+	if secret == "" {
+		return "", fmt.Errorf("could not resolve %s: the secret is empty", value)
+	}
+
+	return secret, nil
+}
+
+func (r *Resolver) resolveFile(ref reference) (string, error) {
+	content, err := os.ReadFile(ref.location)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+func (r *Resolver) resolveSecretsManager(ctx context.Context, ref reference) (string, error) {
+	client, err := r.secretsManagerClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(ref.location),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	value := aws.ToString(out.SecretString)
+	if ref.key == "" {
+		return value, nil
+	}
+
+	// a key selects a field of a secret stored as a JSON object
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object, so key %q cannot be selected", ref.key)
+	}
+
+	return field(fields, ref.key)
+}
+
+func (r *Resolver) resolveSSM(ctx context.Context, ref reference) (string, error) {
+	client, err := r.ssmClient(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(ref.location),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if out.Parameter == nil {
+		return "", errors.New("parameter has no value")
+	}
+
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+func (r *Resolver) resolveVault(ctx context.Context, ref reference) (string, error) {
+	client, err := r.vaultClient()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := client.Read(ctx, ref.location)
+	if err != nil {
+		return "", err
+	}
+
+	// KV version 2 nests the secret's fields in a further data object
+	if nested, ok := data["data"].(map[string]any); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	if ref.key == "" {
+		if len(data) != 1 {
+			return "", fmt.Errorf("secret has %d fields: select one with #<key>", len(data))
+		}
+		for key := range data {
+			ref.key = key
+		}
+	}
+
+	return field(data, ref.key)
+}
+
+func field(fields map[string]any, key string) (string, error) {
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret has no key %q", key)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("secret key %q is not a string", key)
+	}
+
+	return s, nil
+}
+
+func (r *Resolver) secretsManagerClient(ctx context.Context) (SecretsManagerClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.secretsManager == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.secretsManager = secretsmanager.NewFromConfig(cfg)
+	}
+
+	return r.secretsManager, nil
+}
+
+func (r *Resolver) ssmClient(ctx context.Context) (SSMClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ssm == nil {
+		cfg, err := awsconfig.LoadDefaultConfig(ctx)
+		if err != nil {
+			return nil, err
+		}
+		r.ssm = ssm.NewFromConfig(cfg)
+	}
+
+	return r.ssm, nil
+}
+
+func (r *Resolver) vaultClient() (VaultClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.vault == nil {
+		client, err := vault.New(r.vaultConfig)
+		if err != nil {
+			return nil, err
+		}
+		r.vault = client
+	}
+
+	return r.vault, nil
+}
+
+// Watch resolves the reference at each interval until the context is
+// cancelled. When the secret has changed from the current value, apply is
+// called with the new value. If the secret cannot be resolved or apply fails,
+// the failure is logged and the current value remains in use. Nothing is done
+// if the value is not a reference or the interval is not positive.
+//
+// The name identifies the setting in logs; the secret is never logged.
+func (r *Resolver) Watch(ctx context.Context, name, value, current string, interval time.Duration, apply func(string) error) {
+	if !IsReference(value) || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current = r.refresh(ctx, name, value, current, apply)
+			}
+		}
+	}()
+}
+
+// refresh resolves the reference, applying the secret if it has changed. The
+// secret in use after the refresh is returned.
+func (r *Resolver) refresh(ctx context.Context, name, value, current string, apply func(string) error) string {
+	secret, err := r.Resolve(ctx, value)
+	if err != nil {
+		log.Error().Err(err).Str("setting", name).Msg("secret: refresh failed, retaining current value")
+		return current
+	}
+
+	if secret == current {
+		return current
+	}
+
+	if err := apply(secret); err != nil {
+		log.Error().Err(err).Str("setting", name).Str("reference", value).Msg("secret: refreshed value rejected, retaining current value")
+		return current
+	}
+
+	log.Info().Str("setting", name).Str("reference", value).Msg("secret: refreshed value applied")
+
+	return secret
+}
@@ -0,0 +1,53 @@
+package secret
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefresh_AppliesChangedSecret(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	path := filepath.Join(t.TempDir(), "token")
+	ref := "file://" + path
+	r := NewResolverWithClients(nil, nil, nil)
+
+	var applied []string
+	apply := func(s string) error {
+		if s == "rejected" {
+			return errors.New("not acceptable")
+		}
+		applied = append(applied, s)
+		return nil
+	}
+
+	// unchanged
+	require.NoError(t, os.WriteFile(path, []byte("first"), 0o600))
+	current := r.refresh(context.Background(), "TOKEN", ref, "first", apply)
+	assert.Equal(t, "first", current)
+	assert.Empty(t, applied)
+
+	// changed
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0o600))
+	current = r.refresh(context.Background(), "TOKEN", ref, current, apply)
+	assert.Equal(t, "second", current)
+	assert.Equal(t, []string{"second"}, applied)
+
+	// rejected by the consumer
+	require.NoError(t, os.WriteFile(path, []byte("rejected"), 0o600))
+	current = r.refresh(context.Background(), "TOKEN", ref, current, apply)
+	assert.Equal(t, "second", current)
+
+	// cannot be resolved
+	require.NoError(t, os.Remove(path))
+	current = r.refresh(context.Background(), "TOKEN", ref, current, apply)
+	assert.Equal(t, "second", current)
+	assert.Equal(t, []string{"second"}, applied)
+}
@@ -0,0 +1,58 @@
+package tlsconfig
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+)
+
+var errClientNamesWithoutCA = errors.New("SERVER_TLS_CLIENT_ALLOWED_NAMES requires SERVER_TLS_CLIENT_CA_FILE")
+
+// ClientCommonName returns the common name of the subject of the verified
+// client certificate for the request, if there is one.
+func ClientCommonName(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// RequireClientNames returns middleware that only allows requests made with a
+// verified client certificate whose subject common name is in the configured
+// list. Other requests, including those on listeners without TLS, are
+// forbidden. When no names are configured, all requests are allowed.
+func RequireClientNames(cfg config.ServerConfig) (func(http.Handler) http.Handler, error) {
+	allowed := cfg.TLSClientAllowedNames
+
+	if len(allowed) > 0 && cfg.TLSClientCAFile == "" {
+		return nil, errClientNamesWithoutCA
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, ok := ClientCommonName(r)
+			if !ok || !slices.Contains(allowed, name) {
+				entry := audit.Log(r.Context())
+				if ok {
+					entry.Error = fmt.Sprintf("client certificate not permitted: common name %q is not allowed", name)
+				} else {
+					entry.Error = "client certificate not permitted: no verified client certificate"
+				}
+
+				http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
@@ -0,0 +1,236 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
+)
+
+const defaultReloadInterval = 30 * time.Second
+
+// Enabled returns true if the server is configured to serve TLS.
+func Enabled(cfg config.ServerConfig) bool {
+	return cfg.TLSCertFile != "" || cfg.TLSKeyFile != ""
+}
+
+// New creates a TLS configuration for the server from the configured
+// certificate, key and (optional) client CA bundle. The files are checked for
+// changes periodically until the context is cancelled, and new connections use
+// the updated material once it has been loaded successfully. A change that
+// fails to load is logged and the previous material is retained.
+//
+// When a client CA bundle is configured, clients must present a certificate
+// signed by one of the CAs in the bundle.
+func New(ctx context.Context, cfg config.ServerConfig) (*tls.Config, error) {
+	r, err := newReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// the initial load must succeed: this is a configuration error
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	interval := defaultReloadInterval
+	if cfg.TLSReloadIntervalSeconds > 0 {
+		interval = time.Duration(cfg.TLSReloadIntervalSeconds) * time.Second
+	}
+
+	go r.watch(ctx, interval)
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The per-connection configuration ensures that reloaded certificates
+		// and CAs are used for new connections.
+		GetConfigForClient: r.configForClient,
+		GetCertificate:     r.certificate,
+	}, nil
+}
+
+// Validate checks that the configured TLS files can be loaded, if TLS is
+// enabled. The files are not watched. Allowed client names require client
+// certificates to be verified.
+func Validate(cfg config.ServerConfig) error {
+	if len(cfg.TLSClientAllowedNames) > 0 && cfg.TLSClientCAFile == "" {
+		return errClientNamesWithoutCA
+	}
+
+	if !Enabled(cfg) {
+		return nil
+	}
+
+	r, err := newReloader(cfg)
+	if err != nil {
+		return err
+	}
+
+	certPEM, keyPEM, caPEM, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	_, err = build(certPEM, keyPEM, caPEM)
+	return err
+}
+
+func newReloader(cfg config.ServerConfig) (*reloader, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, errors.New("both a certificate and key file must be configured for TLS")
+	}
+
+	return &reloader{
+		certFile:     cfg.TLSCertFile,
+		keyFile:      cfg.TLSKeyFile,
+		clientCAFile: cfg.TLSClientCAFile,
+	}, nil
+}
+
+// reloader holds the current TLS material, replacing it when the source files
+// change.
+type reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	// digest is only accessed by the reload process, which is not concurrent.
+	digest []byte
+
+	mu      sync.RWMutex
+	current *tls.Config
+}
+
+func (r *reloader) configForClient(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.current, nil
+}
+
+func (r *reloader) certificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &r.current.Certificates[0], nil
+}
+
+func (r *reloader) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				logging.Component("http").Error().Err(err).Msg("tls: reload failed, retaining previous certificates")
+			}
+		}
+	}
+}
+
+// reload reads the configured files, and replaces the current configuration if
+// they have changed and are valid.
+func (r *reloader) reload() error {
+	certPEM, keyPEM, caPEM, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	h.Write(certPEM)
+	h.Write(keyPEM)
+	h.Write(caPEM)
+	digest := h.Sum(nil)
+
+	if bytes.Equal(r.digest, digest) {
+		return nil
+	}
+
+	cfg, err := build(certPEM, keyPEM, caPEM)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.current = cfg
+	r.mu.Unlock()
+
+	r.digest = digest
+
+	logging.Component("http").Info().
+		Str("certFile", r.certFile).
+		Bool("clientAuth", caPEM != nil).
+		Time("notAfter", cfg.Certificates[0].Leaf.NotAfter).
+		Msg("tls: certificates loaded")
+
+	return nil
+}
+
+// read returns the content of the configured files. The client CA bundle is nil
+// if it is not configured.
+func (r *reloader) read() (certPEM, keyPEM, caPEM []byte, err error) {
+	certPEM, err = os.ReadFile(r.certFile)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not read TLS certificate: %w", err)
+	}
+
+	keyPEM, err = os.ReadFile(r.keyFile)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not read TLS key: %w", err)
+	}
+
+	if r.clientCAFile != "" {
+		caPEM, err = os.ReadFile(r.clientCAFile)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("could not read TLS client CA bundle: %w", err)
+		}
+	}
+
+	return certPEM, keyPEM, caPEM, nil
+}
+
+func build(certPEM, keyPEM, caPEM []byte) (*tls.Config, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS key pair: %w", err)
+	}
+
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("could not parse TLS certificate: %w", err)
+		}
+	}
+
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		// the per-connection configuration replaces the server's, so HTTP/2
+		// support must be declared here
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if caPEM != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("TLS client CA bundle contains no certificates")
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
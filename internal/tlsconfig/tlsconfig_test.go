@@ -0,0 +1,352 @@
+package tlsconfig_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/jamestelfer/chinmina-bridge/internal/tlsconfig"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnabled(t *testing.T) {
+	assert.False(t, tlsconfig.Enabled(config.ServerConfig{}))
+	assert.True(t, tlsconfig.Enabled(config.ServerConfig{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem"}))
+}
+
+func TestNew_FailsWithoutKeyPair(t *testing.T) {
+	_, err := tlsconfig.New(context.Background(), config.ServerConfig{TLSCertFile: "cert.pem"})
+	assert.ErrorContains(t, err, "both a certificate and key file must be configured")
+
+	dir := t.TempDir()
+	_, err = tlsconfig.New(context.Background(), config.ServerConfig{
+		TLSCertFile: filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:  filepath.Join(dir, "key.pem"),
+	})
+	assert.ErrorContains(t, err, "could not read TLS certificate")
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, tlsconfig.Validate(config.ServerConfig{}), "nothing to check when TLS is disabled")
+
+	err := tlsconfig.Validate(config.ServerConfig{TLSKeyFile: "key.pem"})
+	assert.ErrorContains(t, err, "both a certificate and key file must be configured")
+
+	dir := t.TempDir()
+	cfg := config.ServerConfig{
+		TLSCertFile: filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	newCA(t).writeLeaf(t, "server-1", cfg.TLSCertFile, cfg.TLSKeyFile)
+	assert.NoError(t, tlsconfig.Validate(cfg))
+
+	cfg.TLSCertFile = cfg.TLSKeyFile
+	err = tlsconfig.Validate(cfg)
+	assert.ErrorContains(t, err, "could not load TLS key pair")
+}
+
+func TestNew_ServesTLS(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := config.ServerConfig{
+		TLSCertFile: filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	ca.writeLeaf(t, "server-1", cfg.TLSCertFile, cfg.TLSKeyFile)
+
+	tlsCfg, err := tlsconfig.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	svr := startServer(t, tlsCfg)
+
+	client := ca.client(nil)
+	resp, err := client.Get(svr.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "server-1", resp.TLS.PeerCertificates[0].Subject.CommonName)
+}
+
+func TestNew_ReloadsCertificate(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := config.ServerConfig{
+		TLSCertFile:              filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:               filepath.Join(dir, "key.pem"),
+		TLSReloadIntervalSeconds: 1,
+	}
+	ca.writeLeaf(t, "server-1", cfg.TLSCertFile, cfg.TLSKeyFile)
+
+	tlsCfg, err := tlsconfig.New(ctx, cfg)
+	require.NoError(t, err)
+
+	svr := startServer(t, tlsCfg)
+
+	ca.writeLeaf(t, "server-2", cfg.TLSCertFile, cfg.TLSKeyFile)
+
+	require.Eventually(t, func() bool {
+		// new connections are required to see the new certificate
+		client := ca.client(nil)
+		client.Transport.(*http.Transport).DisableKeepAlives = true
+
+		resp, err := client.Get(svr.URL)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		return resp.TLS.PeerCertificates[0].Subject.CommonName == "server-2"
+	}, 5*time.Second, 100*time.Millisecond)
+}
+
+func TestNew_RequiresClientCertificate(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := config.ServerConfig{
+		TLSCertFile:     filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:      filepath.Join(dir, "key.pem"),
+		TLSClientCAFile: filepath.Join(dir, "ca.pem"),
+	}
+	ca.writeLeaf(t, "server-1", cfg.TLSCertFile, cfg.TLSKeyFile)
+	require.NoError(t, os.WriteFile(cfg.TLSClientCAFile, ca.certPEM, 0o600))
+
+	tlsCfg, err := tlsconfig.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	svr := startServer(t, tlsCfg)
+
+	// no client certificate
+	_, err = ca.client(nil).Get(svr.URL)
+	assert.Error(t, err)
+
+	// client certificate from an unknown CA
+	other := newCA(t)
+	untrusted := other.leaf(t, "agent-untrusted")
+	_, err = ca.client(&untrusted).Get(svr.URL)
+	assert.Error(t, err)
+
+	// trusted client certificate
+	trusted := ca.leaf(t, "agent-1")
+	resp, err := ca.client(&trusted).Get(svr.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRequireClientNames(t *testing.T) {
+	testhelpers.SetupLogger(t)
+
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := config.ServerConfig{
+		TLSCertFile:           filepath.Join(dir, "cert.pem"),
+		TLSKeyFile:            filepath.Join(dir, "key.pem"),
+		TLSClientCAFile:       filepath.Join(dir, "ca.pem"),
+		TLSClientAllowedNames: []string{"agent-1"},
+	}
+	ca.writeLeaf(t, "server-1", cfg.TLSCertFile, cfg.TLSKeyFile)
+	require.NoError(t, os.WriteFile(cfg.TLSClientCAFile, ca.certPEM, 0o600))
+
+	tlsCfg, err := tlsconfig.New(context.Background(), cfg)
+	require.NoError(t, err)
+
+	requireNames, err := tlsconfig.RequireClientNames(cfg)
+	require.NoError(t, err)
+
+	entries := make(chan *audit.Entry, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, entry := audit.Context(r.Context())
+		entries <- entry
+
+		requireNames(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})).ServeHTTP(w, r.WithContext(ctx))
+	})
+
+	svr := startServerWithHandler(t, tlsCfg, handler)
+
+	// allowed client
+	allowed := ca.leaf(t, "agent-1")
+	resp, err := ca.client(&allowed).Get(svr.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Empty(t, (<-entries).Error)
+
+	// verified client that is not in the list
+	denied := ca.leaf(t, "agent-2")
+	resp, err = ca.client(&denied).Get(svr.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, `client certificate not permitted: common name "agent-2" is not allowed`, (<-entries).Error)
+}
+
+func TestRequireClientNames_RequiresVerifiedCertificate(t *testing.T) {
+	_, err := tlsconfig.RequireClientNames(config.ServerConfig{TLSClientAllowedNames: []string{"agent-1"}})
+	assert.ErrorContains(t, err, "SERVER_TLS_CLIENT_ALLOWED_NAMES requires SERVER_TLS_CLIENT_CA_FILE")
+
+	requireNames, err := tlsconfig.RequireClientNames(config.ServerConfig{
+		TLSClientCAFile:       "ca.pem",
+		TLSClientAllowedNames: []string{"agent-1"},
+	})
+	require.NoError(t, err)
+
+	// a request without TLS, such as on a Unix socket, has no certificate
+	rr := httptest.NewRecorder()
+	requireNames(http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/token", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// without allowed names, every request is passed on
+	requireNames, err = tlsconfig.RequireClientNames(config.ServerConfig{})
+	require.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	requireNames(http.NotFoundHandler()).ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/token", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func startServer(t *testing.T, tlsCfg *tls.Config) *httptest.Server {
+	t.Helper()
+
+	return startServerWithHandler(t, tlsCfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func startServerWithHandler(t *testing.T, tlsCfg *tls.Config, handler http.Handler) *httptest.Server {
+	t.Helper()
+
+	svr := httptest.NewUnstartedServer(handler)
+	svr.TLS = tlsCfg
+	svr.StartTLS()
+	t.Cleanup(svr.Close)
+
+	return svr
+}
+
+type testCA struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+}
+
+func newCA(t *testing.T) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (ca testCA) leafPEM(t *testing.T, commonName string) ([]byte, []byte) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func (ca testCA) leaf(t *testing.T, commonName string) tls.Certificate {
+	t.Helper()
+
+	certPEM, keyPEM := ca.leafPEM(t, commonName)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func (ca testCA) writeLeaf(t *testing.T, commonName, certFile, keyFile string) {
+	t.Helper()
+
+	certPEM, keyPEM := ca.leafPEM(t, commonName)
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	require.NoError(t, os.WriteFile(certFile, certPEM, 0o600))
+}
+
+func (ca testCA) client(cert *tls.Certificate) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	tlsCfg := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		tlsCfg.Certificates = []tls.Certificate{*cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsCfg},
+	}
+}
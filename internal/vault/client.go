@@ -0,0 +1,472 @@
+// Package vault is a minimal client for the HashiCorp Vault HTTP API.
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog/log"
+)
+
+// The supported authentication methods.
+const (
+	AuthToken      = "token"
+	AuthAppRole    = "approle"
+	AuthKubernetes = "kubernetes"
+)
+
+// requestTimeout bounds each request to Vault, including logins.
+const requestTimeout = 10 * time.Second
+
+// Client makes authenticated requests to the Vault HTTP API.
+type Client struct {
+	address      *url.URL
+	namespace    string
+	transitMount string
+
+	// login obtains a new token, or describes the configured token
+	login func(ctx context.Context) (lease, error)
+
+	mu    sync.Mutex
+	lease *lease
+
+	now func() time.Time
+
+	// requests use the default transport, which is configured with telemetry
+	// at startup
+	client *http.Client
+}
+
+// lease is a Vault token and its lifetime.
+type lease struct {
+	token     string
+	renewable bool
+	// ttl is zero for a token that does not expire
+	ttl      time.Duration
+	obtained time.Time
+}
+
+func (l lease) expiry() time.Time {
+	return l.obtained.Add(l.ttl)
+}
+
+// renewAt returns the time at which the token is renewed, two thirds of the
+// way through its lifetime.
+func (l lease) renewAt() time.Time {
+	return l.obtained.Add(l.ttl * 2 / 3)
+}
+
+func (l lease) expired(now time.Time) bool {
+	return l.ttl > 0 && !now.Before(l.expiry())
+}
+
+// ValidateConfig checks that the configuration is complete for the configured
+// authentication method. No request is made to Vault.
+func ValidateConfig(cfg config.VaultConfig) error {
+	if cfg.Address == "" {
+		return errors.New("VAULT_ADDR must be configured to use Vault")
+	}
+
+	address, err := url.Parse(cfg.Address)
+	if err != nil {
+		return fmt.Errorf("could not parse VAULT_ADDR: %w", err)
+	}
+	if !address.IsAbs() || (address.Scheme != "http" && address.Scheme != "https") {
+		return fmt.Errorf("VAULT_ADDR %q must be an absolute http(s) URL", cfg.Address)
+	}
+
+	switch authMethod(cfg) {
+	case AuthToken:
+		if cfg.Token == "" {
+			return errors.New("VAULT_TOKEN must be configured to use Vault")
+		}
+	case AuthAppRole:
+		if cfg.AppRoleRoleID == "" || cfg.AppRoleSecretID == "" {
+			return errors.New("VAULT_APPROLE_ROLE_ID and VAULT_APPROLE_SECRET_ID must be configured for AppRole authentication")
+		}
+	case AuthKubernetes:
+		if cfg.KubernetesRole == "" || cfg.KubernetesTokenFile == "" {
+			return errors.New("VAULT_KUBERNETES_ROLE and VAULT_KUBERNETES_TOKEN_FILE must be configured for Kubernetes authentication")
+		}
+	default:
+		return fmt.Errorf("unknown VAULT_AUTH_METHOD %q: expected %s, %s or %s", cfg.AuthMethod, AuthToken, AuthAppRole, AuthKubernetes)
+	}
+
+	return nil
+}
+
+func authMethod(cfg config.VaultConfig) string {
+	if cfg.AuthMethod == "" {
+		return AuthToken
+	}
+
+	return cfg.AuthMethod
+}
+
+// New creates a client for the configured Vault server. No request is made
+// until the client is used: the client then logs in with the configured
+// authentication method, and renews its token as required.
+func New(cfg config.VaultConfig) (*Client, error) {
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	address, _ := url.Parse(cfg.Address)
+
+	c := &Client{
+		address:      address,
+		namespace:    cfg.Namespace,
+		transitMount: cfg.TransitMount,
+		now:          time.Now,
+		client:       &http.Client{Timeout: requestTimeout},
+	}
+	if c.transitMount == "" {
+		c.transitMount = "transit"
+	}
+
+	method := authMethod(cfg)
+	mount := cfg.AuthMount
+	if mount == "" {
+		mount = method
+	}
+
+	switch method {
+	case AuthToken:
+		c.login = func(ctx context.Context) (lease, error) {
+			return c.lookupToken(ctx, cfg.Token)
+		}
+	case AuthAppRole:
+		c.login = func(ctx context.Context) (lease, error) {
+			return c.authenticate(ctx, mount, map[string]string{
+				"role_id":   cfg.AppRoleRoleID,
+				"secret_id": cfg.AppRoleSecretID,
+			})
+		}
+	case AuthKubernetes:
+		c.login = func(ctx context.Context) (lease, error) {
+			// the service account token is read for each login, as projected
+			// tokens are rotated by the kubelet
+			jwt, err := readTokenFile(cfg.KubernetesTokenFile)
+			if err != nil {
+				return lease{}, err
+			}
+
+			return c.authenticate(ctx, mount, map[string]string{
+				"role": cfg.KubernetesRole,
+				"jwt":  jwt,
+			})
+		}
+	}
+
+	return c, nil
+}
+
+// Read returns the data of the secret at the path, for example
+// "secret/data/chinmina".
+func (c *Client) Read(ctx context.Context, path string) (map[string]any, error) {
+	var response struct {
+		Data map[string]any `json:"data"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, path, nil, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Data == nil {
+		return nil, fmt.Errorf("vault: no data at %s", path)
+	}
+
+	return response.Data, nil
+}
+
+// TransitSign signs a SHA-256 digest with the named Transit key, using RSA
+// PKCS #1 v1.5. The digest is sent rather than the message, so the message is
+// never disclosed to Vault. The raw signature is returned.
+func (c *Client) TransitSign(ctx context.Context, key string, digest []byte) ([]byte, error) {
+	request := map[string]any{
+		"input":               base64.StdEncoding.EncodeToString(digest),
+		"prehashed":           true,
+		"signature_algorithm": "pkcs1v15",
+	}
+
+	var response struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+
+	path := c.transitMount + "/sign/" + url.PathEscape(key) + "/sha2-256"
+	if err := c.do(ctx, http.MethodPost, path, request, &response); err != nil {
+		return nil, err
+	}
+
+	// signatures have the form "vault:v<key version>:<base64 signature>"
+	parts := strings.Split(response.Data.Signature, ":")
+	if len(parts) != 3 || parts[0] != "vault" {
+		return nil, fmt.Errorf("vault: unexpected Transit signature format %q", response.Data.Signature)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("vault: could not decode Transit signature: %w", err)
+	}
+
+	return signature, nil
+}
+
+// KeepAlive renews the client's token before it expires, until the context is
+// cancelled. Tokens are otherwise renewed when a request is made, so this
+// ensures that the token does not expire while the client is idle. A token
+// that cannot be renewed is replaced by logging in again, when the
+// authentication method allows.
+func (c *Client) KeepAlive(ctx context.Context) {
+	const retryInterval = 30 * time.Second
+
+	attempted := false
+
+	for {
+		wait, ok := c.untilRenewal()
+		if !ok {
+			// the token does not expire
+			return
+		}
+
+		// a token still due for renewal after an attempt could not be renewed
+		// or replaced, so the attempt is retried after a delay
+		if attempted && wait == 0 {
+			wait = retryInterval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := c.token(ctx); err != nil {
+			log.Error().Err(err).Dur("retry", retryInterval).Msg("vault: token renewal failed")
+		}
+		attempted = true
+	}
+}
+
+// untilRenewal returns the time until the token is due to be renewed, and
+// false if the token does not expire.
+func (c *Client) untilRenewal() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lease == nil {
+		return 0, true
+	}
+
+	if c.lease.ttl == 0 {
+		return 0, false
+	}
+
+	return max(c.lease.renewAt().Sub(c.now()), 0), true
+}
+
+// token returns a token that is valid for a request, logging in or renewing
+// the current token as required.
+func (c *Client) token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	current := c.lease
+
+	if current != nil && (current.ttl == 0 || now.Before(current.renewAt())) {
+		return current.token, nil
+	}
+
+	if current != nil && current.renewable && !current.expired(now) {
+		renewed, err := c.renew(ctx, current.token)
+		// a renewal limited by the token's maximum TTL does not extend its
+		// life, so a new token is needed
+		if err == nil && renewed.expiry().After(current.expiry()) {
+			c.lease = &renewed
+			return renewed.token, nil
+		}
+		if err != nil {
+			log.Warn().Err(err).Msg("vault: token renewal failed, logging in again")
+		}
+	}
+
+	next, err := c.login(ctx)
+	if err != nil {
+		// a token that has not yet expired remains usable
+		if current != nil && !current.expired(now) {
+			log.Warn().Err(err).Time("expiry", current.expiry()).Msg("vault: login failed, using current token until it expires")
+			return current.token, nil
+		}
+		return "", err
+	}
+
+	c.lease = &next
+
+	return next.token, nil
+}
+
+// authResponse is the auth section of a login or renewal response.
+type authResponse struct {
+	Auth *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int64  `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+}
+
+func (c *Client) newLease(response authResponse) (lease, error) {
+	if response.Auth == nil || response.Auth.ClientToken == "" {
+		return lease{}, errors.New("vault: response has no token")
+	}
+
+	return lease{
+		token:     response.Auth.ClientToken,
+		renewable: response.Auth.Renewable,
+		ttl:       time.Duration(response.Auth.LeaseDuration) * time.Second,
+		obtained:  c.now(),
+	}, nil
+}
+
+// authenticate logs in to the auth method mounted at the path.
+func (c *Client) authenticate(ctx context.Context, mount string, credentials map[string]string) (lease, error) {
+	var response authResponse
+	if err := c.send(ctx, "", http.MethodPost, "auth/"+mount+"/login", credentials, &response); err != nil {
+		return lease{}, err
+	}
+
+	return c.newLease(response)
+}
+
+// lookupToken describes a configured token, so that it can be renewed. If the
+// token cannot be looked up, it is used without renewal.
+func (c *Client) lookupToken(ctx context.Context, token string) (lease, error) {
+	var response struct {
+		Data struct {
+			TTL       int64 `json:"ttl"`
+			Renewable bool  `json:"renewable"`
+		} `json:"data"`
+	}
+
+	if err := c.send(ctx, token, http.MethodGet, "auth/token/lookup-self", nil, &response); err != nil {
+		log.Warn().Err(err).Msg("vault: token lookup failed, token will not be renewed")
+		return lease{token: token, obtained: c.now()}, nil
+	}
+
+	return lease{
+		token:     token,
+		renewable: response.Data.Renewable,
+		ttl:       time.Duration(response.Data.TTL) * time.Second,
+		obtained:  c.now(),
+	}, nil
+}
+
+func (c *Client) renew(ctx context.Context, token string) (lease, error) {
+	var response authResponse
+	if err := c.send(ctx, token, http.MethodPost, "auth/token/renew-self", map[string]string{}, &response); err != nil {
+		return lease{}, err
+	}
+
+	return c.newLease(response)
+}
+
+func readTokenFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("vault: could not read Kubernetes service account token: %w", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// do sends an authenticated request to the API path, decoding the response
+// into out.
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	token, err := c.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.send(ctx, token, method, path, in, out)
+}
+
+// send sends a request to the API path with the token, if any, decoding the
+// response into out.
+func (c *Client) send(ctx context.Context, token, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		content, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(content)
+	}
+
+	u := c.address.JoinPath("v1", strings.TrimPrefix(path, "/"))
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault: request failed: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return responseError(res)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("vault: could not decode response: %w", err)
+	}
+
+	return nil
+}
+
+// responseError describes an unsuccessful response, including the errors
+// reported by Vault.
+func responseError(res *http.Response) error {
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	_ = json.NewDecoder(io.LimitReader(res.Body, 64<<10)).Decode(&body)
+
+	if len(body.Errors) > 0 {
+		return fmt.Errorf("vault: %s %s: %s: %s", res.Request.Method, res.Request.URL.Path, res.Status, strings.Join(body.Errors, "; "))
+	}
+
+	return fmt.Errorf("vault: %s %s: %s", res.Request.Method, res.Request.URL.Path, res.Status)
+}
@@ -0,0 +1,197 @@
+package vault_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_RequiresConfiguration(t *testing.T) {
+	_, err := vault.New(config.VaultConfig{})
+	assert.ErrorContains(t, err, "VAULT_ADDR must be configured")
+
+	_, err = vault.New(config.VaultConfig{Address: "vault:8200", Token: "s.token"})
+	assert.ErrorContains(t, err, "must be an absolute http(s) URL")
+
+	_, err = vault.New(config.VaultConfig{Address: "http://vault:8200"})
+	assert.ErrorContains(t, err, "VAULT_TOKEN must be configured")
+
+	_, err = vault.New(config.VaultConfig{Address: "http://vault:8200", AuthMethod: "approle", AppRoleRoleID: "role"})
+	assert.ErrorContains(t, err, "VAULT_APPROLE_SECRET_ID must be configured")
+
+	_, err = vault.New(config.VaultConfig{Address: "http://vault:8200", AuthMethod: "kubernetes", KubernetesTokenFile: "/token"})
+	assert.ErrorContains(t, err, "VAULT_KUBERNETES_ROLE and VAULT_KUBERNETES_TOKEN_FILE must be configured")
+
+	_, err = vault.New(config.VaultConfig{Address: "http://vault:8200", AuthMethod: "userpass"})
+	assert.ErrorContains(t, err, `unknown VAULT_AUTH_METHOD "userpass"`)
+}
+
+func TestRead(t *testing.T) {
+	var token, namespace string
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Vault-Token")
+		namespace = r.Header.Get("X-Vault-Namespace")
+
+		if r.Method != http.MethodGet || r.URL.Path != "/v1/secret/data/chinmina" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"data":{"data":{"token":"bkua_1234"},"metadata":{"version":1}}}`))
+	}))
+	defer svr.Close()
+
+	client, err := vault.New(config.VaultConfig{Address: svr.URL, Token: "s.token", Namespace: "admin"})
+	require.NoError(t, err)
+
+	data, err := client.Read(context.Background(), "/secret/data/chinmina")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"token": "bkua_1234"}, data["data"])
+	assert.Equal(t, "s.token", token)
+	assert.Equal(t, "admin", namespace)
+
+	_, err = client.Read(context.Background(), "secret/data/missing")
+	assert.ErrorContains(t, err, "vault: GET /v1/secret/data/missing: 404 Not Found")
+}
+
+func TestRead_ReportsVaultErrors(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+	}))
+	defer svr.Close()
+
+	client, err := vault.New(config.VaultConfig{Address: svr.URL, Token: "s.token"})
+	require.NoError(t, err)
+
+	_, err = client.Read(context.Background(), "secret/data/chinmina")
+	assert.ErrorContains(t, err, "403 Forbidden: permission denied")
+}
+
+func TestTransitSign_AppRole(t *testing.T) {
+	signature := []byte("test_signature")
+	digest := sha256.Sum256([]byte("header.claims"))
+
+	var login, sign map[string]any
+	var signToken string
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle-ci/login":
+			assert.Empty(t, r.Header.Get("X-Vault-Token"))
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&login))
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.approle","lease_duration":3600,"renewable":true}}`))
+		case "/v1/signing/sign/github-app/sha2-256":
+			signToken = r.Header.Get("X-Vault-Token")
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&sign))
+			_, _ = w.Write([]byte(`{"data":{"signature":"vault:v2:` + base64.StdEncoding.EncodeToString(signature) + `"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	client, err := vault.New(config.VaultConfig{
+		Address:         svr.URL,
+		AuthMethod:      "approle",
+		AuthMount:       "approle-ci",
+		AppRoleRoleID:   "role-id",
+		AppRoleSecretID: "secret-id",
+		TransitMount:    "signing",
+	})
+	require.NoError(t, err)
+
+	actual, err := client.TransitSign(context.Background(), "github-app", digest[:])
+	require.NoError(t, err)
+
+	assert.Equal(t, signature, actual)
+	assert.Equal(t, map[string]any{"role_id": "role-id", "secret_id": "secret-id"}, login)
+	assert.Equal(t, "s.approle", signToken)
+	assert.Equal(t, map[string]any{
+		"input":               base64.StdEncoding.EncodeToString(digest[:]),
+		"prehashed":           true,
+		"signature_algorithm": "pkcs1v15",
+	}, sign)
+}
+
+func TestTransitSign_RejectsUnexpectedSignature(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"data":{"signature":"not-a-signature"}}`))
+	}))
+	defer svr.Close()
+
+	client, err := vault.New(config.VaultConfig{Address: svr.URL, Token: "s.token"})
+	require.NoError(t, err)
+
+	_, err = client.TransitSign(context.Background(), "github-app", []byte("digest"))
+	assert.ErrorContains(t, err, "unexpected Transit signature format")
+}
+
+func TestRead_KubernetesLogin(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("service-account-jwt\n"), 0o600))
+
+	var login map[string]any
+
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/kubernetes/login":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&login))
+			_, _ = w.Write([]byte(`{"auth":{"client_token":"s.kubernetes","lease_duration":3600,"renewable":true}}`))
+		case "/v1/secret/data/chinmina":
+			if r.Header.Get("X-Vault-Token") != "s.kubernetes" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"data":{"token":"bkua_1234"}}`))
+		}
+	}))
+	defer svr.Close()
+
+	client, err := vault.New(config.VaultConfig{
+		Address:             svr.URL,
+		AuthMethod:          "kubernetes",
+		KubernetesRole:      "chinmina",
+		KubernetesTokenFile: tokenFile,
+	})
+	require.NoError(t, err)
+
+	data, err := client.Read(context.Background(), "secret/data/chinmina")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{"token": "bkua_1234"}, data)
+	assert.Equal(t, map[string]any{"role": "chinmina", "jwt": "service-account-jwt"}, login)
+}
+
+func TestRead_LoginFailure(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+	}))
+	defer svr.Close()
+
+	client, err := vault.New(config.VaultConfig{
+		Address:         svr.URL,
+		AuthMethod:      "approle",
+		AppRoleRoleID:   "role-id",
+		AppRoleSecretID: "secret-id",
+	})
+	require.NoError(t, err)
+
+	_, err = client.Read(context.Background(), "secret/data/chinmina")
+	assert.ErrorContains(t, err, "vault: POST /v1/auth/approle/login: 400 Bad Request: invalid role or secret ID")
+}
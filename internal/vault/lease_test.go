@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuth is a Vault fake that counts logins and renewals. Each renewal
+// extends the token's lease by renewTTL seconds.
+type fakeAuth struct {
+	logins    atomic.Int32
+	renewals  atomic.Int32
+	renewTTL  string
+	failRenew bool
+}
+
+func (f *fakeAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/v1/auth/approle/login":
+		f.logins.Add(1)
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"s.login","lease_duration":60,"renewable":true}}`))
+	case "/v1/auth/token/renew-self":
+		f.renewals.Add(1)
+		if f.failRenew {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"auth":{"client_token":"` + r.Header.Get("X-Vault-Token") + `","lease_duration":` + f.renewTTL + `,"renewable":true}}`))
+	case "/v1/auth/token/lookup-self":
+		_, _ = w.Write([]byte(`{"data":{"ttl":0,"renewable":false}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestClient(t *testing.T, handler http.Handler, cfg config.VaultConfig) (*Client, *time.Time) {
+	t.Helper()
+
+	svr := httptest.NewServer(handler)
+	t.Cleanup(svr.Close)
+
+	cfg.Address = svr.URL
+	c, err := New(cfg)
+	require.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	return c, &now
+}
+
+var appRole = config.VaultConfig{AuthMethod: "approle", AppRoleRoleID: "role", AppRoleSecretID: "secret"}
+
+func TestToken_RenewsBeforeExpiry(t *testing.T) {
+	fake := &fakeAuth{renewTTL: "60"}
+	c, now := newTestClient(t, fake, appRole)
+	ctx := context.Background()
+
+	token, err := c.token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "s.login", token)
+
+	// not yet due for renewal
+	*now = now.Add(30 * time.Second)
+	_, err = c.token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), fake.renewals.Load())
+
+	// two thirds of the way through the lease
+	*now = now.Add(15 * time.Second)
+	token, err = c.token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "s.login", token)
+	assert.Equal(t, int32(1), fake.renewals.Load())
+	assert.Equal(t, int32(1), fake.logins.Load())
+
+	wait, ok := c.untilRenewal()
+	assert.True(t, ok)
+	assert.Equal(t, 40*time.Second, wait)
+}
+
+func TestToken_LogsInWhenRenewalFails(t *testing.T) {
+	fake := &fakeAuth{failRenew: true}
+	c, now := newTestClient(t, fake, appRole)
+	ctx := context.Background()
+
+	_, err := c.token(ctx)
+	require.NoError(t, err)
+
+	*now = now.Add(45 * time.Second)
+	_, err = c.token(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), fake.renewals.Load())
+	assert.Equal(t, int32(2), fake.logins.Load())
+}
+
+func TestToken_LogsInWhenRenewalDoesNotExtendLease(t *testing.T) {
+	// the token has reached its maximum TTL: renewal only grants the time
+	// remaining
+	fake := &fakeAuth{renewTTL: "15"}
+	c, now := newTestClient(t, fake, appRole)
+	ctx := context.Background()
+
+	_, err := c.token(ctx)
+	require.NoError(t, err)
+
+	*now = now.Add(45 * time.Second)
+	_, err = c.token(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(1), fake.renewals.Load())
+	assert.Equal(t, int32(2), fake.logins.Load())
+}
+
+func TestToken_LogsInAfterExpiry(t *testing.T) {
+	fake := &fakeAuth{renewTTL: "60"}
+	c, now := newTestClient(t, fake, appRole)
+	ctx := context.Background()
+
+	_, err := c.token(ctx)
+	require.NoError(t, err)
+
+	*now = now.Add(2 * time.Minute)
+	_, err = c.token(ctx)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(0), fake.renewals.Load())
+	assert.Equal(t, int32(2), fake.logins.Load())
+}
+
+func TestToken_StaticTokenWithoutTTLIsNotRenewed(t *testing.T) {
+	fake := &fakeAuth{}
+	c, now := newTestClient(t, fake, config.VaultConfig{Token: "s.root"})
+	ctx := context.Background()
+
+	token, err := c.token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "s.root", token)
+
+	*now = now.Add(24 * time.Hour)
+	_, err = c.token(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), fake.renewals.Load())
+
+	_, ok := c.untilRenewal()
+	assert.False(t, ok)
+}
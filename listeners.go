@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+)
+
+const (
+	// systemdListenFDsStart is the first file descriptor passed by systemd
+	// socket activation. See sd_listen_fds(3).
+	systemdListenFDsStart = 3
+)
+
+// configureListeners creates the listeners the server will accept connections
+// on: the TCP port, a Unix domain socket and sockets passed by systemd socket
+// activation, in any combination. At least one listener is required.
+func configureListeners(cfg config.ServerConfig) ([]net.Listener, error) {
+	var listeners []net.Listener
+
+	// ensure that nothing is left open if a later listener fails
+	fail := func(err error) ([]net.Listener, error) {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil, err
+	}
+
+	systemdListeners, err := systemdListeners()
+	if err != nil {
+		return fail(fmt.Errorf("systemd socket activation failed: %w", err))
+	}
+	listeners = append(listeners, systemdListeners...)
+
+	if cfg.UnixSocket != "" {
+		l, err := unixListener(cfg.UnixSocket, cfg.UnixSocketMode)
+		if err != nil {
+			return fail(fmt.Errorf("unix socket listener failed: %w", err))
+		}
+		listeners = append(listeners, l)
+	}
+
+	if cfg.TCPEnabled {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+		if err != nil {
+			return fail(fmt.Errorf("tcp listener failed: %w", err))
+		}
+		listeners = append(listeners, l)
+	}
+
+	if len(listeners) == 0 {
+		return nil, errors.New("no listeners configured: enable the TCP port, a Unix socket or systemd socket activation")
+	}
+
+	return listeners, nil
+}
+
+// unixListener listens on a Unix domain socket at the given path, applying the
+// given permissions (an octal string) to the socket file. A stale socket left by
+// a previous process is removed.
+func unixListener(path string, mode string) (net.Listener, error) {
+	perm, err := parseSocketMode(mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, perm); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("could not set socket permissions: %w", err)
+	}
+
+	return l, nil
+}
+
+// systemdListeners returns the listeners passed to this process by systemd
+// socket activation, if any. The environment variables are cleared so they are
+// not inherited by child processes.
+func systemdListeners() ([]net.Listener, error) {
+	pid := os.Getenv("LISTEN_PID")
+	fds := os.Getenv("LISTEN_FDS")
+	if pid == "" || fds == "" {
+		return nil, nil
+	}
+
+	// the sockets are only intended for the process systemd started
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(fds)
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS value %q", fds)
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+	for i := range count {
+		name := fmt.Sprintf("systemd-fd-%d", i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+
+		f := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+
+		// FileListener duplicates the descriptor, so the file is always closed
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s is not a listener: %w", name, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+
+	return listeners, nil
+}
+
+// parseSocketMode parses the octal permissions of the Unix socket.
+func parseSocketMode(mode string) (fs.FileMode, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid socket mode %q: %w", mode, err)
+	}
+
+	return fs.FileMode(perm), nil
+}
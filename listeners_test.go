@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureListeners_TCP(t *testing.T) {
+	listeners, err := configureListeners(config.ServerConfig{TCPEnabled: true, Port: 0})
+	require.NoError(t, err)
+	defer closeAll(listeners)
+
+	require.Len(t, listeners, 1)
+	assert.Equal(t, "tcp", listeners[0].Addr().Network())
+}
+
+func TestConfigureListeners_UnixSocket(t *testing.T) {
+	path := socketPath(t)
+
+	listeners, err := configureListeners(config.ServerConfig{
+		UnixSocket:     path,
+		UnixSocketMode: "0600",
+	})
+	require.NoError(t, err)
+	defer closeAll(listeners)
+
+	require.Len(t, listeners, 1)
+	assert.Equal(t, "unix", listeners[0].Addr().Network())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestConfigureListeners_UnixSocketAndTCP(t *testing.T) {
+	listeners, err := configureListeners(config.ServerConfig{
+		TCPEnabled:     true,
+		Port:           0,
+		UnixSocket:     socketPath(t),
+		UnixSocketMode: "0660",
+	})
+	require.NoError(t, err)
+	defer closeAll(listeners)
+
+	assert.Len(t, listeners, 2)
+}
+
+func TestConfigureListeners_ReplacesStaleSocket(t *testing.T) {
+	path := socketPath(t)
+
+	stale, err := unixListener(path, "0660")
+	require.NoError(t, err)
+
+	// simulate a process that exited without cleaning up
+	stale.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listeners, err := configureListeners(config.ServerConfig{UnixSocket: path, UnixSocketMode: "0660"})
+	require.NoError(t, err)
+	defer closeAll(listeners)
+
+	assert.Len(t, listeners, 1)
+}
+
+func TestConfigureListeners_Failures(t *testing.T) {
+	dir := t.TempDir()
+	regularFile := filepath.Join(dir, "not-a-socket")
+	require.NoError(t, os.WriteFile(regularFile, []byte("data"), 0o600))
+
+	cases := []struct {
+		name    string
+		cfg     config.ServerConfig
+		wantErr string
+	}{
+		{
+			name:    "no listeners",
+			cfg:     config.ServerConfig{TCPEnabled: false},
+			wantErr: "no listeners configured",
+		},
+		{
+			name:    "invalid mode",
+			cfg:     config.ServerConfig{UnixSocket: filepath.Join(dir, "s.sock"), UnixSocketMode: "rw-rw----"},
+			wantErr: "invalid socket mode",
+		},
+		{
+			name:    "path is not a socket",
+			cfg:     config.ServerConfig{UnixSocket: regularFile, UnixSocketMode: "0660"},
+			wantErr: "exists and is not a socket",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := configureListeners(tc.cfg)
+			assert.ErrorContains(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestSystemdListeners_IgnoredForOtherProcess(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	t.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := systemdListeners()
+	require.NoError(t, err)
+	assert.Empty(t, listeners)
+}
+
+func TestSystemdListeners_InvalidCount(t *testing.T) {
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "many")
+
+	_, err := systemdListeners()
+	assert.ErrorContains(t, err, "invalid LISTEN_FDS")
+}
+
+// socketPath returns a short path for a socket: socket paths are limited to
+// around 100 characters, which a nested test temp directory can exceed.
+func socketPath(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "cb")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return filepath.Join(dir, "s.sock")
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
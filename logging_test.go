@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureLogging_AuditUnsampled(t *testing.T) {
+	previous := log.Logger
+	t.Cleanup(func() {
+		log.Logger = previous
+		_ = configureLogging(config.LogConfig{})
+	})
+
+	err := configureLogging(config.LogConfig{Level: "error", SampleInfoBurst: 1, SampleInfoPeriodSecs: 3600})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	logger := log.Logger.Output(&buf)
+
+	logger.Info().Msg("dropped")
+	for range 3 {
+		logger.WithLevel(audit.Level).Msg("audited")
+	}
+
+	assert.NotContains(t, buf.String(), "dropped")
+	assert.Equal(t, 3, strings.Count(buf.String(), "audited"), "audit events are never sampled")
+}
+
+func TestConfigureLogging_RejectsInvalidConfiguration(t *testing.T) {
+	previous := log.Logger
+	t.Cleanup(func() { log.Logger = previous })
+
+	cases := map[string]struct {
+		cfg      config.LogConfig
+		expected string
+	}{
+		"level":     {config.LogConfig{Level: "loud"}, `unknown log level "loud"`},
+		"format":    {config.LogConfig{Format: "xml"}, `unknown log format "xml"`},
+		"component": {config.LogConfig{ComponentLevels: map[string]string{"disk": "debug"}}, `unknown log component "disk"`},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := configureLogging(tc.cfg)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
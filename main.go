@@ -13,8 +13,14 @@ import (
 	"github.com/jamestelfer/chinmina-bridge/internal/buildkite"
 	"github.com/jamestelfer/chinmina-bridge/internal/config"
 	"github.com/jamestelfer/chinmina-bridge/internal/github"
+	"github.com/jamestelfer/chinmina-bridge/internal/health"
 	"github.com/jamestelfer/chinmina-bridge/internal/jwt"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
 	"github.com/jamestelfer/chinmina-bridge/internal/observe"
+	"github.com/jamestelfer/chinmina-bridge/internal/redact"
+	"github.com/jamestelfer/chinmina-bridge/internal/secret"
+	"github.com/jamestelfer/chinmina-bridge/internal/tlsconfig"
+	"github.com/jamestelfer/chinmina-bridge/internal/vault"
 	"github.com/jamestelfer/chinmina-bridge/internal/vendor"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -30,7 +36,12 @@ func configureServerRoutes(ctx context.Context, cfg config.Config) (http.Handler
 	// configure middleware
 	auditor := audit.Middleware()
 
-	authorizer, err := jwt.Middleware(cfg.Authorization)
+	keys, err := jwt.NewKeySet(ctx, cfg.Authorization)
+	if err != nil {
+		return nil, fmt.Errorf("JWKS configuration failed: %w", err)
+	}
+
+	authorizer, err := jwt.Middleware(cfg.Authorization, keys)
 	if err != nil {
 		return nil, fmt.Errorf("authorizer configuration failed: %w", err)
 	}
@@ -40,38 +51,136 @@ func configureServerRoutes(ctx context.Context, cfg config.Config) (http.Handler
 	requestLimitBytes := int64(20 << 10) // 20 KB
 	requestLimiter := maxRequestSize(requestLimitBytes)
 
-	authorizedRouteMiddleware := alice.New(requestLimiter, auditor, authorizer)
+	// when configured, only clients with an allowed certificate may request
+	// tokens
+	clientNames, err := tlsconfig.RequireClientNames(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("client certificate configuration failed: %w", err)
+	}
+
+	authorizedRouteMiddleware := alice.New(requestLimiter, auditor, clientNames, authorizer)
 	standardRouteMiddleware := alice.New(requestLimiter)
 
+	// Secrets may be references to files or secret managers. These are
+	// resolved now, and refreshed so that rotated secrets are used without a
+	// restart.
+	secrets := secret.NewResolver(cfg.Vault)
+	secretRefresh := time.Duration(cfg.Secret.RefreshIntervalSeconds) * time.Second
+
+	bkCfg := cfg.Buildkite
+	bkCfg.Token, err = secrets.Resolve(ctx, cfg.Buildkite.Token)
+	if err != nil {
+		return nil, fmt.Errorf("BUILDKITE_API_TOKEN could not be resolved: %w", err)
+	}
+
 	// setup token handler and dependencies
-	bk, err := buildkite.New(cfg.Buildkite)
+	bk, err := buildkite.New(bkCfg)
 	if err != nil {
 		return nil, fmt.Errorf("buildkite configuration failed: %w", err)
 	}
+	secrets.Watch(ctx, "BUILDKITE_API_TOKEN", cfg.Buildkite.Token, bkCfg.Token, secretRefresh, bk.SetToken)
+
+	// the private key is not used when the key is held by a key service
+	ghCfg := cfg.Github
+	var ghOpts []github.Option
+	localKey := github.UsesPrivateKey(ghCfg)
+
+	if localKey {
+		ghCfg.PrivateKey, err = secrets.Resolve(ctx, cfg.Github.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_PRIVATE_KEY could not be resolved: %w", err)
+		}
+	} else if github.UsesVaultTransit(ghCfg) {
+		vaultClient, err := vault.New(cfg.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("vault configuration failed: %w", err)
+		}
+		go vaultClient.KeepAlive(ctx)
 
-	gh, err := github.New(ctx, cfg.Github)
+		ghOpts = append(ghOpts, github.WithVaultClient(vaultClient))
+	}
+
+	if github.UsesSecondaryPrivateKey(ghCfg) {
+		ghCfg.SecondaryPrivateKey, err = secrets.Resolve(ctx, cfg.Github.SecondaryPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_SECONDARY_PRIVATE_KEY could not be resolved: %w", err)
+		}
+	}
+
+	if ghCfg.PKCS11PIN != "" {
+		ghCfg.PKCS11PIN, err = secrets.Resolve(ctx, cfg.Github.PKCS11PIN)
+		if err != nil {
+			return nil, fmt.Errorf("GITHUB_APP_PKCS11_PIN could not be resolved: %w", err)
+		}
+	}
+
+	gh, err := github.New(ctx, ghCfg, ghOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("github configuration failed: %w", err)
 	}
+	if localKey {
+		secrets.Watch(ctx, "GITHUB_APP_PRIVATE_KEY", cfg.Github.PrivateKey, ghCfg.PrivateKey, secretRefresh, gh.SetPrivateKey)
+	}
+	if github.UsesSecondaryPrivateKey(ghCfg) {
+		secrets.Watch(ctx, "GITHUB_APP_SECONDARY_PRIVATE_KEY", cfg.Github.SecondaryPrivateKey, ghCfg.SecondaryPrivateKey, secretRefresh, gh.SetSecondaryPrivateKey)
+	}
+
+	if cfg.Github.SelfTestEnabled {
+		err = gh.RunSelfTest(ctx, cfg.Github)
+		if err != nil {
+			return nil, fmt.Errorf("github self test failed: %w", err)
+		}
+	}
 
 	vendorCache, err := vendor.Cached(45 * time.Minute)
 	if err != nil {
 		return nil, fmt.Errorf("vendor cache configuration failed: %w", err)
 	}
 
+	// readiness checks verify each dependency, with results cached to limit
+	// upstream calls
+	readiness := health.NewChecker(time.Duration(cfg.Server.ReadinessCacheSeconds) * time.Second)
+	readiness.Add("jwks", health.Static(keys.Ready))
+	readiness.Add("buildkite", bk.CheckToken)
+	readiness.Add("githubSigner", gh.CheckSigner)
+	readiness.Add("githubApp", gh.CheckAppAuthentication)
+
 	tokenVendor := vendor.Auditor(vendorCache(vendor.New(bk.RepositoryLookup, gh.CreateAccessToken)))
 
 	mux.Handle("POST /token", authorizedRouteMiddleware.Then(handlePostToken(tokenVendor)))
 	mux.Handle("POST /git-credentials", authorizedRouteMiddleware.Then(handlePostGitCredentials(tokenVendor)))
 
-	// healthchecks are not included in telemetry or authorization
+	// healthchecks are not included in telemetry or authorization. The
+	// healthcheck is a cheap liveness check, while readiness checks
+	// dependencies.
 	muxWithoutTelemetry.Handle("GET /healthcheck", standardRouteMiddleware.Then(handleHealthCheck()))
+	muxWithoutTelemetry.Handle("GET /readyz", standardRouteMiddleware.Then(handleReadyCheck(readiness)))
+
+	// metrics scrapes are excluded for the same reason: they are frequent and
+	// unauthenticated, and would otherwise be counted in the metrics they read
+	if cfg.Observe.Enabled && cfg.Observe.PrometheusEnabled {
+		muxWithoutTelemetry.Handle("GET /metrics", standardRouteMiddleware.Then(observe.MetricsHandler()))
+	}
 
 	return mux, nil
 }
 
 func main() {
-	configureLogging()
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "verify":
+			os.Exit(runVerify(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "audit":
+			os.Exit(runAudit(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "config":
+			os.Exit(runConfig(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+
+	// logging is configured with defaults until the configuration is loaded
+	if err := configureLogging(config.LogConfig{}); err != nil {
+		log.Fatal().Err(err).Msg("logging configuration failed")
+	}
 
 	logBuildInfo()
 
@@ -89,12 +198,44 @@ func launchServer() error {
 		return fmt.Errorf("configuration load failed: %w", err)
 	}
 
+	if err := configureLogging(cfg.Log); err != nil {
+		return fmt.Errorf("logging configuration failed: %w", err)
+	}
+
+	// Changes to the configuration file (or SIGHUP) reload the configuration.
+	// Only the log levels are applied while running: other settings are
+	// reported as requiring a restart.
+	reloader, err := config.NewReloader(cfg, func(next config.Config) error {
+		return applyLogLevels(next.Log)
+	})
+	if err != nil {
+		return fmt.Errorf("configuration reload setup failed: %w", err)
+	}
+	reloadCtx, stopReload := context.WithCancel(ctx)
+	defer stopReload()
+	go reloader.Run(reloadCtx)
+
 	// configure telemetry, including wrapping default HTTP client
 	shutdownTelemetry, err := observe.Configure(ctx, cfg.Observe)
 	if err != nil {
 		return fmt.Errorf("telemetry bootstrap failed: %w", err)
 	}
 
+	// configure audit sinks: they are closed once the server has stopped so that
+	// entries written by in-flight requests are delivered
+	shutdownAudit, err := audit.Configure(ctx, cfg.Audit)
+	if err != nil {
+		return fmt.Errorf("audit configuration failed: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeoutSeconds)*time.Second)
+		defer cancel()
+
+		if err := shutdownAudit(ctx); err != nil {
+			log.Error().Err(err).Msg("audit: sink shutdown failed")
+		}
+	}()
+
 	http.DefaultTransport = observe.HttpTransport(
 		configureHttpTransport(cfg.Server),
 		cfg.Observe,
@@ -109,9 +250,13 @@ func launchServer() error {
 		return fmt.Errorf("server routing configuration failed: %w", err)
 	}
 
+	listeners, err := configureListeners(cfg.Server)
+	if err != nil {
+		return fmt.Errorf("listener configuration failed: %w", err)
+	}
+
 	// start the server
 	server := &http.Server{
-		Addr:           fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler:        handler,
 		MaxHeaderBytes: 20 << 10, // 20 KB
 	}
@@ -122,7 +267,17 @@ func launchServer() error {
 		log.Info().Msg("telemetry: shutdown complete")
 	})
 
-	err = serveHTTP(cfg.Server, server)
+	var authServer AuthServer = server
+
+	if tlsconfig.Enabled(cfg.Server) {
+		server.TLSConfig, err = tlsconfig.New(ctx, cfg.Server)
+		if err != nil {
+			return fmt.Errorf("TLS configuration failed: %w", err)
+		}
+		authServer = tlsServer{server}
+	}
+
+	err = serveHTTP(cfg.Server, authServer, listeners)
 	if err != nil {
 		return fmt.Errorf("server failed: %w", err)
 	}
@@ -130,22 +285,72 @@ func launchServer() error {
 	return nil
 }
 
-func configureLogging() {
-	// Set global level to the minimum: allows the Open Telemetry logging to be
-	// configured separately. However, it means that any logger that sets its
-	// level will log as this effectively disables the global level.
-	zerolog.SetGlobalLevel(zerolog.Level(-128))
+// configureLogging sets up the global logger. It is called with an empty
+// configuration before the configuration is loaded, and again once it has
+// been.
+func configureLogging(cfg config.LogConfig) error {
+	format := cfg.Format
+	if format == "" {
+		format = "json"
+		if development() {
+			format = "console"
+		}
+	}
 
-	// default level is Info
-	log.Logger = log.Level(zerolog.InfoLevel)
+	// Records are also exported over OTLP when log export is enabled.
+	var out zerolog.LevelWriter
+	switch format {
+	case "json":
+		out = observe.LogWriter(os.Stderr)
+	case "console":
+		out = observe.LogWriter(zerolog.ConsoleWriter{Out: os.Stdout})
+	default:
+		return fmt.Errorf("unknown log format %q, expected json or console", cfg.Format)
+	}
 
-	if os.Getenv("ENV") == "development" {
-		log.Logger = log.
-			Output(zerolog.ConsoleWriter{Out: os.Stdout}).
-			Level(zerolog.DebugLevel)
+	if err := applyLogLevels(cfg); err != nil {
+		return err
 	}
 
+	// credentials are masked before records reach any destination, except for
+	// audit records: these are masked before they are chained, and must not be
+	// altered after their hash is calculated.
+	out = redact.Writer(out, audit.Level)
+
+	// Set global level to the minimum: allows the Open Telemetry logging and
+	// components to be configured separately. However, it means that any logger
+	// that sets its level will log as this effectively disables the global
+	// level.
+	zerolog.SetGlobalLevel(zerolog.Level(-128))
+
+	// Events are correlated with the active trace when logged with a context.
+	// Levels and sampling are applied by the sampler rather than the logger
+	// level, so that they can be changed when the configuration is reloaded.
+	logger := zerolog.New(out).
+		With().Timestamp().Logger().
+		Hook(observe.TraceHook{}).
+		Level(zerolog.TraceLevel).
+		Sample(logging.Sampler(""))
+
+	log.Logger = logger
+
 	zerolog.DefaultContextLogger = &log.Logger
+
+	return nil
+}
+
+// applyLogLevels sets the log levels and sampling. Unlike the log format, these
+// can be changed while the server is running.
+func applyLogLevels(cfg config.LogConfig) error {
+	if cfg.Level == "" && development() {
+		cfg.Level = "debug"
+	}
+
+	return logging.Apply(cfg)
+}
+
+func development() bool {
+	return os.Getenv("ENV") == "development"
 }
 
 func logBuildInfo() {
@@ -3,21 +3,35 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/jamestelfer/chinmina-bridge/internal/config"
-	"github.com/rs/zerolog/log"
+	"github.com/jamestelfer/chinmina-bridge/internal/logging"
+	"github.com/jamestelfer/chinmina-bridge/internal/tlsconfig"
 )
 
 type AuthServer interface {
-	ListenAndServe() error
+	Serve(l net.Listener) error
 	Shutdown(ctx context.Context) error
 }
 
-func serveHTTP(serverCfg config.ServerConfig, server AuthServer) error {
+// tlsServer serves HTTPS using the certificates supplied by the server's TLS
+// configuration.
+type tlsServer struct {
+	*http.Server
+}
+
+func (s tlsServer) Serve(l net.Listener) error {
+	return s.Server.ServeTLS(l, "", "")
+}
+
+// serveHTTP serves requests on all the supplied listeners until a shutdown
+// signal is received or any listener fails.
+func serveHTTP(serverCfg config.ServerConfig, server AuthServer, listeners []net.Listener) error {
 	serverCtx := context.Background()
 
 	// capture shutdown signals to allow for graceful shutdown
@@ -26,12 +40,19 @@ func serveHTTP(serverCfg config.ServerConfig, server AuthServer) error {
 	)
 	defer stop()
 
-	// Start the server in a new goroutine
-	serverErr := make(chan error, 1)
-	go func() {
-		log.Info().Int("port", serverCfg.Port).Msg("starting server")
-		serverErr <- server.ListenAndServe()
-	}()
+	// Start serving each listener in a new goroutine. The channel is buffered
+	// so that no goroutine is left blocked after the first error is received.
+	serverErr := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func() {
+			logging.Component("http").Info().
+				Str("network", l.Addr().Network()).
+				Str("address", l.Addr().String()).
+				Bool("tls", tlsconfig.Enabled(serverCfg)).
+				Msg("starting server")
+			serverErr <- server.Serve(l)
+		}()
+	}
 
 	var startupError error
 
@@ -39,12 +60,12 @@ func serveHTTP(serverCfg config.ServerConfig, server AuthServer) error {
 	case err := <-serverErr:
 		// Error when starting HTTP server.
 		if err != nil && err != http.ErrServerClosed {
-			log.Error().Err(err).Msg("failed to start server")
+			logging.Component("http").Error().Err(err).Msg("failed to start server")
 		}
 		// save this error to return, keep processing shutdown sequence
 		startupError = err
 	case <-ctx.Done():
-		log.Info().Msg("server shutdown requested")
+		logging.Component("http").Info().Msg("server shutdown requested")
 		// Stop receiving signal notifications as soon as possible.
 		stop()
 	}
@@ -60,7 +81,7 @@ func serveHTTP(serverCfg config.ServerConfig, server AuthServer) error {
 		return fmt.Errorf("server shutdown failed: %w", err)
 	}
 
-	log.Info().Msg("server shutdown complete")
+	logging.Component("http").Info().Msg("server shutdown complete")
 
 	// if startup failed the error is returned
 	return startupError
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"net"
 	"os/signal"
 	"syscall"
 	"testing"
@@ -18,8 +19,8 @@ type MockServer struct {
 	mock.Mock
 }
 
-func (m *MockServer) ListenAndServe() error {
-	args := m.Called()
+func (m *MockServer) Serve(l net.Listener) error {
+	args := m.Called(l)
 	return args.Error(0)
 }
 
@@ -39,11 +40,11 @@ func TestServeHTTP_StartupError(t *testing.T) {
 	expectedErr := errors.New("startup error")
 
 	mockServer := MockServer{}
-	mockServer.On("ListenAndServe").Return(expectedErr)
+	mockServer.On("Serve", mock.Anything).Return(expectedErr)
 	mockServer.On("Shutdown", mock.Anything).Return(nil)
 
 	serverCfg := config.ServerConfig{Port: -1, ShutdownTimeoutSeconds: 25}
-	err := serveHTTP(serverCfg, &mockServer)
+	err := serveHTTP(serverCfg, &mockServer, testListeners(t))
 
 	require.Error(t, err)
 	assert.Equal(t, expectedErr, err)
@@ -58,7 +59,7 @@ func TestServeHTTP_ShutdownSignal(t *testing.T) {
 	// interrupt isn't received
 	expectedErr := errors.New("startup should be interrupted before this error is returned")
 	mockServer := MockServer{}
-	mockServer.On("ListenAndServe").Return(expectedErr).WaitUntil(time.After(5 * time.Second))
+	mockServer.On("Serve", mock.Anything).Return(expectedErr).WaitUntil(time.After(5 * time.Second))
 	mockServer.On("Shutdown", mock.Anything).Return(nil)
 
 	// send termination signal after the mock server has had enough time to start
@@ -70,7 +71,7 @@ func TestServeHTTP_ShutdownSignal(t *testing.T) {
 	}()
 
 	serverCfg := config.ServerConfig{Port: -1, ShutdownTimeoutSeconds: 25}
-	err := serveHTTP(serverCfg, &mockServer)
+	err := serveHTTP(serverCfg, &mockServer, testListeners(t))
 
 	require.NoError(t, err)
 
@@ -84,7 +85,7 @@ func TestServeHTTP_GracefulShutdown(t *testing.T) {
 	var actualError error
 
 	mockServer := MockServer{}
-	mockServer.On("ListenAndServe").Return(nil)
+	mockServer.On("Serve", mock.Anything).Return(nil)
 	mockServer.On("Shutdown", mock.Anything).Run(func(args mock.Arguments) {
 		ctx := args.Get(0).(context.Context)
 		<-ctx.Done()
@@ -92,10 +93,42 @@ func TestServeHTTP_GracefulShutdown(t *testing.T) {
 	}).Return(errors.New("ignore this"))
 
 	serverCfg := config.ServerConfig{Port: -1, ShutdownTimeoutSeconds: 1}
-	_ = serveHTTP(serverCfg, &mockServer)
+	_ = serveHTTP(serverCfg, &mockServer, testListeners(t))
 
 	require.Error(t, actualError)
 	assert.ErrorContains(t, actualError, "context deadline exceeded")
 
 	mockServer.AssertExpectations(t)
 }
+
+func TestServeHTTP_ServesAllListeners(t *testing.T) {
+	// deregister signal handlers afterwards just in case they're left around
+	defer signal.Reset()
+
+	listeners := append(testListeners(t), testListeners(t)...)
+
+	served := make(chan net.Listener, len(listeners))
+
+	mockServer := MockServer{}
+	mockServer.On("Serve", mock.Anything).Run(func(args mock.Arguments) {
+		served <- args.Get(0).(net.Listener)
+	}).Return(nil)
+	mockServer.On("Shutdown", mock.Anything).Return(nil)
+
+	serverCfg := config.ServerConfig{ShutdownTimeoutSeconds: 1}
+	err := serveHTTP(serverCfg, &mockServer, listeners)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return len(served) == len(listeners) }, time.Second, 10*time.Millisecond)
+	mockServer.AssertNumberOfCalls(t, "Serve", len(listeners))
+}
+
+func testListeners(t *testing.T) []net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	return []net.Listener{l}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+)
+
+// runVerify implements the "verify" subcommand, checking the integrity of
+// exported audit logs. It returns the process exit code: 0 if the logs are
+// intact, 1 if problems were found and 2 if verification could not be run.
+func runVerify(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: chinmina-bridge verify [flags] [file ...]")
+		fmt.Fprintln(stderr, "\nVerifies the hash chain and checkpoints of audit logs. Reads stdin if no files are given.")
+		flags.PrintDefaults()
+	}
+
+	publicKeyFile := flags.String("public-key", "", "PEM encoded RSA public key used to verify checkpoint signatures")
+	requireSignatures := flags.Bool("require-signatures", false, "report unsigned checkpoints as problems")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := audit.VerifyOptions{RequireSignatures: *requireSignatures}
+
+	if *publicKeyFile != "" {
+		key, err := readPublicKey(*publicKeyFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %v\n", err)
+			return 2
+		}
+		opts.PublicKey = key
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	ok := true
+	for _, name := range files {
+		report, err := verifyFile(name, stdin, opts)
+		if err != nil {
+			fmt.Fprintf(stderr, "error: %s: %v\n", name, err)
+			return 2
+		}
+
+		printVerifyReport(stdout, name, report)
+		ok = ok && report.OK()
+	}
+
+	if !ok {
+		return 1
+	}
+
+	return 0
+}
+
+func verifyFile(name string, stdin io.Reader, opts audit.VerifyOptions) (audit.VerifyReport, error) {
+	if name == "-" {
+		return audit.Verify(stdin, opts)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return audit.VerifyReport{}, err
+	}
+	defer f.Close()
+
+	return audit.Verify(f, opts)
+}
+
+func printVerifyReport(w io.Writer, name string, report audit.VerifyReport) {
+	status := "OK"
+	if !report.OK() {
+		status = "FAILED"
+	}
+
+	fmt.Fprintf(w, "%s: %s: %d records in %d chains, %d checkpoints (%d signatures verified, %d unchecked)\n",
+		name, status, report.Records, report.Chains, report.Checkpoints,
+		report.SignaturesVerified, report.SignaturesUnchecked)
+
+	for _, p := range report.Problems {
+		fmt.Fprintf(w, "  %s\n", p)
+	}
+}
+
+func readPublicKey(path string) (*rsa.PublicKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key must be an RSA key")
+	}
+
+	return rsaKey, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jamestelfer/chinmina-bridge/internal/audit"
+	"github.com/jamestelfer/chinmina-bridge/internal/config"
+	"github.com/jamestelfer/chinmina-bridge/internal/testhelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunVerify(t *testing.T) {
+	logFile, publicKeyFile := writeSignedAuditLog(t)
+
+	var stdout, stderr bytes.Buffer
+	code := runVerify([]string{"-public-key", publicKeyFile, "-require-signatures", logFile}, nil, &stdout, &stderr)
+
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "OK: 3 records in 1 chains, 1 checkpoints (1 signatures verified, 0 unchecked)")
+}
+
+func TestRunVerify_ReadsStdin(t *testing.T) {
+	logFile, _ := writeSignedAuditLog(t)
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+
+	var stdout, stderr bytes.Buffer
+	code := runVerify(nil, bytes.NewReader(content), &stdout, &stderr)
+
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "-: OK")
+}
+
+func TestRunVerify_ReportsTampering(t *testing.T) {
+	logFile, publicKeyFile := writeSignedAuditLog(t)
+
+	content, err := os.ReadFile(logFile)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	require.NoError(t, os.WriteFile(logFile, []byte(strings.Join(append(lines[:1], lines[2:]...), "\n")), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := runVerify([]string{"-public-key", publicKeyFile, logFile}, nil, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stdout.String(), "FAILED")
+	assert.Contains(t, stdout.String(), "1 records missing after seq 1")
+}
+
+func TestRunVerify_InvalidPublicKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, []byte("nope"), 0o600))
+
+	var stdout, stderr bytes.Buffer
+	code := runVerify([]string{"-public-key", keyFile}, nil, &stdout, &stderr)
+
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), "public key is not PEM encoded")
+}
+
+// writeSignedAuditLog writes two audit entries and a signed checkpoint to a
+// file, returning the paths of the file and the checkpoint public key.
+func writeSignedAuditLog(t *testing.T) (string, string) {
+	t.Helper()
+	testhelpers.SetupLogger(t)
+
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	privateKeyFile := filepath.Join(dir, "checkpoint.pem")
+	require.NoError(t, os.WriteFile(privateKeyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0o600))
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicKeyFile := filepath.Join(dir, "checkpoint.pub")
+	require.NoError(t, os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	logFile := filepath.Join(dir, "audit.log")
+
+	shutdown, err := audit.Configure(context.Background(), config.AuditConfig{
+		Sinks:                     []string{"file"},
+		File:                      config.AuditFileConfig{Path: logFile, MaxSizeMB: 10},
+		CheckpointIntervalSeconds: 3600,
+		CheckpointKeyFile:         privateKeyFile,
+	})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/token", "/git-credentials"} {
+		_, e := audit.Context(context.Background())
+		e.Path = path
+		e.End(context.Background())()
+	}
+
+	require.NoError(t, shutdown(context.Background()))
+
+	return logFile, publicKeyFile
+}